@@ -0,0 +1,329 @@
+package evm_research
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"math/big"
+)
+
+// NodeHasher hashes two sibling nodes into their parent.
+type NodeHasher func(left, right *[KeyLen]byte) [KeyLen]byte
+
+// KeccakNodeHasher is keccak256(left ++ right), as used by the LxLy exit and L1 info trees and the StateReceiver
+// commitment tree.
+func KeccakNodeHasher(left, right *[KeyLen]byte) [KeyLen]byte {
+	kh := hasherPool.Get().(*keccakHasher)
+	defer hasherPool.Put(kh)
+	return kh.hash2(left, right)
+}
+
+var (
+	ErrAccumulatorFull = errors.New("accumulator is full")
+	// ErrPrunedLeaf is returned for proofs that need nodes from before the frontier an accumulator was restored from.
+	ErrPrunedLeaf = errors.New("leaf is before the restored frontier")
+)
+
+// accLevel holds the complete nodes of one tree level - roots of full subtrees - from index start on.
+type accLevel struct {
+	start uint64
+	nodes [][KeyLen]byte
+}
+
+func (l *accLevel) get(i uint64) ([KeyLen]byte, bool) {
+	if i < l.start || i-l.start >= uint64(len(l.nodes)) {
+		return [KeyLen]byte{}, false
+	}
+	return l.nodes[i-l.start], true
+}
+
+// Accumulator is an append-only Merkle tree of fixed height, where empty leaves are zero and empty subtrees hash up
+// from them. The root, proofs and frontier are the same as the exit tree helpers (addLeaf / calculateRoot) when
+// built with KeccakNodeHasher, but the accumulator keeps every complete node so it can prove any leaf appended
+// since it was created or restored.
+type Accumulator struct {
+	height   uint8
+	hashPair NodeHasher
+	zeros    [][KeyLen]byte
+	count    uint64
+	// levels[h] are the complete nodes at height h; levels[height] holds the root once the tree is full.
+	levels []accLevel
+}
+
+// NewAccumulator creates an empty accumulator. height must be between 1 and 64.
+func NewAccumulator(height uint8, hashPair NodeHasher) *Accumulator {
+	if height == 0 || height > 64 {
+		panic(fmt.Sprintf("invalid accumulator height %v", height))
+	}
+	a := &Accumulator{
+		height:   height,
+		hashPair: hashPair,
+		zeros:    make([][KeyLen]byte, height+1),
+		levels:   make([]accLevel, height+1),
+	}
+	for h := 1; h <= int(height); h++ {
+		a.zeros[h] = hashPair(&a.zeros[h-1], &a.zeros[h-1])
+	}
+	return a
+}
+
+// NewExitTree is the LxLy local exit tree: keccak, height 32, one leaf per deposit.
+func NewExitTree() *Accumulator {
+	return NewAccumulator(exitTreeHeight, KeccakNodeHasher)
+}
+
+// NewL1InfoTree is the V2 (etrog) L1 info tree: keccak, height 32, one L1InfoTreeLeaf per GER update.
+func NewL1InfoTree() *Accumulator {
+	return NewAccumulator(exitTreeHeight, KeccakNodeHasher)
+}
+
+// L1InfoTreeLeaf is keccak256(abi.encodePacked(globalExitRoot, parentBlockHash, minTimestamp)), as computed by
+// PolygonZkEVMGlobalExitRootV2.getLeafValue.
+func L1InfoTreeLeaf(ger ethgo.Hash, parentHash ethgo.Hash, minTimestamp uint64) (leaf [KeyLen]byte) {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], minTimestamp)
+	copy(leaf[:], ethgo.Keccak256(ger[:], parentHash[:], ts[:]))
+	return
+}
+
+// NewStateSyncTree is the tree for a StateReceiver commitment of numSyncs state syncs: keccak, just tall enough to
+// hold them. StateReceiver checks proofs of any length against the committed root, so the height is a convention of
+// the commitment producer; this is the smallest tree that fits.
+func NewStateSyncTree(numSyncs uint64) *Accumulator {
+	height := uint8(1)
+	for height < 64 && uint64(1)<<height < numSyncs {
+		height++
+	}
+	return NewAccumulator(height, KeccakNodeHasher)
+}
+
+var stateSyncObjType = abi.MustNewType("tuple(tuple(uint256 id, address sender, address receiver, bytes data) obj)")
+
+// StateSyncLeaf is keccak256(abi.encode(obj)) of a StateReceiver.StateSync. the struct is dynamic, so its encoding
+// starts with the offset of the tuple.
+func StateSyncLeaf(id uint64, sender, receiver ethgo.Address, data []byte) (leaf [KeyLen]byte, err error) {
+	var enc []byte
+	obj := map[string]interface{}{"id": new(big.Int).SetUint64(id), "sender": sender, "receiver": receiver, "data": data}
+	if enc, err = abi.Encode([]interface{}{obj}, stateSyncObjType); err != nil {
+		return
+	}
+	copy(leaf[:], ethgo.Keccak256(enc))
+	return
+}
+
+func (a *Accumulator) Height() uint8 {
+	return a.height
+}
+
+func (a *Accumulator) Count() uint64 {
+	return a.count
+}
+
+func (a *Accumulator) full() bool {
+	return a.height < 64 && a.count == uint64(1)<<a.height
+}
+
+// Append adds the next leaf.
+func (a *Accumulator) Append(leaf [KeyLen]byte) error {
+	if a.full() {
+		return ErrAccumulatorFull
+	}
+	node, idx := leaf, a.count
+	a.levels[0].nodes = append(a.levels[0].nodes, node)
+	// while node is a right child, its parent is now complete
+	for h := 0; idx&1 == 1; h++ {
+		left, _ := a.levels[h].get(idx - 1)
+		node = a.hashPair(&left, &node)
+		idx >>= 1
+		a.levels[h+1].nodes = append(a.levels[h+1].nodes, node)
+	}
+	a.count++
+	return nil
+}
+
+// Root is the root of the tree with the leaves appended so far.
+func (a *Accumulator) Root() [KeyLen]byte {
+	if a.full() {
+		root, _ := a.levels[a.height].get(0)
+		return root
+	}
+	var node [KeyLen]byte
+	for h := 0; h < int(a.height); h++ {
+		if c := a.count >> h; c&1 == 1 {
+			left, _ := a.levels[h].get(c - 1)
+			node = a.hashPair(&left, &node)
+		} else {
+			node = a.hashPair(&node, &a.zeros[h])
+		}
+	}
+	return node
+}
+
+// subtreeRoot is the root of the subtree at height h, index i, given the current leaves.
+func (a *Accumulator) subtreeRoot(h int, i uint64) (node [KeyLen]byte, err error) {
+	if i < a.count>>h {
+		var ok bool
+		if node, ok = a.levels[h].get(i); !ok {
+			err = ErrPrunedLeaf
+		}
+		return
+	}
+	if i<<h >= a.count {
+		return a.zeros[h], nil
+	}
+	// partially filled - only ever on the right edge of the tree
+	var left, right [KeyLen]byte
+	if left, err = a.subtreeRoot(h-1, 2*i); err != nil {
+		return
+	}
+	if right, err = a.subtreeRoot(h-1, 2*i+1); err != nil {
+		return
+	}
+	return a.hashPair(&left, &right), nil
+}
+
+func (a *Accumulator) path(index uint64) (path [][KeyLen]byte, err error) {
+	path = make([][KeyLen]byte, a.height)
+	for h := 0; h < int(a.height); h++ {
+		if path[h], err = a.subtreeRoot(h, (index>>h)^1); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Proof is the inclusion proof of leaf index against the current root: its siblings, from the leaf up.
+func (a *Accumulator) Proof(index uint64) (leaf [KeyLen]byte, path [][KeyLen]byte, err error) {
+	if index >= a.count {
+		return leaf, nil, fmt.Errorf("leaf %v out of range, count %v", index, a.count)
+	}
+	var ok bool
+	if leaf, ok = a.levels[0].get(index); !ok {
+		return leaf, nil, ErrPrunedLeaf
+	}
+	path, err = a.path(index)
+	return
+}
+
+// rootFromPath hashes leaf up through its siblings. when oldPrefix is set, siblings to the right are taken as empty
+// - the root the tree had when leaf was the last one in it.
+func (a *Accumulator) rootFromPath(leaf [KeyLen]byte, index uint64, path [][KeyLen]byte, oldPrefix bool) [KeyLen]byte {
+	node := leaf
+	for h := 0; h < int(a.height); h++ {
+		if (index>>h)&1 == 1 {
+			node = a.hashPair(&path[h], &node)
+		} else if oldPrefix {
+			node = a.hashPair(&node, &a.zeros[h])
+		} else {
+			node = a.hashPair(&node, &path[h])
+		}
+	}
+	return node
+}
+
+// RootFromPath is the root an inclusion proof of leaf index hashes up to. like VerifyProof it only uses the height
+// and hash of the accumulator.
+func (a *Accumulator) RootFromPath(leaf [KeyLen]byte, index uint64, path [][KeyLen]byte) (root [KeyLen]byte, err error) {
+	if len(path) != int(a.height) {
+		return root, fmt.Errorf("path length %v, expected %v", len(path), a.height)
+	}
+	if a.height < 64 && index >= uint64(1)<<a.height {
+		return root, fmt.Errorf("leaf %v out of range, height %v", index, a.height)
+	}
+	return a.rootFromPath(leaf, index, path, false), nil
+}
+
+// VerifyProof checks an inclusion proof against root. it only uses the height and hash of the accumulator, not
+// its leaves.
+func (a *Accumulator) VerifyProof(leaf [KeyLen]byte, index uint64, path [][KeyLen]byte, root [KeyLen]byte) bool {
+	got, err := a.RootFromPath(leaf, index, path)
+	return err == nil && got == root
+}
+
+// ConsistencyProof shows that the tree of OldSize leaves is a prefix of the tree of NewSize leaves. It is the
+// inclusion proof of the last old leaf in the new tree: the siblings to its left are complete subtrees, the same in
+// both trees, and the ones to its right were empty in the old tree.
+type ConsistencyProof struct {
+	OldSize uint64         `json:"old_size"`
+	NewSize uint64         `json:"new_size"`
+	Leaf    [KeyLen]byte   `json:"leaf"`
+	Path    [][KeyLen]byte `json:"path"`
+}
+
+// ConsistencyProof proves the tree of oldSize leaves is a prefix of the current tree.
+func (a *Accumulator) ConsistencyProof(oldSize uint64) (p *ConsistencyProof, err error) {
+	if oldSize > a.count {
+		return nil, fmt.Errorf("old size %v is larger than the tree, %v", oldSize, a.count)
+	}
+	p = &ConsistencyProof{OldSize: oldSize, NewSize: a.count}
+	if oldSize == 0 {
+		return
+	}
+	if p.Leaf, p.Path, err = a.Proof(oldSize - 1); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// VerifyConsistency checks that oldRoot, with p.OldSize leaves, is a prefix of newRoot.
+func (a *Accumulator) VerifyConsistency(oldRoot, newRoot [KeyLen]byte, p *ConsistencyProof) bool {
+	if p.OldSize > p.NewSize {
+		return false
+	}
+	if p.OldSize == 0 {
+		// every tree extends the empty one
+		return oldRoot == a.zeros[a.height]
+	}
+	idx := p.OldSize - 1
+	if !a.VerifyProof(p.Leaf, idx, p.Path, newRoot) {
+		return false
+	}
+	return a.rootFromPath(p.Leaf, idx, p.Path, true) == oldRoot
+}
+
+// MarshalBinary serializes the frontier: the height, the leaf count and the complete node on the right edge of each
+// level that has one. This is enough to keep appending and to compute the root, but not to prove earlier leaves.
+func (a *Accumulator) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 9, 9+KeyLen*(int(a.height)+1))
+	out[0] = a.height
+	binary.BigEndian.PutUint64(out[1:9], a.count)
+	for h := 0; h <= int(a.height); h++ {
+		if c := a.count >> h; c&1 == 1 {
+			node, _ := a.levels[h].get(c - 1)
+			out = append(out, node[:]...)
+		}
+	}
+	return out, nil
+}
+
+// RestoreAccumulator recreates an accumulator from its MarshalBinary frontier. The hash must be the one it was built
+// with.
+func RestoreAccumulator(data []byte, hashPair NodeHasher) (a *Accumulator, err error) {
+	if len(data) < 9 || data[0] == 0 || data[0] > 64 {
+		return nil, errors.New("invalid accumulator frontier")
+	}
+	a = NewAccumulator(data[0], hashPair)
+	a.count = binary.BigEndian.Uint64(data[1:9])
+	if a.height < 64 && a.count > uint64(1)<<a.height {
+		return nil, fmt.Errorf("count %v does not fit in height %v", a.count, a.height)
+	}
+	nodes := data[9:]
+	for h := 0; h <= int(a.height); h++ {
+		c := a.count >> h
+		a.levels[h].start = c
+		if c&1 == 1 {
+			if len(nodes) < KeyLen {
+				return nil, errors.New("truncated accumulator frontier")
+			}
+			a.levels[h].start = c - 1
+			a.levels[h].nodes = [][KeyLen]byte{[KeyLen]byte(nodes[:KeyLen])}
+			nodes = nodes[KeyLen:]
+		}
+	}
+	if len(nodes) != 0 {
+		return nil, errors.New("trailing data after accumulator frontier")
+	}
+	return
+}
@@ -0,0 +1,490 @@
+package evm_research
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"github.com/umbracle/ethgo/jsonrpc"
+	"math/big"
+	"os"
+	"testing"
+)
+
+func sha256NodeHasher(left, right *[KeyLen]byte) [KeyLen]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
+
+// naiveRoot hashes the whole padded tree level by level.
+func naiveRoot(leaves [][KeyLen]byte, height uint8, hashPair NodeHasher) [KeyLen]byte {
+	level := make([][KeyLen]byte, 1<<height)
+	copy(level, leaves)
+	for len(level) > 1 {
+		next := make([][KeyLen]byte, len(level)/2)
+		for i := range next {
+			next[i] = hashPair(&level[2*i], &level[2*i+1])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+func TestAccumulatorProofs(t *testing.T) {
+	const height = 5
+	leaves := testLeaves(1 << height)
+	acc := NewAccumulator(height, sha256NodeHasher)
+	require.Equal(t, naiveRoot(nil, height, sha256NodeHasher), acc.Root())
+
+	var roots [][KeyLen]byte
+	roots = append(roots, acc.Root())
+	for n := 1; n <= len(leaves); n++ {
+		require.NoError(t, acc.Append(leaves[n-1]))
+		root := acc.Root()
+		require.Equal(t, naiveRoot(leaves[:n], height, sha256NodeHasher), root, "%v leaves", n)
+		roots = append(roots, root)
+
+		for i := 0; i < n; i++ {
+			leaf, path, err := acc.Proof(uint64(i))
+			require.NoError(t, err)
+			require.Equal(t, leaves[i], leaf)
+			require.True(t, acc.VerifyProof(leaf, uint64(i), path, root), "%v leaves, proof of %v", n, i)
+			require.False(t, acc.VerifyProof(leaves[(i+1)%n], uint64(i), path, root) && n > 1)
+		}
+		for m := 0; m <= n; m++ {
+			p, err := acc.ConsistencyProof(uint64(m))
+			require.NoError(t, err)
+			require.True(t, acc.VerifyConsistency(roots[m], root, p), "%v -> %v", m, n)
+			if m > 0 && m < n {
+				require.False(t, acc.VerifyConsistency(roots[m-1], root, p))
+				require.False(t, acc.VerifyConsistency(roots[m], roots[n-1], p))
+			}
+		}
+	}
+	require.ErrorIs(t, acc.Append(leaves[0]), ErrAccumulatorFull)
+
+	_, _, err := acc.Proof(1 << height)
+	require.Error(t, err)
+	_, err = acc.ConsistencyProof(1<<height + 1)
+	require.Error(t, err)
+
+	leaf, path, err := acc.Proof(7)
+	require.NoError(t, err)
+	root, err := acc.RootFromPath(leaf, 7, path)
+	require.NoError(t, err)
+	require.Equal(t, acc.Root(), root)
+	_, err = acc.RootFromPath(leaf, 7, path[1:])
+	require.Error(t, err)
+	_, err = acc.RootFromPath(leaf, 1<<height, path)
+	require.Error(t, err)
+}
+
+func TestAccumulatorRestore(t *testing.T) {
+	leaves := testLeaves(100)
+	acc := NewExitTree()
+	for _, l := range leaves[:37] {
+		require.NoError(t, acc.Append(l))
+	}
+	oldRoot := acc.Root()
+	frontier, err := acc.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, 9+3*KeyLen, len(frontier), "37 has three bits set")
+
+	restored, err := RestoreAccumulator(frontier, KeccakNodeHasher)
+	require.NoError(t, err)
+	require.Equal(t, oldRoot, restored.Root())
+	for _, l := range leaves[37:] {
+		require.NoError(t, acc.Append(l))
+		require.NoError(t, restored.Append(l))
+		require.Equal(t, acc.Root(), restored.Root())
+	}
+
+	// leaves appended after the restore can be proven, and 36 since it is on the frontier. earlier ones can't
+	for i := uint64(36); i < 100; i++ {
+		leaf, path, err := restored.Proof(i)
+		require.NoError(t, err)
+		require.True(t, restored.VerifyProof(leaf, i, path, restored.Root()))
+	}
+	_, _, err = restored.Proof(35)
+	require.ErrorIs(t, err, ErrPrunedLeaf)
+	p, err := restored.ConsistencyProof(40)
+	require.NoError(t, err)
+	require.True(t, restored.VerifyConsistency(rootAt(t, leaves[:40]), restored.Root(), p))
+
+	// a full tree round trips too
+	small := NewAccumulator(2, KeccakNodeHasher)
+	for _, l := range leaves[:4] {
+		require.NoError(t, small.Append(l))
+	}
+	frontier, err = small.MarshalBinary()
+	require.NoError(t, err)
+	restored, err = RestoreAccumulator(frontier, KeccakNodeHasher)
+	require.NoError(t, err)
+	require.Equal(t, small.Root(), restored.Root())
+	require.ErrorIs(t, restored.Append(leaves[4]), ErrAccumulatorFull)
+
+	_, err = RestoreAccumulator(frontier[:len(frontier)-1], KeccakNodeHasher)
+	require.Error(t, err)
+	_, err = RestoreAccumulator(append(frontier, 0), KeccakNodeHasher)
+	require.Error(t, err)
+}
+
+func rootAt(t *testing.T, leaves [][KeyLen]byte) [KeyLen]byte {
+	acc := NewExitTree()
+	for _, l := range leaves {
+		require.NoError(t, acc.Append(l))
+	}
+	return acc.Root()
+}
+
+func TestAccumulatorExitTree(t *testing.T) {
+	bevs, err := processEventsSorted([]string{"./bridge_events_2k.ndjson"})
+	require.NoError(t, err)
+
+	et := NewExitTree()
+	frontier := make([][KeyLen]byte, exitTreeHeight)
+	rootsByCount := [][KeyLen]byte{et.Root()}
+	for i := range bevs {
+		if bevs[i].EventType != BridgeEventDeposit {
+			continue
+		}
+		dep := bevs[i].toDeposit()
+		require.NoError(t, et.Append(hashDeposit(&dep)))
+		addLeaf(hashDeposit(&dep), frontier, dep.DepositCount+1, exitTreeHeight)
+		require.Equal(t, [KeyLen]byte(calculateRoot(frontier, dep.DepositCount+1, exitTreeHeight)), et.Root())
+		rootsByCount = append(rootsByCount, et.Root())
+	}
+
+	// the mainnet exit root of every recorded GER update is the bridge's exit root at that point
+	recs := recordedBridgeState(t, bevs)
+	require.NotEmpty(t, recs)
+	for _, rec := range recs {
+		require.Equal(t, [KeyLen]byte(rec.root), rootsByCount[rec.depositCount], "block %v", rec.blockNum)
+	}
+}
+
+var recordL1InfoTree = flag.Bool("record-l1-info-tree", false, "record "+l1InfoTreeV2Path+" from $ETH_URL")
+
+const l1InfoTreeV2Path = "./l1_info_tree_v2.json"
+
+// l1InfoTreeV2Leaf is an UpdateL1InfoTree event with the block fields that go into its leaf.
+type l1InfoTreeV2Leaf struct {
+	BlockNumber     uint64     `json:"block_number"`
+	MainnetExitRoot ethgo.Hash `json:"mainnet_exit_root"`
+	RollupExitRoot  ethgo.Hash `json:"rollup_exit_root"`
+	ParentHash      ethgo.Hash `json:"parent_hash"`
+	Timestamp       uint64     `json:"timestamp"`
+}
+
+// l1InfoTreeV2Root is PolygonZkEVMGlobalExitRootV2.getRoot() at the end of a block.
+type l1InfoTreeV2Root struct {
+	BlockNumber uint64     `json:"block_number"`
+	LeafCount   uint64     `json:"leaf_count"`
+	Root        ethgo.Hash `json:"root"`
+}
+
+type l1InfoTreeV2Recording struct {
+	Leaves []l1InfoTreeV2Leaf `json:"leaves"`
+	Roots  []l1InfoTreeV2Root `json:"roots"`
+}
+
+// TestRecordL1InfoTreeV2 records the first L1 info tree updates on mainnet after the V2 upgrade, and the root the
+// contract reports after each block that has one.
+func TestRecordL1InfoTreeV2(t *testing.T) {
+	if !*recordL1InfoTree {
+		t.Skip("run with -record-l1-info-tree and $ETH_URL set to record " + l1InfoTreeV2Path)
+	}
+	ec, err := jsonrpc.NewClient(os.Getenv("ETH_URL"))
+	require.NoError(t, err)
+
+	const maxLeaves = 200
+	getRoot := ethgo.Keccak256([]byte("getRoot()"))[:4]
+
+	var rec l1InfoTreeV2Recording
+	for from := uint64(lxlyEVMV2UpgradeBlock); len(rec.Leaves) < maxLeaves; from += 1000 {
+		fromBlockNum, toBlockNum := ethgo.BlockNumber(from), ethgo.BlockNumber(from+999)
+		filter := ethgo.LogFilter{
+			Address: []ethgo.Address{lxlyEVMGlobalExitRootAddr},
+			Topics:  [][]*ethgo.Hash{{&updateL1InfoTreeSignatureHash}},
+			From:    &fromBlockNum,
+			To:      &toBlockNum,
+		}
+		ll, err := ec.Eth().GetLogs(&filter)
+		require.NoError(t, err)
+		for i, l := range ll {
+			b, err := ec.Eth().GetBlockByNumber(ethgo.BlockNumber(l.BlockNumber), false)
+			require.NoError(t, err)
+			rec.Leaves = append(rec.Leaves, l1InfoTreeV2Leaf{
+				BlockNumber:     l.BlockNumber,
+				MainnetExitRoot: l.Topics[1],
+				RollupExitRoot:  l.Topics[2],
+				ParentHash:      b.ParentHash,
+				Timestamp:       b.Timestamp,
+			})
+			if i+1 < len(ll) && ll[i+1].BlockNumber == l.BlockNumber {
+				continue
+			}
+			res, err := ec.Eth().Call(&ethgo.CallMsg{To: &lxlyEVMGlobalExitRootAddr, Data: getRoot}, ethgo.BlockNumber(l.BlockNumber))
+			require.NoError(t, err)
+			rec.Roots = append(rec.Roots, l1InfoTreeV2Root{
+				BlockNumber: l.BlockNumber,
+				LeafCount:   uint64(len(rec.Leaves)),
+				Root:        ethgo.HexToHash(res),
+			})
+		}
+	}
+
+	raw, err := json.MarshalIndent(&rec, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(l1InfoTreeV2Path, raw, 0644))
+}
+
+func TestAccumulatorL1InfoTree(t *testing.T) {
+	leaf := L1InfoTreeLeaf(ethgo.HexToHash("0x01"), ethgo.HexToHash("0x02"), 3)
+	want := ethgo.Keccak256(ethgo.HexToHash("0x01").Bytes(), ethgo.HexToHash("0x02").Bytes(), []byte{0, 0, 0, 0, 0, 0, 0, 3})
+	require.Equal(t, want, leaf[:])
+
+	raw, err := os.ReadFile(l1InfoTreeV2Path)
+	require.NoError(t, err, "record it with TestRecordL1InfoTreeV2")
+	var rec l1InfoTreeV2Recording
+	require.NoError(t, json.Unmarshal(raw, &rec))
+	require.NotEmpty(t, rec.Roots)
+
+	it := NewL1InfoTree()
+	roots := [][KeyLen]byte{it.Root()}
+	for _, l := range rec.Leaves {
+		er := ExitRoots{MainnetExitRoot: l.MainnetExitRoot, RollupExitRoot: l.RollupExitRoot}
+		require.NoError(t, it.Append(L1InfoTreeLeaf(er.GlobalExitRoot(), l.ParentHash, l.Timestamp)))
+		roots = append(roots, it.Root())
+	}
+	for _, r := range rec.Roots {
+		require.Equal(t, [KeyLen]byte(r.Root), roots[r.LeafCount], "block %v", r.BlockNumber)
+	}
+}
+
+// Storage slots of the compiled StateReceiver, found by probing its getters.
+const (
+	stateReceiverCommitmentsSlot   = 53
+	stateReceiverCommitmentIdsSlot = 54
+)
+
+type stateReceiverEVM struct {
+	t    *testing.T
+	abi  *abi.ABI
+	addr common.Address
+	sdb  *state.StateDB
+}
+
+func newStateReceiverEVM(t *testing.T) *stateReceiverEVM {
+	raw, err := os.ReadFile("build/contracts/child/StateReceiver.sol/StateReceiver.json")
+	require.NoError(t, err)
+	var art struct {
+		DeployedBytecode string          `json:"deployedBytecode"`
+		Abi              json.RawMessage `json:"abi"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &art))
+	code, err := hex.DecodeString(art.DeployedBytecode[2:])
+	require.NoError(t, err)
+	a, err := abi.NewABI(string(art.Abi))
+	require.NoError(t, err)
+
+	sdb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	addr := common.HexToAddress("0x0000000000000000000000000000000000001001")
+	sdb.SetCode(addr, code)
+	return &stateReceiverEVM{t: t, abi: a, addr: addr, sdb: sdb}
+}
+
+func (sr *stateReceiverEVM) setSlot(slot *big.Int, v common.Hash) {
+	sr.sdb.SetState(sr.addr, common.BigToHash(slot), v)
+}
+
+// commit writes a commitment straight into storage, as StateReceiver.commit would after checking the validator
+// signatures.
+func (sr *stateReceiverEVM) commit(idx int64, startId, endId uint64, root [KeyLen]byte) {
+	u := func(v uint64) common.Hash { return common.BigToHash(new(big.Int).SetUint64(v)) }
+	sr.setSlot(big.NewInt(stateReceiverCommitmentIdsSlot), u(uint64(idx+1)))
+	idsBase := new(big.Int).SetBytes(crypto.Keccak256(u(stateReceiverCommitmentIdsSlot).Bytes()))
+	sr.setSlot(idsBase.Add(idsBase, big.NewInt(idx)), u(endId))
+
+	base := new(big.Int).SetBytes(crypto.Keccak256(u(uint64(idx)).Bytes(), u(stateReceiverCommitmentsSlot).Bytes()))
+	sr.setSlot(base, u(startId))
+	sr.setSlot(new(big.Int).Add(base, big.NewInt(1)), u(endId))
+	sr.setSlot(new(big.Int).Add(base, big.NewInt(2)), root)
+}
+
+func (sr *stateReceiverEVM) call(method string, args ...interface{}) ([]byte, error) {
+	m := sr.abi.GetMethod(method)
+	require.NotNil(sr.t, m, method)
+	in, err := m.Encode(args)
+	require.NoError(sr.t, err)
+	out, _, err := runtime.Call(sr.addr, in, &runtime.Config{State: sr.sdb})
+	return out, err
+}
+
+func TestAccumulatorStateReceiver(t *testing.T) {
+	type stateSync struct {
+		id       uint64
+		sender   ethgo.Address
+		receiver ethgo.Address
+		data     []byte
+	}
+	var syncs []stateSync
+	for i := uint64(1); i <= 11; i++ {
+		syncs = append(syncs, stateSync{i, ethgo.HexToAddress("0xaa"), ethgo.HexToAddress("0xbb"), []byte{byte(i), 1, 2, 3}})
+	}
+
+	// the same accumulator builds the commitment, and the contract accepts its proofs
+	tree := NewStateSyncTree(uint64(len(syncs)))
+	require.Equal(t, uint8(4), tree.Height())
+	for _, s := range syncs {
+		leaf, err := StateSyncLeaf(s.id, s.sender, s.receiver, s.data)
+		require.NoError(t, err)
+		require.NoError(t, tree.Append(leaf))
+	}
+
+	sr := newStateReceiverEVM(t)
+	sr.commit(0, 1, uint64(len(syncs)), tree.Root())
+
+	out, err := sr.call("getRootByStateSyncId", big.NewInt(5))
+	require.NoError(t, err)
+	require.Equal(t, tree.Root(), [KeyLen]byte(out))
+
+	for i, s := range syncs {
+		obj := map[string]interface{}{"id": new(big.Int).SetUint64(s.id), "sender": s.sender, "receiver": s.receiver, "data": s.data}
+		_, path, err := tree.Proof(uint64(i))
+		require.NoError(t, err)
+		proof := make([][32]byte, len(path))
+		copy(proof, path)
+
+		if i == 3 {
+			// a proof for the wrong leaf is rejected
+			_, err = sr.call("execute", proof, map[string]interface{}{"id": new(big.Int).SetUint64(s.id), "sender": s.sender, "receiver": s.receiver, "data": []byte{0xff}})
+			require.Error(t, err)
+		}
+		_, err = sr.call("execute", proof, obj)
+		require.NoError(t, err, "state sync %v", s.id)
+
+		// once the proof passes the sync is run - the receiver has no code, so it reports failure
+		logs := sr.sdb.Logs()
+		require.Equal(t, i+1, len(logs))
+		require.Equal(t, sr.abi.Events["StateSyncResult"].ID(), ethgo.Hash(logs[i].Topics[0]))
+		require.Equal(t, s.id, logs[i].Topics[1].Big().Uint64())
+	}
+}
+
+var recordStateReceiver = flag.Bool("record-state-receiver", false, "record "+stateReceiverCommitmentPath+
+	" from $CHILD_URL and $ROOT_URL, with the StateSender at $STATE_SENDER_ADDR")
+
+const stateReceiverCommitmentPath = "./state_receiver_commitment.json"
+
+// stateReceiverSync is a StateSender.StateSynced event.
+type stateReceiverSync struct {
+	ID       uint64        `json:"id"`
+	Sender   ethgo.Address `json:"sender"`
+	Receiver ethgo.Address `json:"receiver"`
+	Data     hexutil.Bytes `json:"data"`
+}
+
+// stateReceiverCommitment is the first StateReceiver.NewCommitment on a child chain, with the state syncs it covers.
+type stateReceiverCommitment struct {
+	BlockNumber uint64              `json:"block_number"`
+	StartID     uint64              `json:"start_id"`
+	EndID       uint64              `json:"end_id"`
+	Root        ethgo.Hash          `json:"root"`
+	Syncs       []stateReceiverSync `json:"syncs"`
+}
+
+func TestRecordStateReceiverCommitment(t *testing.T) {
+	if !*recordStateReceiver {
+		t.Skip("run with -record-state-receiver to record " + stateReceiverCommitmentPath)
+	}
+	receiverAbi, err := LoadABI("child/StateReceiver.sol/StateReceiver")
+	require.NoError(t, err)
+	senderAbi, err := LoadABI("root/StateSender.sol/StateSender")
+	require.NoError(t, err)
+	newCommitment, stateSynced := receiverAbi.Events["NewCommitment"], senderAbi.Events["StateSynced"]
+	newCommitmentID, stateSyncedID := newCommitment.ID(), stateSynced.ID()
+
+	child, err := jsonrpc.NewClient(os.Getenv("CHILD_URL"))
+	require.NoError(t, err)
+	from, to := ethgo.BlockNumber(0), ethgo.Latest
+	ll, err := child.Eth().GetLogs(&ethgo.LogFilter{
+		Address: []ethgo.Address{ethgo.HexToAddress("0x0000000000000000000000000000000000001001")},
+		Topics:  [][]*ethgo.Hash{{&newCommitmentID}},
+		From:    &from,
+		To:      &to,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, ll)
+	ev, err := newCommitment.ParseLog(ll[0])
+	require.NoError(t, err)
+	rec := stateReceiverCommitment{
+		BlockNumber: ll[0].BlockNumber,
+		StartID:     ev["startId"].(*big.Int).Uint64(),
+		EndID:       ev["endId"].(*big.Int).Uint64(),
+		Root:        ethgo.Hash(ev["root"].([32]byte)),
+	}
+
+	root, err := jsonrpc.NewClient(os.Getenv("ROOT_URL"))
+	require.NoError(t, err)
+	ll, err = root.Eth().GetLogs(&ethgo.LogFilter{
+		Address: []ethgo.Address{ethgo.HexToAddress(os.Getenv("STATE_SENDER_ADDR"))},
+		Topics:  [][]*ethgo.Hash{{&stateSyncedID}},
+		From:    &from,
+		To:      &to,
+	})
+	require.NoError(t, err)
+	for _, l := range ll {
+		ev, err := stateSynced.ParseLog(l)
+		require.NoError(t, err)
+		id := ev["id"].(*big.Int).Uint64()
+		if id < rec.StartID || id > rec.EndID {
+			continue
+		}
+		rec.Syncs = append(rec.Syncs, stateReceiverSync{id, ev["sender"].(ethgo.Address), ev["receiver"].(ethgo.Address),
+			ev["data"].([]byte)})
+	}
+	require.Len(t, rec.Syncs, int(rec.EndID-rec.StartID+1))
+
+	raw, err := json.MarshalIndent(&rec, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateReceiverCommitmentPath, raw, 0644))
+}
+
+// TestAccumulatorStateReceiverRecorded rebuilds a commitment made on chain from its state syncs, and executes them
+// against the contract with that root.
+func TestAccumulatorStateReceiverRecorded(t *testing.T) {
+	raw, err := os.ReadFile(stateReceiverCommitmentPath)
+	require.NoError(t, err, "record it with TestRecordStateReceiverCommitment")
+	var rec stateReceiverCommitment
+	require.NoError(t, json.Unmarshal(raw, &rec))
+
+	tree := NewStateSyncTree(rec.EndID - rec.StartID + 1)
+	for _, s := range rec.Syncs {
+		leaf, err := StateSyncLeaf(s.ID, s.Sender, s.Receiver, s.Data)
+		require.NoError(t, err)
+		require.NoError(t, tree.Append(leaf))
+	}
+	require.Equal(t, [KeyLen]byte(rec.Root), tree.Root())
+
+	sr := newStateReceiverEVM(t)
+	sr.commit(0, rec.StartID, rec.EndID, rec.Root)
+	for i, s := range rec.Syncs {
+		_, path, err := tree.Proof(uint64(i))
+		require.NoError(t, err)
+		proof := make([][32]byte, len(path))
+		copy(proof, path)
+		obj := map[string]interface{}{"id": new(big.Int).SetUint64(s.ID), "sender": s.Sender, "receiver": s.Receiver, "data": []byte(s.Data)}
+		_, err = sr.call("execute", proof, obj)
+		require.NoError(t, err, "state sync %v", s.ID)
+	}
+}
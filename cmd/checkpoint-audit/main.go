@@ -0,0 +1,91 @@
+// checkpoint-audit recomputes the root hash of every checkpoint in a range from the Bor blocks, and writes a JSON
+// report of the ones that match Heimdall's root_hash and the ones that don't.
+//
+//	checkpoint-audit -heimdall http://localhost:26657 -rpc https://rpc-amoy.polygon.technology/ -from 2800 -to 2809
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	var (
+		from        = flag.Uint64("from", 0, "first checkpoint number")
+		to          = flag.Uint64("to", 0, "last checkpoint number")
+		heimdallURL = flag.String("heimdall", os.Getenv("HEIMDALL_RPC_URL"), "Heimdall Tendermint RPC url, defaults to $HEIMDALL_RPC_URL")
+		height      = flag.Int64("height", 0, "Heimdall height to query the checkpoints at, the latest if 0")
+		rpcURL      = flag.String("rpc", os.Getenv("BOR_RPC_URL"), "Bor JSON-RPC url, defaults to $BOR_RPC_URL")
+		ndjson      = flag.String("ndjson", "", "read the blocks from an ndjson file instead of JSON-RPC")
+		cacheDir    = flag.String("cache", "", "keep fetched blocks in this directory")
+		version     = flag.Uint("version", uint(heimdall.HeaderV1), "header leaf version")
+		rateLimit   = flag.Float64("rate", 0, "most JSON-RPC requests per second, unlimited if 0")
+		out         = flag.String("out", "", "write the report to this file instead of stdout")
+	)
+	flag.Parse()
+
+	mismatches, err := run(*from, *to, *heimdallURL, *height, *rpcURL, *ndjson, *cacheDir, heimdall.HeaderVersion(*version),
+		*rateLimit, *out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if mismatches {
+		os.Exit(2)
+	}
+}
+
+func run(from, to uint64, heimdallURL string, height int64, rpcURL, ndjson, cacheDir string, version heimdall.HeaderVersion,
+	rateLimit float64, out string) (mismatches bool, err error) {
+
+	if to < from {
+		return false, fmt.Errorf("invalid checkpoint range [%v, %v]", from, to)
+	}
+	if heimdallURL == "" {
+		return false, fmt.Errorf("-heimdall is needed")
+	}
+
+	var src heimdall.BlockSource
+	if src, err = heimdall.NewBlockSource(rpcURL, ndjson, cacheDir, 0, rateLimit); err != nil {
+		return
+	}
+
+	var client *heimdall.TendermintClient
+	if client, err = heimdall.NewTendermintClient(heimdallURL, ""); err != nil {
+		return
+	}
+	defer client.Stop()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	a := &heimdall.CheckpointAuditor{
+		Client:  client,
+		Source:  src,
+		Version: version,
+		Height:  height,
+		Progress: func(res *heimdall.CheckpointAuditResult) {
+			fmt.Fprintf(os.Stderr, "checkpoint %v: match %v %v\n", res.Number, res.Match, res.Error)
+		},
+	}
+	var report *heimdall.CheckpointAuditReport
+	if report, err = a.Audit(ctx, from, to); err != nil {
+		return
+	}
+
+	w := os.Stdout
+	if out != "" {
+		if w, err = os.Create(out); err != nil {
+			return
+		}
+		defer w.Close()
+	}
+	if err = report.Write(w); err != nil {
+		return
+	}
+	return report.Mismatches > 0 || report.Errors > 0, nil
+}
@@ -0,0 +1,68 @@
+// checkpoint-root computes the checkpoint root hash of a Bor block range, to compare with a Heimdall checkpoint's
+// or milestone's root_hash.
+//
+//	checkpoint-root -rpc https://rpc-amoy.polygon.technology/ -start 3639411 -end 3639922
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"github.com/umbracle/ethgo"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func main() {
+	var (
+		start       = flag.Uint64("start", 0, "first block of the range")
+		end         = flag.Uint64("end", 0, "last block of the range")
+		rpcURL      = flag.String("rpc", os.Getenv("BOR_RPC_URL"), "Bor JSON-RPC url, defaults to $BOR_RPC_URL")
+		ndjson      = flag.String("ndjson", "", "read the blocks from an ndjson file instead of JSON-RPC")
+		cacheDir    = flag.String("cache", "", "keep fetched blocks in this directory")
+		version     = flag.Uint("version", uint(heimdall.HeaderV1), "header leaf version")
+		concurrency = flag.Int("concurrency", 0, "JSON-RPC requests in flight, defaults to 8")
+		rateLimit   = flag.Float64("rate", 0, "most JSON-RPC requests per second, unlimited if 0")
+		expected    = flag.String("root", "", "root_hash to compare with - exits with 1 if it doesn't match")
+	)
+	flag.Parse()
+
+	if err := run(*start, *end, *rpcURL, *ndjson, *cacheDir, heimdall.HeaderVersion(*version), *concurrency, *rateLimit, *expected); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(start, end uint64, rpcURL, ndjson, cacheDir string, version heimdall.HeaderVersion, concurrency int,
+	rateLimit float64, expected string) (err error) {
+
+	if end < start || end == 0 {
+		return fmt.Errorf("invalid block range [%v, %v]", start, end)
+	}
+
+	var src heimdall.BlockSource
+	if src, err = heimdall.NewBlockSource(rpcURL, ndjson, cacheDir, concurrency, rateLimit); err != nil {
+		return
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var root ethgo.Hash
+	if root, err = heimdall.ComputeRootHash(ctx, src, start, end, version); err != nil {
+		return
+	}
+	fmt.Println(root)
+
+	if expected != "" {
+		if !strings.HasPrefix(expected, "0x") {
+			expected = "0x" + expected
+		}
+		if root != ethgo.HexToHash(expected) {
+			return fmt.Errorf("root hash of [%v, %v] doesn't match %v", start, end, expected)
+		}
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"github.com/umbracle/ethgo"
+	"os"
+)
+
+func (t *tool) checkpointGet(ctx context.Context, args []string) (err error) {
+	var hf heimdallFlags
+	fs := newFlagSet("checkpoint get", &hf, queryHeightUsage)
+	number := fs.Uint64("number", 0, "checkpoint number")
+	_ = fs.Parse(args)
+
+	client, stop, err := t.client(&hf)
+	if err != nil {
+		return
+	}
+	defer stop()
+	var cp *heimdall.Checkpoint
+	if cp, err = heimdall.GetCheckpoint(client, *number, *hf.height); err != nil {
+		return
+	}
+	return t.writeJSON(cp)
+}
+
+func (t *tool) checkpointVerifyRoot(ctx context.Context, args []string) (err error) {
+	var hf heimdallFlags
+	fs := newFlagSet("checkpoint verify-root", &hf, queryHeightUsage)
+	number := fs.Uint64("number", 0, "checkpoint number")
+	rpcURL := fs.String("rpc", os.Getenv("BOR_RPC_URL"), "Bor JSON-RPC url, defaults to $BOR_RPC_URL")
+	ndjson := fs.String("ndjson", "", "read the blocks from an ndjson file instead of JSON-RPC")
+	cacheDir := fs.String("cache", "", "keep fetched blocks in this directory")
+	version := fs.Uint("version", uint(heimdall.HeaderV1), "header leaf version")
+	rateLimit := fs.Float64("rate", 0, "most JSON-RPC requests per second, unlimited if 0")
+	_ = fs.Parse(args)
+
+	var src heimdall.BlockSource
+	if src, err = heimdall.NewBlockSource(*rpcURL, *ndjson, *cacheDir, 0, *rateLimit); err != nil {
+		return
+	}
+
+	client, stop, err := t.client(&hf)
+	if err != nil {
+		return
+	}
+	defer stop()
+	res := heimdall.CheckpointAuditResult{Number: *number}
+	if res.Checkpoint, err = heimdall.GetCheckpoint(client, *number, *hf.height); err != nil {
+		return
+	}
+	var root ethgo.Hash
+	if root, err = heimdall.ComputeRootHash(ctx, src, res.Checkpoint.StartBlock, res.Checkpoint.EndBlock,
+		heimdall.HeaderVersion(*version)); err != nil {
+		return
+	}
+	res.Computed, res.Match = &root, root == res.Checkpoint.RootHash
+	if err = t.writeJSON(&res); err != nil {
+		return
+	}
+	if !res.Match {
+		return fmt.Errorf("%w: checkpoint %v root_hash is %v, the blocks hash to %v", errFailed, *number,
+			res.Checkpoint.RootHash, root)
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/paulgoleary/evm-research/heimdall"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"strings"
+)
+
+type event struct {
+	Height           int64                     `json:"height"`
+	Type             string                    `json:"type"`
+	Attributes       map[string]string         `json:"attributes"`
+	Range            *heimdall.RangeEntry      `json:"range,omitempty"`
+	CheckpointNumber uint64                    `json:"checkpoint_number,omitempty"`
+	StateSync        *heimdall.StateSyncRecord `json:"state_sync,omitempty"`
+}
+
+func (t *tool) events(ctx context.Context, args []string) (err error) {
+	var hf heimdallFlags
+	fs := newFlagSet("events", &hf, "")
+	from := fs.Int64("from", 0, "first Heimdall height")
+	to := fs.Int64("to", 0, "last Heimdall height")
+	types := fs.String("types", "", "comma separated event types to list, all the ones that parse if empty")
+	_ = fs.Parse(args)
+	if *from <= 0 || *to < *from {
+		return fmt.Errorf("invalid height range [%v, %v]", *from, *to)
+	}
+	only := make(map[string]bool)
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			only[t] = true
+		}
+	}
+
+	client, stop, err := t.client(&hf)
+	if err != nil {
+		return
+	}
+	defer stop()
+
+	enc := json.NewEncoder(t.out)
+	for h := *from; h <= *to; h++ {
+		var evs []abci.Event
+		if evs, err = heimdall.GetBeginBlockEvents(ctx, client, h); err != nil {
+			return
+		}
+		for _, ev := range evs {
+			if len(only) > 0 && !only[ev.Type] {
+				continue
+			}
+			var he heimdall.HeimdallEvent
+			var ok bool
+			if he, ok, err = heimdall.ParseHeimdallEvent(ev, h); err != nil {
+				return
+			}
+			if !ok {
+				continue
+			}
+			out := event{
+				Height:           h,
+				Type:             ev.Type,
+				Attributes:       make(map[string]string, len(ev.Attributes)),
+				Range:            he.Range,
+				CheckpointNumber: he.CheckpointNumber,
+				StateSync:        he.StateSync,
+			}
+			for _, a := range ev.Attributes {
+				out.Attributes[string(a.Key)] = string(a.Value)
+			}
+			if err = enc.Encode(&out); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,142 @@
+// heimdall-tool queries and checks Heimdall checkpoints, milestones, votes and events, and writes the results as JSON.
+//
+//	heimdall-tool checkpoint get -number 2809
+//	heimdall-tool checkpoint verify-root -number 2809 -rpc https://rpc-amoy.polygon.technology/
+//	heimdall-tool milestone get -number 100
+//	heimdall-tool milestone verify-sigs -tx 0x2e65d38c...
+//	heimdall-tool votes -height 1495098 -verify
+//	heimdall-tool events -from 1588000 -to 1588610
+//
+// The Heimdall endpoints are given with -heimdall and -rest, and default to $HEIMDALL_RPC_URL and
+// $HEIMDALL_REST_URL. Verifications that fail exit with 2.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// errFailed is a check that ran and failed, as opposed to one that couldn't run.
+var errFailed = errors.New("verification failed")
+
+// tool is what the commands run with: dial connects to the Heimdall endpoints, and the results are written to out.
+type tool struct {
+	dial func(rpcURL, restURL string) (client heimdall.HeimdallClient, stop func(), err error)
+	out  io.Writer
+}
+
+func dialTendermint(rpcURL, restURL string) (client heimdall.HeimdallClient, stop func(), err error) {
+	var tc *heimdall.TendermintClient
+	if tc, err = heimdall.NewTendermintClient(rpcURL, restURL); err != nil {
+		return
+	}
+	return tc, func() { _ = tc.Stop() }, nil
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(t *tool, ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"checkpoint get", "query a checkpoint", (*tool).checkpointGet},
+	{"checkpoint verify-root", "recompute a checkpoint's root hash from the Bor blocks", (*tool).checkpointVerifyRoot},
+	{"milestone get", "query a milestone", (*tool).milestoneGet},
+	{"milestone verify-sigs", "check the validator signatures of a milestone tx", (*tool).milestoneVerifySigs},
+	{"votes", "get the precommits for a Heimdall block", (*tool).votes},
+	{"events", "list the begin-block events of a range of Heimdall heights, as ndjson", (*tool).events},
+}
+
+// findCommand is the command named by the first words of args, and the rest of args.
+func findCommand(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, args
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: heimdall-tool <command> [flags]")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-24v%v\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	cmd, args := findCommand(os.Args[1:])
+	if cmd == nil {
+		usage()
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := cmd.run(&tool{dial: dialTendermint, out: os.Stdout}, ctx, args)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errFailed) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// newFlagSet is the flag set of a command, with the Heimdall endpoint flags, and -height if heightUsage is set.
+func newFlagSet(name string, hf *heimdallFlags, heightUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	hf.rpcURL = fs.String("heimdall", os.Getenv("HEIMDALL_RPC_URL"), "Heimdall Tendermint RPC url, defaults to $HEIMDALL_RPC_URL")
+	hf.restURL = fs.String("rest", os.Getenv("HEIMDALL_REST_URL"), "Heimdall REST url, defaults to $HEIMDALL_REST_URL")
+	if heightUsage != "" {
+		hf.height = fs.Int64("height", 0, heightUsage)
+	}
+	return fs
+}
+
+const queryHeightUsage = "Heimdall height to query at, the latest if 0"
+
+type heimdallFlags struct {
+	rpcURL  *string
+	restURL *string
+	height  *int64
+}
+
+func (t *tool) client(hf *heimdallFlags) (client heimdall.HeimdallClient, stop func(), err error) {
+	if *hf.rpcURL == "" {
+		return nil, nil, fmt.Errorf("-heimdall is needed")
+	}
+	return t.dial(*hf.rpcURL, *hf.restURL)
+}
+
+// validatorSet is the validator set whose votes count at height, from the file at path if it is set.
+func validatorSet(client heimdall.HeimdallClient, path string, height int64) (vs *heimdall.ValidatorSet, err error) {
+	if path != "" {
+		var data []byte
+		if data, err = os.ReadFile(path); err != nil {
+			return
+		}
+		return heimdall.DecodeValidatorSet(data)
+	}
+	vt := heimdall.NewValidatorTracker(client)
+	if err = vt.Start(height); err != nil {
+		return
+	}
+	return vt.ValidatorSetAt(height)
+}
+
+func (t *tool) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(t.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/umbracle/ethgo"
+	"strings"
+	"testing"
+)
+
+const (
+	testHeimdallURL = "http://heimdall:26657"
+	testMilestoneTx = "0x2e65d38c422e31f220b05fbc24328a77d034c1a9a099c57ff90693ded8579614"
+)
+
+// newTestClient is the fixture client, with a milestone 1, a checkpoint 2810 that claims the blocks of 2809 with
+// another root, and a checkpoint ack at height 1001.
+func newTestClient(t *testing.T) *heimdall.MockHeimdallClient {
+	m, err := heimdall.NewFixtureHeimdallClient()
+	require.NoError(t, err)
+
+	value, _ := json.Marshal(&heimdall.Milestone{StartBlock: 3639411, EndBlock: 3639430, MilestoneID: "milestone-1"})
+	m.AddQuery(heimdall.QueryMilestoneByNumber, []byte(`{"number":1}`), value)
+
+	cp, err := heimdall.GetCheckpoint(m, 2809, 0)
+	require.NoError(t, err)
+	cp.ID, cp.RootHash = 0, ethgo.HexToHash("0x01")
+	value, _ = json.Marshal(cp)
+	m.AddQuery(heimdall.QueryCheckpoint, []byte(`{"number":2810}`), value)
+
+	height := int64(1001)
+	rb, err := m.Block(&height)
+	require.NoError(t, err)
+	m.AddBlock(rb.Block, []abci.Event{{Type: heimdall.EventTypeCheckpointAck, Attributes: []cmn.KVPair{
+		{Key: []byte("side-tx-result"), Value: []byte("Yes")},
+		{Key: []byte("header-index"), Value: []byte("2809")},
+	}}})
+	return m
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		args     string
+		contains []string
+		failed   bool
+		err      string
+	}{
+		{args: "checkpoint get -number 2809", contains: []string{`"root_hash": "0x80df8b6d4fa3731c4b4960522efba1602e23ee1ebff9ac5f237a540de04df4cc"`}},
+		{args: "checkpoint get -number 2811", err: "unknown query"},
+		{args: "checkpoint verify-root -number 2809 -ndjson ../../heimdall/data/checkpoint.ndjson", contains: []string{`"match": true`}},
+		{args: "checkpoint verify-root -number 2810 -ndjson ../../heimdall/data/checkpoint.ndjson", contains: []string{`"match": false`}, failed: true},
+		{args: "checkpoint verify-root -number 2809 -rpc=", err: "one of -rpc or -ndjson is needed"},
+		{args: "milestone get -number 1", contains: []string{`"milestone_id": "milestone-1"`}},
+		{args: "milestone verify-sigs -tx " + testMilestoneTx + " -validators ../../heimdall/data/validator-set1.json", contains: []string{`"quorum": true`}},
+		{args: "milestone verify-sigs -tx 0x01", err: "is not a tx hash"},
+		{args: "votes -height 1000 -verify -validators ../../heimdall/data/validator-set-1000.json", contains: []string{`"chain_id": "heimdall-80002"`, `"quorum": true`}},
+		{args: "votes", err: "-height is needed"},
+		{args: "events -from 1000 -to 1001 -types checkpoint-ack", contains: []string{`"height":1001`, `"checkpoint_number":2809`}},
+		{args: "events -from 1001 -to 1000", err: "invalid height range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			var out bytes.Buffer
+			dialed := false
+			tl := &tool{
+				dial: func(rpcURL, restURL string) (heimdall.HeimdallClient, func(), error) {
+					require.Equal(t, testHeimdallURL, rpcURL)
+					dialed = true
+					return newTestClient(t), func() {}, nil
+				},
+				out: &out,
+			}
+			cmd, args := findCommand(strings.Fields(tt.args))
+			require.NotNil(t, cmd)
+			err := cmd.run(tl, context.Background(), append(args, "-heimdall", testHeimdallURL))
+			switch {
+			case tt.err != "":
+				require.ErrorContains(t, err, tt.err)
+				return
+			case tt.failed:
+				require.ErrorIs(t, err, errFailed)
+			default:
+				require.NoError(t, err)
+			}
+			require.True(t, dialed)
+			for _, s := range tt.contains {
+				require.Contains(t, out.String(), s)
+			}
+		})
+	}
+
+	cmd, _ := findCommand([]string{"checkpoint", "get"})
+	err := cmd.run(&tool{}, context.Background(), []string{"-heimdall="})
+	require.ErrorContains(t, err, "-heimdall is needed")
+	cmd, _ = findCommand([]string{"checkpoint"})
+	require.Nil(t, cmd)
+}
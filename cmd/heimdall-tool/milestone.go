@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"strings"
+)
+
+func (t *tool) milestoneGet(ctx context.Context, args []string) (err error) {
+	var hf heimdallFlags
+	fs := newFlagSet("milestone get", &hf, queryHeightUsage)
+	number := fs.Uint64("number", 0, "milestone number")
+	_ = fs.Parse(args)
+
+	client, stop, err := t.client(&hf)
+	if err != nil {
+		return
+	}
+	defer stop()
+	var m *heimdall.Milestone
+	if m, err = heimdall.GetMilestone(client, *number, *hf.height); err != nil {
+		return
+	}
+	return t.writeJSON(m)
+}
+
+type milestoneSigs struct {
+	TxHash    string                    `json:"tx_hash"`
+	Height    uint64                    `json:"height"`
+	Milestone *heimdall.MsgMilestone    `json:"milestone"`
+	Report    *heimdall.SignatureReport `json:"report"`
+}
+
+func (t *tool) milestoneVerifySigs(ctx context.Context, args []string) (err error) {
+	var hf heimdallFlags
+	fs := newFlagSet("milestone verify-sigs", &hf, "")
+	txHash := fs.String("tx", "", "hash of the milestone tx")
+	validators := fs.String("validators", "", "validator set JSON file, instead of querying the set at the tx height")
+	_ = fs.Parse(args)
+
+	var hash []byte
+	if hash, err = hex.DecodeString(strings.TrimPrefix(*txHash, "0x")); err != nil || len(hash) != 32 {
+		return fmt.Errorf("-tx %q is not a tx hash", *txHash)
+	}
+	client, stop, err := t.client(&hf)
+	if err != nil {
+		return
+	}
+	defer stop()
+
+	var tx *heimdall.TxResponse
+	if tx, err = client.GetTx(*txHash); err != nil {
+		return
+	}
+	res := milestoneSigs{TxHash: *txHash, Height: tx.Height}
+	if res.Milestone, err = tx.MsgMilestone(); err != nil {
+		return
+	}
+	var stx *heimdall.SideTxResponse
+	if stx, err = client.GetSideTx(*txHash); err != nil {
+		return
+	}
+	var vs *heimdall.ValidatorSet
+	if vs, err = validatorSet(client, *validators, int64(tx.Height)); err != nil {
+		return
+	}
+	if res.Report, err = heimdall.VerifySideTxSigs(heimdall.NewSideTxYesVote(hash, stx.Data), stx.Sigs, vs); err != nil {
+		return
+	}
+	if err = t.writeJSON(&res); err != nil {
+		return
+	}
+	if !res.Report.Quorum {
+		return fmt.Errorf("%w: milestone %v signed by %v of %v voting power", errFailed, res.Milestone.MilestoneID,
+			res.Report.SignedPower, res.Report.TotalPower)
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/paulgoleary/evm-research/heimdall"
+	"github.com/umbracle/ethgo"
+	"time"
+)
+
+type sideTxResult struct {
+	TxHash hexutil.Bytes `json:"tx_hash"`
+	Result string        `json:"result"`
+	Sig    hexutil.Bytes `json:"sig,omitempty"`
+}
+
+type precommit struct {
+	Index     int           `json:"index"`
+	Validator ethgo.Address `json:"validator"`
+	// BlockID is empty for a nil precommit.
+	BlockID       string         `json:"block_id"`
+	Timestamp     time.Time      `json:"timestamp"`
+	Signature     hexutil.Bytes  `json:"signature"`
+	SideTxResults []sideTxResult `json:"side_tx_results,omitempty"`
+}
+
+type blockVotes struct {
+	Height     int64       `json:"height"`
+	ChainID    string      `json:"chain_id"`
+	Precommits []precommit `json:"precommits"`
+	// Report is set with -verify.
+	Report *heimdall.SignatureReport `json:"report,omitempty"`
+}
+
+func (t *tool) votes(ctx context.Context, args []string) (err error) {
+	var hf heimdallFlags
+	fs := newFlagSet("votes", &hf, "Heimdall height of the block")
+	verify := fs.Bool("verify", false, "check the precommits against the validator set at -height")
+	validators := fs.String("validators", "", "validator set JSON file, instead of querying the set at -height")
+	_ = fs.Parse(args)
+	if *hf.height <= 0 {
+		return fmt.Errorf("-height is needed")
+	}
+
+	client, stop, err := t.client(&hf)
+	if err != nil {
+		return
+	}
+	defer stop()
+
+	res := blockVotes{Height: *hf.height}
+	pcs, _, chainID, err := heimdall.FetchVotes(ctx, client, *hf.height)
+	if err != nil {
+		return
+	}
+	res.ChainID = chainID
+	for i, pc := range pcs {
+		if pc == nil {
+			continue
+		}
+		p := precommit{
+			Index:     i,
+			Validator: ethgo.BytesToAddress(pc.ValidatorAddress),
+			Timestamp: pc.Timestamp,
+			Signature: pc.Signature,
+		}
+		if !pc.BlockID.IsZero() {
+			p.BlockID = pc.BlockID.Hash.String()
+		}
+		for _, r := range pc.SideTxResults {
+			p.SideTxResults = append(p.SideTxResults, sideTxResult{
+				TxHash: r.TxHash,
+				Result: heimdall.SideTxResult(r.Result).String(),
+				Sig:    r.Sig,
+			})
+		}
+		res.Precommits = append(res.Precommits, p)
+	}
+
+	if *verify {
+		var vs *heimdall.ValidatorSet
+		if vs, err = validatorSet(client, *validators, *hf.height); err != nil {
+			return
+		}
+		if res.Report, _, err = heimdall.VerifyBlockCommit(ctx, client, *hf.height, vs); err != nil {
+			return
+		}
+	}
+	if err = t.writeJSON(&res); err != nil {
+		return
+	}
+	if res.Report != nil && !res.Report.Quorum {
+		return fmt.Errorf("%w: block %v committed by %v of %v voting power", errFailed, *hf.height,
+			res.Report.SignedPower, res.Report.TotalPower)
+	}
+	return
+}
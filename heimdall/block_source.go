@@ -0,0 +1,321 @@
+package heimdall
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/jsonrpc"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlockSource streams Bor blocks. Blocks calls fn with every block in [from, to], in order, and stops at the first
+// error.
+type BlockSource interface {
+	Blocks(ctx context.Context, from, to uint64, fn func(b *ethgo.Block) error) error
+}
+
+var ErrBlockOutOfOrder = errors.New("block out of order")
+
+func checkBlockNumber(b *ethgo.Block, num uint64) error {
+	if b == nil {
+		return fmt.Errorf("%w: no block %v", ErrBlockOutOfOrder, num)
+	}
+	if b.Number != num {
+		return fmt.Errorf("%w: got block %v, expected %v", ErrBlockOutOfOrder, b.Number, num)
+	}
+	return nil
+}
+
+// NdjsonBlockSource reads blocks from an ndjson file of eth_getBlockByNumber results in block order, like
+// data/checkpoint.ndjson.
+type NdjsonBlockSource struct {
+	Path string
+}
+
+func (s *NdjsonBlockSource) Blocks(ctx context.Context, from, to uint64, fn func(b *ethgo.Block) error) (err error) {
+	var f *os.File
+	if f, err = os.Open(s.Path); err != nil {
+		return
+	}
+	defer f.Close()
+	return readNdjsonBlocks(ctx, f, from, to, fn)
+}
+
+func readNdjsonBlocks(ctx context.Context, r io.Reader, from, to uint64, fn func(b *ethgo.Block) error) (err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	next := from
+	for next <= to && scanner.Scan() {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var b ethgo.Block
+		if err = json.Unmarshal(scanner.Bytes(), &b); err != nil {
+			return
+		}
+		if b.Number < from {
+			continue
+		}
+		if err = checkBlockNumber(&b, next); err != nil {
+			return
+		}
+		if err = fn(&b); err != nil {
+			return
+		}
+		next++
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if next <= to {
+		return fmt.Errorf("%w: blocks from %v are missing", ErrBlockOutOfOrder, next)
+	}
+	return
+}
+
+// BlockGetter is the subset of the eth JSON-RPC api needed to fetch blocks. *jsonrpc.Eth satisfies it.
+type BlockGetter interface {
+	GetBlockByNumber(i ethgo.BlockNumber, full bool) (*ethgo.Block, error)
+}
+
+var _ BlockGetter = &jsonrpc.Eth{}
+
+const (
+	defaultFetchConcurrency = 8
+	defaultFetchRetries     = 3
+	defaultFetchRetryDelay  = 500 * time.Millisecond
+)
+
+// RPCBlockSource fetches blocks over JSON-RPC, concurrently, and hands them on in order as they arrive.
+type RPCBlockSource struct {
+	Client BlockGetter
+	// Concurrency is the number of requests in flight. defaults to 8.
+	Concurrency int
+	// RateLimit is the most requests started per second, or unlimited if zero.
+	RateLimit float64
+	// Retries is how many times a failed request is retried, doubling RetryDelay each time. defaults to 3 and 500ms.
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// NewRPCBlockSource creates a source on the Bor JSON-RPC endpoint at url.
+func NewRPCBlockSource(url string) (s *RPCBlockSource, err error) {
+	var c *jsonrpc.Client
+	if c, err = jsonrpc.NewClient(url); err != nil {
+		return
+	}
+	return &RPCBlockSource{Client: c.Eth()}, nil
+}
+
+type fetchedBlock struct {
+	b   *ethgo.Block
+	err error
+}
+
+func (s *RPCBlockSource) Blocks(ctx context.Context, from, to uint64, fn func(b *ethgo.Block) error) error {
+	if to < from {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
+	}
+	var tick <-chan time.Time
+	if s.RateLimit > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / s.RateLimit))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	// one result channel per block, queued in block order, so the results can be taken in order. the queue bounds
+	// how far the fetches run ahead of fn.
+	queue := make(chan chan fetchedBlock, concurrency)
+	go func() {
+		defer close(queue)
+		sem := make(chan struct{}, concurrency)
+		for num := from; num <= to; num++ {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+			res := make(chan fetchedBlock, 1)
+			select {
+			case queue <- res:
+			case <-ctx.Done():
+				return
+			}
+			go func(num uint64) {
+				defer func() { <-sem }()
+				b, err := s.fetch(ctx, num)
+				res <- fetchedBlock{b, err}
+			}(num)
+		}
+	}()
+
+	next := from
+	for res := range queue {
+		fb := <-res
+		if fb.err != nil {
+			return fb.err
+		}
+		if err := fn(fb.b); err != nil {
+			return err
+		}
+		next++
+	}
+	if next <= to {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (s *RPCBlockSource) fetch(ctx context.Context, num uint64) (b *ethgo.Block, err error) {
+	retries, delay := s.Retries, s.RetryDelay
+	if retries <= 0 {
+		retries = defaultFetchRetries
+	}
+	if delay <= 0 {
+		delay = defaultFetchRetryDelay
+	}
+	for i := 0; ; i++ {
+		if b, err = s.Client.GetBlockByNumber(ethgo.BlockNumber(num), false); err == nil {
+			if err = checkBlockNumber(b, num); err == nil {
+				return
+			}
+		}
+		if i == retries {
+			return nil, fmt.Errorf("block %v: %w", num, err)
+		}
+		select {
+		case <-time.After(delay << i):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// CacheBlockSource keeps the blocks it gets from Source in Dir, one JSON file per block, and only asks Source for
+// the ones it doesn't have.
+type CacheBlockSource struct {
+	Source BlockSource
+	Dir    string
+}
+
+func (s *CacheBlockSource) path(num uint64) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%v.json", num))
+}
+
+func (s *CacheBlockSource) cached(num uint64) (b *ethgo.Block, err error) {
+	var data []byte
+	if data, err = os.ReadFile(s.path(num)); err != nil {
+		return
+	}
+	b = &ethgo.Block{}
+	if err = json.Unmarshal(data, b); err != nil {
+		return
+	}
+	err = checkBlockNumber(b, num)
+	return
+}
+
+func (s *CacheBlockSource) store(b *ethgo.Block) (err error) {
+	var data []byte
+	if data, err = json.Marshal(b); err != nil {
+		return
+	}
+	// written through a temp file so a partly written block is never read back
+	tmp := s.path(b.Number) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, s.path(b.Number))
+}
+
+func (s *CacheBlockSource) has(num uint64) bool {
+	_, err := os.Stat(s.path(num))
+	return err == nil
+}
+
+func (s *CacheBlockSource) Blocks(ctx context.Context, from, to uint64, fn func(b *ethgo.Block) error) (err error) {
+	if err = os.MkdirAll(s.Dir, 0755); err != nil {
+		return
+	}
+	for num := from; num <= to; {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if s.has(num) {
+			var b *ethgo.Block
+			if b, err = s.cached(num); err != nil {
+				return
+			}
+			if err = fn(b); err != nil {
+				return
+			}
+			num++
+			continue
+		}
+		// fetch the whole run of missing blocks at once
+		end := num
+		for end < to && !s.has(end+1) {
+			end++
+		}
+		expected := num
+		if err = s.Source.Blocks(ctx, num, end, func(b *ethgo.Block) (err error) {
+			if err = checkBlockNumber(b, expected); err != nil {
+				return
+			}
+			if err = s.store(b); err != nil {
+				return
+			}
+			expected++
+			return fn(b)
+		}); err != nil {
+			return
+		}
+		if expected <= end {
+			return fmt.Errorf("%w: blocks from %v are missing", ErrBlockOutOfOrder, expected)
+		}
+		num = end + 1
+	}
+	return
+}
+
+// NewBlockSource is the source the command line tools read blocks from: the ndjson file if it is set, else the
+// JSON-RPC endpoint with the given concurrency and rate limit, kept in cacheDir if that is set.
+func NewBlockSource(rpcURL, ndjson, cacheDir string, concurrency int, rateLimit float64) (src BlockSource, err error) {
+	switch {
+	case ndjson != "":
+		src = &NdjsonBlockSource{Path: ndjson}
+	case rpcURL != "":
+		var rpc *RPCBlockSource
+		if rpc, err = NewRPCBlockSource(rpcURL); err != nil {
+			return
+		}
+		rpc.Concurrency, rpc.RateLimit = concurrency, rateLimit
+		src = rpc
+	default:
+		return nil, fmt.Errorf("one of -rpc or -ndjson is needed")
+	}
+	if cacheDir != "" {
+		src = &CacheBlockSource{Source: src, Dir: cacheDir}
+	}
+	return
+}
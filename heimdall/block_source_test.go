@@ -0,0 +1,190 @@
+package heimdall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	checkpoint2809Start = 3639411
+	checkpoint2809End   = 3639922
+)
+
+func TestComputeRootHashPartial(t *testing.T) {
+	blocks, err := loadCheckpointBlocks()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "blocks.ndjson")
+	require.NoError(t, os.WriteFile(path, checkPointData, 0644))
+	src := &NdjsonBlockSource{Path: path}
+
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 9, 31, 33, 100, 257} {
+		for _, version := range []HeaderVersion{HeaderV1, HeaderV2} {
+			expected, err := getRootHash(func() ([]*ethgo.Block, error) { return blocks[:n], nil }, version)
+			require.NoError(t, err)
+			root, err := ComputeRootHash(context.Background(), src, checkpoint2809Start, checkpoint2809Start+uint64(n)-1, version)
+			require.NoError(t, err)
+			require.Equal(t, "0x"+expected, root.String(), "%v blocks, %v", n, version)
+		}
+	}
+}
+
+func TestNdjsonBlockSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.ndjson")
+	require.NoError(t, os.WriteFile(path, checkPointData, 0644))
+	src := &NdjsonBlockSource{Path: path}
+
+	root, err := ComputeRootHash(context.Background(), src, checkpoint2809Start, checkpoint2809End, HeaderV1)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint2809Root, root.String())
+
+	var nums []uint64
+	require.NoError(t, src.Blocks(context.Background(), 3639500, 3639502, func(b *ethgo.Block) error {
+		nums = append(nums, b.Number)
+		return nil
+	}))
+	require.Equal(t, []uint64{3639500, 3639501, 3639502}, nums)
+
+	_, err = ComputeRootHash(context.Background(), src, checkpoint2809Start, checkpoint2809End+1, HeaderV1)
+	require.ErrorIs(t, err, ErrBlockOutOfOrder)
+	_, err = ComputeRootHash(context.Background(), src, checkpoint2809Start-1, checkpoint2809End, HeaderV1)
+	require.ErrorIs(t, err, ErrBlockOutOfOrder)
+}
+
+// mockBlockGetter serves blocks from memory out of order, failing the first request for some of them.
+type mockBlockGetter struct {
+	blocks map[uint64]*ethgo.Block
+	failOn func(num uint64) bool
+
+	mtx      sync.Mutex
+	requests map[uint64]int
+	inFlight int
+	maxIn    int
+}
+
+func newMockBlockGetter(t *testing.T) *mockBlockGetter {
+	blocks, err := loadCheckpointBlocks()
+	require.NoError(t, err)
+	m := &mockBlockGetter{blocks: make(map[uint64]*ethgo.Block), requests: make(map[uint64]int)}
+	for _, b := range blocks {
+		m.blocks[b.Number] = b
+	}
+	return m
+}
+
+func (m *mockBlockGetter) GetBlockByNumber(i ethgo.BlockNumber, full bool) (*ethgo.Block, error) {
+	num := uint64(i)
+	m.mtx.Lock()
+	m.requests[num]++
+	attempt := m.requests[num]
+	m.inFlight++
+	m.maxIn = max(m.maxIn, m.inFlight)
+	m.mtx.Unlock()
+	defer func() {
+		m.mtx.Lock()
+		m.inFlight--
+		m.mtx.Unlock()
+	}()
+
+	time.Sleep(time.Duration(num%5) * 100 * time.Microsecond)
+	if m.failOn != nil && m.failOn(num) && attempt == 1 {
+		return nil, errors.New("429 too many requests")
+	}
+	b, ok := m.blocks[num]
+	if !ok {
+		return nil, fmt.Errorf("no block %v", num)
+	}
+	return b, nil
+}
+
+func TestRPCBlockSource(t *testing.T) {
+	m := newMockBlockGetter(t)
+	m.failOn = func(num uint64) bool { return num%7 == 0 }
+	src := &RPCBlockSource{Client: m, Concurrency: 4, RetryDelay: time.Millisecond}
+
+	root, err := ComputeRootHash(context.Background(), src, checkpoint2809Start, checkpoint2809End, HeaderV1)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint2809Root, root.String())
+	require.LessOrEqual(t, m.maxIn, 4)
+	require.Equal(t, 2, m.requests[3639412])
+	require.Equal(t, 1, m.requests[3639413])
+
+	// retries run out
+	src.Retries = 2
+	_, err = ComputeRootHash(context.Background(), src, checkpoint2809End-10, checkpoint2809End+1, HeaderV1)
+	require.ErrorContains(t, err, "no block 3639923")
+	require.Equal(t, 3, m.requests[checkpoint2809End+1])
+
+	// fn failing stops the fetch
+	stop := errors.New("stop")
+	err = src.Blocks(context.Background(), checkpoint2809Start, checkpoint2809End, func(b *ethgo.Block) error {
+		if b.Number == checkpoint2809Start+10 {
+			return stop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, stop)
+
+	rateLimited := &RPCBlockSource{Client: m, RateLimit: 1000}
+	start := time.Now()
+	_, err = ComputeRootHash(context.Background(), rateLimited, checkpoint2809Start, checkpoint2809Start+49, HeaderV1)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 45*time.Millisecond)
+}
+
+// countingSource records the ranges it was asked for.
+type countingSource struct {
+	BlockSource
+	ranges [][2]uint64
+}
+
+func (s *countingSource) Blocks(ctx context.Context, from, to uint64, fn func(b *ethgo.Block) error) error {
+	s.ranges = append(s.ranges, [2]uint64{from, to})
+	return s.BlockSource.Blocks(ctx, from, to, fn)
+}
+
+func TestCacheBlockSource(t *testing.T) {
+	m := newMockBlockGetter(t)
+	counting := &countingSource{BlockSource: &RPCBlockSource{Client: m}}
+	src := &CacheBlockSource{Source: counting, Dir: t.TempDir()}
+
+	root, err := ComputeRootHash(context.Background(), src, checkpoint2809Start, checkpoint2809End, HeaderV1)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint2809Root, root.String())
+	require.Equal(t, [][2]uint64{{checkpoint2809Start, checkpoint2809End}}, counting.ranges)
+
+	counting.ranges = nil
+	require.NoError(t, os.Remove(src.path(3639500)))
+	require.NoError(t, os.Remove(src.path(3639501)))
+	require.NoError(t, os.Remove(src.path(checkpoint2809End)))
+	root, err = ComputeRootHash(context.Background(), src, checkpoint2809Start, checkpoint2809End, HeaderV1)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint2809Root, root.String())
+	require.Equal(t, [][2]uint64{{3639500, 3639501}, {checkpoint2809End, checkpoint2809End}}, counting.ranges)
+}
+
+func TestNewBlockSource(t *testing.T) {
+	_, err := NewBlockSource("", "", "", 0, 0)
+	require.Error(t, err)
+
+	src, err := NewBlockSource("http://localhost:8545", "blocks.ndjson", "", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, &NdjsonBlockSource{Path: "blocks.ndjson"}, src)
+
+	src, err = NewBlockSource("http://localhost:8545", "", "cache", 4, 10)
+	require.NoError(t, err)
+	cache, ok := src.(*CacheBlockSource)
+	require.True(t, ok)
+	require.Equal(t, "cache", cache.Dir)
+	rpc, ok := cache.Source.(*RPCBlockSource)
+	require.True(t, ok)
+	require.Equal(t, 4, rpc.Concurrency)
+	require.Equal(t, 10.0, rpc.RateLimit)
+}
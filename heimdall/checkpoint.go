@@ -1,11 +1,12 @@
 package heimdall
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/paulgoleary/evm-research"
 	"github.com/umbracle/ethgo"
-	"github.com/xsleonard/go-merkle"
-	"golang.org/x/crypto/sha3"
-	"math/big"
 )
 
 // checkpoint root hash logic is cribbed from (bor)/consensus/bor/api.go GetRootHash
@@ -39,12 +40,8 @@ func appendBytes32(data ...[]byte) []byte {
 //		blockHeader.ReceiptHash.Bytes(),
 
 func calcHeaderHash(b *ethgo.Block) []byte {
-	return ethgo.Keccak256(appendBytes32(
-		new(big.Int).SetUint64(b.Number).Bytes(), // blockHeader.Number.Bytes(),
-		new(big.Int).SetUint64(b.Timestamp).Bytes(),
-		b.TransactionsRoot.Bytes(), // blockHeader.TxHash.Bytes(),
-		b.ReceiptsRoot.Bytes(),
-	))
+	leaf, _ := HeaderV1.Leaf(b)
+	return leaf[:]
 }
 
 func nextPowerOfTwo(n uint64) uint64 {
@@ -64,29 +61,91 @@ func nextPowerOfTwo(n uint64) uint64 {
 	return n
 }
 
-func calcCheckpointFromBlocks(b []*ethgo.Block) [][]byte {
-	headers := make([][]byte, nextPowerOfTwo(uint64(len(b))))
-	for i := range b {
-		headers[i] = calcHeaderHash(b[i])
+// headerLeaves are the checkpoint tree leaves of blocks, a contiguous block range.
+func headerLeaves(blocks []*ethgo.Block, version HeaderVersion) (leaves [][32]byte, err error) {
+	if len(blocks) == 0 {
+		return nil, errors.New("empty block range")
 	}
-	return headers
+	leaves = make([][32]byte, len(blocks))
+	for i, b := range blocks {
+		if b.Number != blocks[0].Number+uint64(i) {
+			return nil, fmt.Errorf("block range is not contiguous: block %v at position %v", b.Number, i)
+		}
+		if leaves[i], err = version.Leaf(b); err != nil {
+			return
+		}
+	}
+	return
 }
 
-func getRootHash(getBlockRange func() ([]*ethgo.Block, error)) (root string, err error) {
-
+func getRootHash(getBlockRange func() ([]*ethgo.Block, error), version HeaderVersion) (root string, err error) {
 	var blocks []*ethgo.Block
 	if blocks, err = getBlockRange(); err != nil {
 		return
 	}
-
-	headers := calcCheckpointFromBlocks(blocks)
-
-	tree := merkle.NewTreeWithOpts(merkle.TreeOptions{EnableHashSorting: false, DisableHashLeaves: true})
-	if err = tree.Generate(headers, sha3.NewLegacyKeccak256()); err != nil {
+	var leaves [][32]byte
+	if leaves, err = headerLeaves(blocks, version); err != nil {
 		return
 	}
+	var tree *evm_research.Accumulator
+	if tree, err = checkpointTree(leaves); err != nil {
+		return
+	}
+	hash := checkpointRoot(tree)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// newCheckpointTree is the smallest keccak accumulator that holds numBlocks leaves. its empty leaves are zero, as
+// Bor's GetRootHash pads the leaves with zero hashes to the next power of two.
+func newCheckpointTree(numBlocks uint64) *evm_research.Accumulator {
+	height := uint8(1)
+	for height < 64 && uint64(1)<<height < numBlocks {
+		height++
+	}
+	return evm_research.NewAccumulator(height, evm_research.KeccakNodeHasher)
+}
 
-	root = hex.EncodeToString(tree.Root().Hash)
+// checkpointTree is the checkpoint tree with all of a range's leaves appended.
+func checkpointTree(leaves [][32]byte) (tree *evm_research.Accumulator, err error) {
+	tree = newCheckpointTree(uint64(len(leaves)))
+	for _, leaf := range leaves {
+		if err = tree.Append(leaf); err != nil {
+			return
+		}
+	}
 	return
+}
+
+// checkpointRoot is the root of a checkpoint tree holding its whole range. the root of a single block is its leaf,
+// as Bor's go-merkle tree has no level above it.
+func checkpointRoot(tree *evm_research.Accumulator) ethgo.Hash {
+	if tree.Count() == 1 {
+		leaf, _, _ := tree.Proof(0)
+		return leaf
+	}
+	return tree.Root()
+}
 
+// ComputeRootHash streams the blocks in [start, end] from src into a checkpoint tree.
+func ComputeRootHash(ctx context.Context, src BlockSource, start, end uint64, version HeaderVersion) (root ethgo.Hash, err error) {
+	if end < start {
+		return root, fmt.Errorf("empty block range [%v, %v]", start, end)
+	}
+	tree := newCheckpointTree(end - start + 1)
+	if err = src.Blocks(ctx, start, end, func(b *ethgo.Block) (err error) {
+		if err = checkBlockNumber(b, start+tree.Count()); err != nil {
+			return
+		}
+		var leaf [32]byte
+		if leaf, err = version.Leaf(b); err != nil {
+			return
+		}
+		return tree.Append(leaf)
+	}); err != nil {
+		return
+	}
+	if tree.Count() != end-start+1 {
+		return root, fmt.Errorf("%w: got %v blocks of [%v, %v]", ErrBlockOutOfOrder, tree.Count(), start, end)
+	}
+	return checkpointRoot(tree), nil
 }
@@ -0,0 +1,123 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"io"
+)
+
+const QueryCheckpoint = "custom/checkpoint/checkpoint"
+
+// GetCheckpoint queries checkpoint number at a Heimdall height, or the latest height if it is zero.
+func GetCheckpoint(client HeimdallClient, number uint64, height int64) (cp *Checkpoint, err error) {
+	var value []byte
+	if value, err = queryAt(client, QueryCheckpoint, []byte(fmt.Sprintf(`{"number":%v}`, number)), height); err != nil {
+		return
+	}
+	if cp, err = DecodeCheckpointQuery(value); err != nil {
+		return
+	}
+	cp.ID = number
+	return
+}
+
+// CheckpointAuditResult is the audit of one checkpoint. Error is set, and Match false, if the checkpoint or its
+// blocks couldn't be fetched.
+type CheckpointAuditResult struct {
+	Number     uint64      `json:"number"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	Computed   *ethgo.Hash `json:"computed_root_hash,omitempty"`
+	Match      bool        `json:"match"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// CheckpointAuditReport is the result of auditing checkpoints From to To.
+type CheckpointAuditReport struct {
+	From       uint64                  `json:"from"`
+	To         uint64                  `json:"to"`
+	Matches    int                     `json:"matches"`
+	Mismatches int                     `json:"mismatches"`
+	Errors     int                     `json:"errors"`
+	Results    []CheckpointAuditResult `json:"results"`
+}
+
+// Write writes the report as indented JSON.
+func (r *CheckpointAuditReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// CheckpointAuditor recomputes the root hash of checkpoints from the Bor blocks in Source and compares it with the
+// root_hash Heimdall recorded.
+type CheckpointAuditor struct {
+	Client  HeimdallClient
+	Source  BlockSource
+	Version HeaderVersion
+	// Height is the Heimdall height the checkpoints are queried at, or the latest if zero.
+	Height int64
+	// Progress, if set, is called after each checkpoint is audited.
+	Progress func(res *CheckpointAuditResult)
+}
+
+// Audit audits checkpoints from to to. A checkpoint that can't be audited is reported as an error and the audit goes
+// on - only ctx being done stops it early.
+func (a *CheckpointAuditor) Audit(ctx context.Context, from, to uint64) (report *CheckpointAuditReport, err error) {
+	report = &CheckpointAuditReport{From: from, To: to}
+	for number := from; number <= to; number++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		res := a.auditCheckpoint(ctx, number)
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		switch {
+		case res.Error != "":
+			report.Errors++
+		case res.Match:
+			report.Matches++
+		default:
+			report.Mismatches++
+		}
+		report.Results = append(report.Results, res)
+		if a.Progress != nil {
+			a.Progress(&res)
+		}
+	}
+	return
+}
+
+func (a *CheckpointAuditor) auditCheckpoint(ctx context.Context, number uint64) (res CheckpointAuditResult) {
+	res.Number = number
+	var err error
+	if res.Checkpoint, err = GetCheckpoint(a.Client, number, a.Height); err != nil {
+		res.Error = fmt.Sprintf("checkpoint %v: %v", number, err)
+		return
+	}
+	cp := res.Checkpoint
+	if cp.EndBlock < cp.StartBlock {
+		res.Error = fmt.Sprintf("checkpoint %v: invalid block range [%v, %v]", number, cp.StartBlock, cp.EndBlock)
+		return
+	}
+
+	var blocks []*ethgo.Block
+	if err = a.Source.Blocks(ctx, cp.StartBlock, cp.EndBlock, func(b *ethgo.Block) error {
+		blocks = append(blocks, b)
+		return nil
+	}); err != nil {
+		res.Error = fmt.Sprintf("blocks [%v, %v]: %v", cp.StartBlock, cp.EndBlock, err)
+		return
+	}
+	var root string
+	if root, err = getRootHash(func() ([]*ethgo.Block, error) { return blocks, nil }, a.Version); err != nil {
+		res.Error = fmt.Sprintf("root hash: %v", err)
+		return
+	}
+	computed := ethgo.HexToHash(root)
+	res.Computed = &computed
+	res.Match = computed == cp.RootHash
+	return
+}
@@ -0,0 +1,61 @@
+package heimdall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"testing"
+)
+
+func TestCheckpointAudit(t *testing.T) {
+	m, err := NewFixtureHeimdallClient()
+	require.NoError(t, err)
+	cp, err := GetCheckpoint(m, 2809, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2809), cp.ID)
+
+	// 2810 claims the blocks of 2809 with another root, and 2811 is past the recorded blocks
+	wrong := *cp
+	wrong.ID, wrong.RootHash = 0, ethgo.HexToHash("0x01")
+	value, _ := json.Marshal(&wrong)
+	m.AddQuery(QueryCheckpoint, []byte(`{"number":2810}`), value)
+	next := *cp
+	next.ID, next.StartBlock, next.EndBlock = 0, cp.EndBlock+1, cp.EndBlock+256
+	value, _ = json.Marshal(&next)
+	m.AddQuery(QueryCheckpoint, []byte(`{"number":2811}`), value)
+
+	var audited []uint64
+	a := &CheckpointAuditor{
+		Client:   m,
+		Source:   testBlockSource(t),
+		Progress: func(res *CheckpointAuditResult) { audited = append(audited, res.Number) },
+	}
+	report, err := a.Audit(context.Background(), 2808, 2811)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2808, 2809, 2810, 2811}, audited)
+	require.Equal(t, 1, report.Matches)
+	require.Equal(t, 1, report.Mismatches)
+	require.Equal(t, 2, report.Errors)
+
+	require.NotEmpty(t, report.Results[0].Error)
+	require.Nil(t, report.Results[0].Checkpoint)
+	require.True(t, report.Results[1].Match)
+	require.Equal(t, checkpoint2809Root, report.Results[1].Computed.String())
+	require.False(t, report.Results[2].Match)
+	require.Equal(t, checkpoint2809Root, report.Results[2].Computed.String())
+	require.Empty(t, report.Results[2].Error)
+	require.Contains(t, report.Results[3].Error, "missing")
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	var decoded CheckpointAuditReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, report, &decoded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = a.Audit(ctx, 2809, 2809)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,131 @@
+package heimdall
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"github.com/umbracle/ethgo/wallet"
+	"math/big"
+	"sort"
+)
+
+// ErrNotCheckpointData is returned for side-tx data of another layout. A milestone has the same first four words -
+// proposer, start, end and the hash of the end block - followed by the chain id and a zero word, so read as a
+// checkpoint its chain id is zero.
+var ErrNotCheckpointData = errors.New("side-tx data is not a checkpoint")
+
+// SubmitCheckpointMethod is RootChain.submitCheckpoint.
+var SubmitCheckpointMethod = abi.MustNewMethod("function submitCheckpoint(bytes data, uint256[3][] sigs)")
+
+var checkpointDataType = abi.MustNewType("tuple(address proposer, uint256 start, uint256 end, bytes32 rootHash, bytes32 accountHash, uint256 borChainID)")
+
+// CheckpointData is the side-tx data of a checkpoint, which is also the data submitted to the RootChain.
+type CheckpointData struct {
+	Proposer    ethgo.Address `abi:"proposer"`
+	Start       *big.Int      `abi:"start"`
+	End         *big.Int      `abi:"end"`
+	RootHash    ethgo.Hash    `abi:"rootHash"`
+	AccountHash ethgo.Hash    `abi:"accountHash"`
+	BorChainID  *big.Int      `abi:"borChainID"`
+}
+
+func DecodeCheckpointData(data []byte) (cd *CheckpointData, err error) {
+	cd = &CheckpointData{}
+	if err = checkpointDataType.DecodeStruct(data, cd); err != nil {
+		return
+	}
+	if cd.BorChainID == nil || cd.BorChainID.Sign() == 0 {
+		return nil, ErrNotCheckpointData
+	}
+	return
+}
+
+func (cd *CheckpointData) Encode() ([]byte, error) {
+	return checkpointDataType.Encode(cd)
+}
+
+// VoteHash is the hash the validators sign and the RootChain checks signatures against: the side-tx sign bytes,
+// which are the 'yes' side-tx result byte followed by the data.
+func VoteHash(data []byte) ethgo.Hash {
+	return NewSideTxYesVote(nil, data).SignHash()
+}
+
+// CheckpointSubmission is a submitCheckpoint call. Sigs are sorted by signer, since the StakeManager requires
+// strictly ascending signers.
+type CheckpointSubmission struct {
+	Data     []byte
+	VoteHash ethgo.Hash
+	Sigs     []SideTxSig
+	Signers  []ethgo.Address
+}
+
+// NewCheckpointSubmission recovers the signer of each side-tx signature and orders the signatures for submission.
+func NewCheckpointSubmission(data []byte, sigs []SideTxSig) (sub *CheckpointSubmission, err error) {
+	sub = &CheckpointSubmission{Data: data, VoteHash: VoteHash(data)}
+	signBytes := NewSideTxYesVote(nil, data).SignBytes()
+	signers := make([]ethgo.Address, len(sigs))
+	for i := range sigs {
+		if signers[i], err = wallet.EcrecoverMsg(signBytes, sigs[i].Bytes()); err != nil {
+			return nil, fmt.Errorf("sig %v: %w", i, err)
+		}
+	}
+	order := make([]int, len(sigs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(signers[order[i]][:], signers[order[j]][:]) < 0 })
+	for n, i := range order {
+		if n > 0 && signers[i] == sub.Signers[n-1] {
+			return nil, fmt.Errorf("sig %v: %w %v", i, ErrDuplicateSigner, signers[i])
+		}
+		sub.Sigs = append(sub.Sigs, sigs[i])
+		sub.Signers = append(sub.Signers, signers[i])
+	}
+	return
+}
+
+// NewCheckpointSubmissionFromTx builds the submission for a checkpoint tx from its side-tx.
+func NewCheckpointSubmissionFromTx(client HeimdallClient, txHash string) (sub *CheckpointSubmission, err error) {
+	var stx *SideTxResponse
+	if stx, err = client.GetSideTx(txHash); err != nil {
+		return
+	}
+	return NewCheckpointSubmission(stx.Data, stx.Sigs)
+}
+
+// SigsArg is the sigs argument of submitCheckpoint: [r, s, v] for each signature.
+func (sub *CheckpointSubmission) SigsArg() [][3]*big.Int {
+	arg := make([][3]*big.Int, len(sub.Sigs))
+	for i, sig := range sub.Sigs {
+		v := new(big.Int).Set(sig.V)
+		if v.Cmp(big.NewInt(27)) < 0 {
+			v.Add(v, big.NewInt(27))
+		}
+		arg[i] = [3]*big.Int{sig.R, sig.S, v}
+	}
+	return arg
+}
+
+// Calldata is the submitCheckpoint calldata.
+func (sub *CheckpointSubmission) Calldata() ([]byte, error) {
+	return SubmitCheckpointMethod.Encode([]interface{}{sub.Data, sub.SigsArg()})
+}
+
+// DecodeSubmitCheckpoint decodes submitCheckpoint calldata back to the data and the signatures.
+func DecodeSubmitCheckpoint(calldata []byte) (data []byte, sigs []SideTxSig, err error) {
+	if len(calldata) < 4 || !bytes.Equal(calldata[:4], SubmitCheckpointMethod.ID()) {
+		return nil, nil, fmt.Errorf("not a submitCheckpoint call")
+	}
+	var decoded interface{}
+	if decoded, err = abi.Decode(SubmitCheckpointMethod.Inputs, calldata[4:]); err != nil {
+		return
+	}
+	args := decoded.(map[string]interface{})
+	data = args["data"].([]byte)
+	for _, rsv := range args["sigs"].([][3]*big.Int) {
+		sigs = append(sigs, SideTxSig{R: rsv[0], S: rsv[1], V: rsv[2]})
+	}
+	return
+}
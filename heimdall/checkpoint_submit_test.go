@@ -0,0 +1,189 @@
+package heimdall
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/wallet"
+	"math/big"
+	"testing"
+)
+
+func TestCheckpointSubmissionMilestone(t *testing.T) {
+	res, sigs := loadSideTx1(t)
+	sub, err := NewCheckpointSubmission(res.Data, sigs)
+	require.NoError(t, err)
+	require.Equal(t, res.SignHash(), sub.VoteHash)
+	require.Len(t, sub.Signers, 7)
+	for i := 1; i < len(sub.Signers); i++ {
+		require.Equal(t, -1, bytes.Compare(sub.Signers[i-1][:], sub.Signers[i][:]))
+	}
+
+	calldata, err := sub.Calldata()
+	require.NoError(t, err)
+	// selector, two offsets, 192 bytes of data and 7 [r, s, v]
+	require.Equal(t, 4+2*32+32+192+32+7*96, len(calldata))
+	require.Equal(t, SubmitCheckpointMethod.ID(), calldata[:4])
+	require.Equal(t, big.NewInt(0x40), new(big.Int).SetBytes(calldata[4:36]))
+	require.Equal(t, big.NewInt(0x40+32+192), new(big.Int).SetBytes(calldata[36:68]))
+	require.Equal(t, res.Data, calldata[100:292])
+
+	data, decSigs, err := DecodeSubmitCheckpoint(calldata)
+	require.NoError(t, err)
+	require.Equal(t, res.Data, data)
+	for i := range decSigs {
+		require.Equal(t, sub.Sigs[i].Bytes(), decSigs[i].Bytes())
+		require.GreaterOrEqual(t, decSigs[i].V.Uint64(), uint64(27))
+	}
+
+	vs, err := DecodeValidatorSet(validatorSetData)
+	require.NoError(t, err)
+	report, err := VerifySideTxSigs(res, sigs, vs)
+	require.NoError(t, err)
+	v := newRootChainVerifier(t, vs)
+	voteHash, power, err := v.Check(calldata)
+	require.NoError(t, err)
+	require.Equal(t, sub.VoteHash, voteHash)
+	require.Equal(t, report.SignedPower, power)
+	require.Equal(t, int64(75000), power)
+
+	// heimdall already has them in signer order
+	for i := range sigs {
+		require.Equal(t, sigs[i].Bytes(), sub.Sigs[i].Bytes())
+	}
+
+	// counting stops at the first signer below the last one: here only the highest signer counts
+	reversed := make([]SideTxSig, len(sigs))
+	for i := range sigs {
+		reversed[len(sigs)-1-i] = sigs[i]
+	}
+	calldata, err = (&CheckpointSubmission{Data: res.Data, Sigs: reversed}).Calldata()
+	require.NoError(t, err)
+	_, _, err = v.Check(calldata)
+	require.ErrorIs(t, err, ErrNoQuorum)
+
+	// so a lowest signer moved to the end is not counted, but the ones before it still make a quorum
+	lowestLast := append(append([]SideTxSig{}, sub.Sigs[1:]...), sub.Sigs[0])
+	report, err = VerifySideTxSigs(res, sub.Sigs[1:], vs)
+	require.NoError(t, err)
+	require.True(t, report.Quorum)
+	calldata, err = (&CheckpointSubmission{Data: res.Data, Sigs: lowestLast}).Calldata()
+	require.NoError(t, err)
+	_, power, err = v.Check(calldata)
+	require.NoError(t, err)
+	require.Equal(t, report.SignedPower, power)
+	require.Less(t, power, int64(75000))
+
+	// and a repeated signer is skipped
+	calldata, err = (&CheckpointSubmission{Data: res.Data, Sigs: append(sub.Sigs[:7:7], sub.Sigs[6])}).Calldata()
+	require.NoError(t, err)
+	_, power, err = v.Check(calldata)
+	require.NoError(t, err)
+	require.Equal(t, int64(75000), power)
+
+	// without the largest signer: 60000 of 95000
+	var withoutLargest []SideTxSig
+	for i, signer := range sub.Signers {
+		if val, _ := vs.BySigner(signer); val.VotingPower != 15000 {
+			withoutLargest = append(withoutLargest, sub.Sigs[i])
+		}
+	}
+	calldata, err = (&CheckpointSubmission{Data: res.Data, Sigs: withoutLargest}).Calldata()
+	require.NoError(t, err)
+	_, _, err = v.Check(calldata)
+	require.ErrorIs(t, err, ErrNoQuorum)
+
+	_, _, err = v.Check(calldata[4:])
+	require.Error(t, err)
+}
+
+func TestCheckpointSubmission(t *testing.T) {
+	cp, _, err := DecodeCheckpointResponse(checkpoint2809Data)
+	require.NoError(t, err)
+	chainID, _ := new(big.Int).SetString(cp.BorChainID, 10)
+	cd := &CheckpointData{
+		Proposer:   ethgo.Address(cp.Proposer),
+		Start:      new(big.Int).SetUint64(cp.StartBlock),
+		End:        new(big.Int).SetUint64(cp.EndBlock),
+		RootHash:   cp.RootHash,
+		BorChainID: chainID,
+	}
+	data, err := cd.Encode()
+	require.NoError(t, err)
+	decoded, err := DecodeCheckpointData(data)
+	require.NoError(t, err)
+	require.Equal(t, cd, decoded)
+
+	keys, vs := testSigners(t, 4)
+	sigs := signSideTx(t, keys, data)
+
+	m := NewMockHeimdallClient()
+	m.AddSideTx("0xaa", &SideTxResponse{Data: data, Sigs: sigs})
+	sub, err := NewCheckpointSubmissionFromTx(m, "aa")
+	require.NoError(t, err)
+	calldata, err := sub.Calldata()
+	require.NoError(t, err)
+
+	report, err := VerifySideTxSigs(NewSideTxYesVote(nil, data), sigs, vs)
+	require.NoError(t, err)
+	v := newRootChainVerifier(t, vs)
+	voteHash, power, err := v.Check(calldata)
+	require.NoError(t, err)
+	require.Equal(t, VoteHash(data), voteHash)
+	require.Equal(t, report.SignedPower, power)
+	require.Equal(t, int64(400), power)
+
+	// 2 of 4 is not a quorum, 3 of 4 is
+	sub, err = NewCheckpointSubmission(data, sigs[:2])
+	require.NoError(t, err)
+	calldata, _ = sub.Calldata()
+	_, _, err = v.Check(calldata)
+	require.ErrorIs(t, err, ErrNoQuorum)
+	sub, err = NewCheckpointSubmission(data, sigs[:3])
+	require.NoError(t, err)
+	calldata, _ = sub.Calldata()
+	_, power, err = v.Check(calldata)
+	require.NoError(t, err)
+	require.Equal(t, int64(300), power)
+
+	// signatures over other data count for nothing
+	cd.End.Add(cd.End, big.NewInt(1))
+	otherData, err := cd.Encode()
+	require.NoError(t, err)
+	calldata, err = (&CheckpointSubmission{Data: otherData, Sigs: sub.Sigs}).Calldata()
+	require.NoError(t, err)
+	_, _, err = v.Check(calldata)
+	require.Error(t, err)
+
+	_, err = NewCheckpointSubmission(data, []SideTxSig{sigs[0], sigs[1], sigs[0]})
+	require.ErrorIs(t, err, ErrDuplicateSigner)
+}
+
+// testSigners is a validator set of n validators with 100 voting power each, and their keys.
+func testSigners(t *testing.T, n int) (keys []*wallet.Key, vs *ValidatorSet) {
+	var vals []Validator
+	for i := 0; i < n; i++ {
+		key, err := wallet.NewWalletFromPrivKey(ethgo.Keccak256([]byte(fmt.Sprintf("checkpoint-signer-%v", i))))
+		require.NoError(t, err)
+		keys = append(keys, key)
+		vals = append(vals, Validator{ID: uint64(i + 1), Signer: key.Address(), VotingPower: 100})
+	}
+	vs, err := NewValidatorSet(vals)
+	require.NoError(t, err)
+	return
+}
+
+// signSideTx signs side-tx data the way heimdall validators vote Yes on it.
+func signSideTx(t *testing.T, keys []*wallet.Key, data []byte) (sigs []SideTxSig) {
+	for _, key := range keys {
+		sig, err := key.SignMsg(append([]byte{1}, data...))
+		require.NoError(t, err)
+		sigs = append(sigs, SideTxSig{
+			R: new(big.Int).SetBytes(sig[:32]),
+			S: new(big.Int).SetBytes(sig[32:64]),
+			V: big.NewInt(int64(sig[64]) + 27),
+		})
+	}
+	return
+}
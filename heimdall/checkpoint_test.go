@@ -3,12 +3,12 @@ package heimdall
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/stretchr/testify/require"
-	httpClient "github.com/tendermint/tendermint/rpc/client"
 	"github.com/umbracle/ethgo"
 	"github.com/xsleonard/go-merkle"
 	"golang.org/x/crypto/sha3"
@@ -20,13 +20,11 @@ const HeimdallTestRpc = "http://149.28.197.92:26657"
 const HeimdallAmoyRpc = "https://heimdall-api-amoy.polygon.technology/"
 
 func TestCheckpointBasics(t *testing.T) {
-	c := httpClient.NewHTTP(HeimdallTestRpc, "/websocket")
-
-	err := c.Start()
+	c, err := NewTendermintClient(HeimdallTestRpc, "")
 	require.NoError(t, err)
 
 	// votes []*tmTypes.CommitSig, sigs []byte, chainID string, err error
-	votes, sigs, chainId, err := FetchVotes(c, 1495098)
+	votes, sigs, chainId, err := FetchVotes(context.Background(), c, 1495098)
 	require.NoError(t, err)
 	_ = votes
 	_ = sigs
@@ -40,19 +38,15 @@ func TestCheckpointBasics(t *testing.T) {
 	require.NoError(t, err)
 }
 
-// TODO: we need an efficient way to find milestones / checkpoint event by block range. this can scan block by block ...
 func TestGetEvents(t *testing.T) {
-	c := httpClient.NewHTTP(HeimdallTestRpc, "/websocket")
-	err := c.Start()
+	c, err := NewTendermintClient(HeimdallTestRpc, "")
 	require.NoError(t, err)
 
-	for i := int64(1588000); i < 1588611; i++ {
-		events, err := GetBeginBlockEvents(c, i)
-		require.NoError(t, err)
-		if len(events) > 0 {
-			println(events[0].String())
-		}
-	}
+	x := NewRangeIndexer(c)
+	require.NoError(t, x.IngestRange(context.Background(), 1588000, 1588610))
+	m, err := x.FindMilestone(3887762)
+	require.NoError(t, err)
+	require.Equal(t, milestoneTxHash, m.TxHash)
 }
 
 // testing with this Amoy testnet checkpoint
@@ -69,28 +63,28 @@ func TestGetEvents(t *testing.T) {
 //   }
 // }
 
-func TestCalcCheckpoint(t *testing.T) {
-
-	getBlockRange := func() (blocks []*ethgo.Block, err error) {
-		r := bytes.NewReader(checkPointData)
-		scanner := bufio.NewScanner(r)
-		for {
-			if !scanner.Scan() {
-				break
-			}
-			var b ethgo.Block
-			if err = json.Unmarshal(scanner.Bytes(), &b); err != nil {
-				return
-			}
-			blocks = append(blocks, &b)
+// loadCheckpointBlocks reads the blocks of Amoy checkpoint 2809 from the embedded test data.
+func loadCheckpointBlocks() (blocks []*ethgo.Block, err error) {
+	r := bytes.NewReader(checkPointData)
+	scanner := bufio.NewScanner(r)
+	for {
+		if !scanner.Scan() {
+			break
 		}
-		if len(blocks) != 512 || blocks[0].Number != 3639411 || blocks[len(blocks)-1].Number != 3639922 {
-			err = fmt.Errorf("should not happen - invalid or unexpected test data")
+		var b ethgo.Block
+		if err = json.Unmarshal(scanner.Bytes(), &b); err != nil {
+			return
 		}
-		return
+		blocks = append(blocks, &b)
+	}
+	if len(blocks) != 512 || blocks[0].Number != 3639411 || blocks[len(blocks)-1].Number != 3639922 {
+		err = fmt.Errorf("should not happen - invalid or unexpected test data")
 	}
+	return
+}
 
-	rootHash, err := getRootHash(getBlockRange)
+func TestCalcCheckpoint(t *testing.T) {
+	rootHash, err := getRootHash(loadCheckpointBlocks, HeaderV1)
 	require.NoError(t, err)
 	require.Equal(t, "80df8b6d4fa3731c4b4960522efba1602e23ee1ebff9ac5f237a540de04df4cc", rootHash)
 }
@@ -0,0 +1,90 @@
+package heimdall
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	httpClient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HeimdallClient is what the heimdall queries need from a node: Tendermint RPC for blocks, events and ABCI queries,
+// plus the REST server for txs and their side-tx data.
+type HeimdallClient interface {
+	Block(height *int64) (*ctypes.ResultBlock, error)
+	BlockResults(height *int64) (*ctypes.ResultBlockResults, error)
+	ABCIQuery(path string, data cmn.HexBytes) (*ctypes.ResultABCIQuery, error)
+	// ABCIQueryWithOptions can query the state at a past height, which only archive nodes keep.
+	ABCIQueryWithOptions(path string, data cmn.HexBytes, opts httpClient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error)
+	Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (<-chan ctypes.ResultEvent, error)
+	Unsubscribe(ctx context.Context, subscriber, query string) error
+
+	// GetTx fetches /txs/{hash} from the REST server.
+	GetTx(hash string) (*TxResponse, error)
+	// GetSideTx fetches /txs/{hash}/side-tx from the REST server.
+	GetSideTx(hash string) (*SideTxResponse, error)
+}
+
+// TendermintClient is a HeimdallClient on a Tendermint RPC endpoint and a Heimdall REST server.
+type TendermintClient struct {
+	*httpClient.HTTP
+	RESTURL    string
+	RESTClient *http.Client
+}
+
+var _ HeimdallClient = &TendermintClient{}
+
+// NewTendermintClient creates and starts a client. restURL may be empty if the REST fetches are not needed.
+func NewTendermintClient(rpcURL, restURL string) (tc *TendermintClient, err error) {
+	tc = &TendermintClient{
+		HTTP:       httpClient.NewHTTP(rpcURL, "/websocket"),
+		RESTURL:    strings.TrimSuffix(restURL, "/"),
+		RESTClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	// the websocket is only needed to subscribe, but has to be started first
+	if err = tc.Start(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (tc *TendermintClient) getREST(path string) (data []byte, err error) {
+	if tc.RESTURL == "" {
+		return nil, errors.New("no REST url configured")
+	}
+	var resp *http.Response
+	if resp, err = tc.RESTClient.Get(tc.RESTURL + path); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if data, err = io.ReadAll(resp.Body); err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %v: %v: %s", path, resp.Status, data)
+	}
+	return
+}
+
+func (tc *TendermintClient) GetTx(hash string) (tx *TxResponse, err error) {
+	var data []byte
+	if data, err = tc.getREST(fmt.Sprintf("/txs/%v", hash)); err != nil {
+		return
+	}
+	tx, _, err = DecodeTxResponse(data)
+	return
+}
+
+func (tc *TendermintClient) GetSideTx(hash string) (stx *SideTxResponse, err error) {
+	var data []byte
+	if data, err = tc.getREST(fmt.Sprintf("/txs/%v/side-tx", hash)); err != nil {
+		return
+	}
+	stx, _, err = DecodeSideTxResponse(data)
+	return
+}
@@ -0,0 +1,280 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	httpClient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"github.com/tendermint/tendermint/state"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"strings"
+	"sync"
+)
+
+// MockHeimdallClient is an in-memory HeimdallClient. Blocks added with AddBlock are published to subscribers, so
+// code waiting on a future block can be driven from a test.
+type MockHeimdallClient struct {
+	mtx          sync.Mutex
+	blocks       map[int64]*tmTypes.Block
+	beginEvents  map[int64][]abci.Event
+	deliverTxs   map[int64][]*abci.ResponseDeliverTx
+	queries      map[string][]byte
+	txs          map[string]*TxResponse
+	sideTxs      map[string]*SideTxResponse
+	subs         map[subscription]chan ctypes.ResultEvent
+	SubscribeErr error
+}
+
+var _ HeimdallClient = &MockHeimdallClient{}
+
+func NewMockHeimdallClient() *MockHeimdallClient {
+	return &MockHeimdallClient{
+		blocks:      make(map[int64]*tmTypes.Block),
+		beginEvents: make(map[int64][]abci.Event),
+		deliverTxs:  make(map[int64][]*abci.ResponseDeliverTx),
+		queries:     make(map[string][]byte),
+		txs:         make(map[string]*TxResponse),
+		sideTxs:     make(map[string]*SideTxResponse),
+		subs:        make(map[subscription]chan ctypes.ResultEvent),
+	}
+}
+
+// NewFixtureHeimdallClient is a mock preloaded with the embedded data: the Amoy milestone tx and its side-tx,
+// checkpoint 2809 as the latest acked checkpoint, and test chain blocks 1000 and 1001.
+func NewFixtureHeimdallClient() (m *MockHeimdallClient, err error) {
+	m = NewMockHeimdallClient()
+	for _, data := range [][]byte{block1000Data, block1001Data} {
+		var rb *ctypes.ResultBlock
+		if rb, err = DecodeResultBlock(data); err != nil {
+			return
+		}
+		m.AddBlock(rb.Block, nil)
+	}
+	var tx *TxResponse
+	if tx, _, err = DecodeTxResponse(milestoneData); err != nil {
+		return
+	}
+	m.AddTx(tx)
+	var stx *SideTxResponse
+	if stx, _, err = DecodeSideTxResponse(sideTxData); err != nil {
+		return
+	}
+	m.AddSideTx(tx.TxHash, stx)
+
+	var cp *Checkpoint
+	if cp, _, err = DecodeCheckpointResponse(checkpoint2809Data); err != nil {
+		return
+	}
+	m.AddQuery(QueryAckCount, nil, []byte(fmt.Sprint(cp.ID)))
+	id := cp.ID
+	cp.ID = 0 // the query value doesn't carry the id
+	value, _ := json.Marshal(cp)
+	m.AddQuery(QueryCheckpoint, []byte(fmt.Sprintf(`{"number":%v}`, id)), value)
+	return
+}
+
+type subscription struct {
+	subscriber, query string
+}
+
+func queryKey(path string, data []byte) string {
+	return path + "?" + hex.EncodeToString(data)
+}
+
+func txKey(hash string) string {
+	return strings.ToLower(strings.TrimPrefix(hash, "0x"))
+}
+
+// AddBlock stores a block and the events of its begin blocker, and sends it to subscribers as a new block event.
+func (m *MockHeimdallClient) AddBlock(b *tmTypes.Block, beginBlockEvents []abci.Event) {
+	m.AddBlockResults(b, beginBlockEvents, nil)
+}
+
+// AddBlockResults is AddBlock for a block with txs, with one DeliverTx result per tx in b, or empty results if
+// deliverTxs is nil. Like tendermint, it sends the new block event first, then a tx event for each tx.
+func (m *MockHeimdallClient) AddBlockResults(b *tmTypes.Block, beginBlockEvents []abci.Event, deliverTxs []abci.ResponseDeliverTx) {
+	if deliverTxs == nil {
+		deliverTxs = make([]abci.ResponseDeliverTx, len(b.Txs))
+	}
+	if len(deliverTxs) != len(b.Txs) {
+		panic(fmt.Sprintf("block %v has %v txs, got %v DeliverTx results", b.Height, len(b.Txs), len(deliverTxs)))
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.blocks[b.Height] = b
+	m.beginEvents[b.Height] = beginBlockEvents
+	m.deliverTxs[b.Height] = nil
+	for i := range deliverTxs {
+		m.deliverTxs[b.Height] = append(m.deliverTxs[b.Height], &deliverTxs[i])
+	}
+	m.publishLocked(tmTypes.EventDataNewBlock{Block: b, ResultBeginBlock: abci.ResponseBeginBlock{Events: beginBlockEvents}},
+		tmTypes.EventNewBlock)
+	for i := range b.Txs {
+		m.publishLocked(tmTypes.EventDataTx{TxResult: tmTypes.TxResult{Height: b.Height, Index: uint32(i), Tx: b.Txs[i],
+			Result: deliverTxs[i]}}, tmTypes.EventTx)
+	}
+}
+
+// Publish sends arbitrary event data to subscribers.
+func (m *MockHeimdallClient) Publish(data tmTypes.TMEventData) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.publishLocked(data, "")
+}
+
+// publishLocked sends data to the subscribers of eventType, or to all of them if it is empty.
+func (m *MockHeimdallClient) publishLocked(data tmTypes.TMEventData, eventType string) {
+	for key, ch := range m.subs {
+		if eventType != "" && key.query != tmTypes.QueryForEvent(eventType).String() {
+			continue
+		}
+		select {
+		case ch <- ctypes.ResultEvent{Query: key.query, Data: data}:
+		default:
+			// like the websocket client, a slow subscriber misses events
+		}
+	}
+}
+
+func (m *MockHeimdallClient) AddQuery(path string, data []byte, value []byte) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.queries[queryKey(path, data)] = value
+}
+
+func (m *MockHeimdallClient) AddTx(tx *TxResponse) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.txs[txKey(tx.TxHash)] = tx
+}
+
+func (m *MockHeimdallClient) AddSideTx(hash string, stx *SideTxResponse) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.sideTxs[txKey(hash)] = stx
+}
+
+func (m *MockHeimdallClient) Block(height *int64) (*ctypes.ResultBlock, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	b, ok := m.blocks[*height]
+	if !ok {
+		return nil, fmt.Errorf("height %v must be less than or equal to the current blockchain height", *height)
+	}
+	return &ctypes.ResultBlock{BlockMeta: tmTypes.NewBlockMeta(b, b.MakePartSet(tmTypes.BlockPartSizeBytes)), Block: b}, nil
+}
+
+func (m *MockHeimdallClient) BlockResults(height *int64) (*ctypes.ResultBlockResults, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.blocks[*height]; !ok {
+		return nil, fmt.Errorf("could not find results for height #%v", *height)
+	}
+	return &ctypes.ResultBlockResults{
+		Height: *height,
+		Results: &state.ABCIResponses{
+			DeliverTx:  m.deliverTxs[*height],
+			BeginBlock: &abci.ResponseBeginBlock{Events: m.beginEvents[*height]},
+		},
+	}, nil
+}
+
+// AddQueryAt sets the value of a query at one height. Queries at heights without a value of their own get the one
+// set with AddQuery.
+func (m *MockHeimdallClient) AddQueryAt(height int64, path string, data []byte, value []byte) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.queries[fmt.Sprintf("%v@%v", queryKey(path, data), height)] = value
+}
+
+func (m *MockHeimdallClient) ABCIQuery(path string, data cmn.HexBytes) (*ctypes.ResultABCIQuery, error) {
+	return m.ABCIQueryWithOptions(path, data, httpClient.DefaultABCIQueryOptions)
+}
+
+func (m *MockHeimdallClient) ABCIQueryWithOptions(path string, data cmn.HexBytes, opts httpClient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	value, ok := m.queries[fmt.Sprintf("%v@%v", queryKey(path, data), opts.Height)]
+	if !ok {
+		value, ok = m.queries[queryKey(path, data)]
+	}
+	if !ok {
+		return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{Code: 1, Log: fmt.Sprintf("unknown query %v", path)}}, nil
+	}
+	return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{Value: value}}, nil
+}
+
+func (m *MockHeimdallClient) Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (<-chan ctypes.ResultEvent, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.SubscribeErr != nil {
+		return nil, m.SubscribeErr
+	}
+	outCap := 1
+	if len(outCapacity) > 0 {
+		outCap = outCapacity[0]
+	}
+	ch := make(chan ctypes.ResultEvent, outCap)
+	m.subs[subscription{subscriber, query}] = ch
+	return ch, nil
+}
+
+func (m *MockHeimdallClient) Unsubscribe(ctx context.Context, subscriber, query string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	key := subscription{subscriber, query}
+	if _, ok := m.subs[key]; !ok {
+		return errors.New("subscription not found")
+	}
+	delete(m.subs, key)
+	return nil
+}
+
+// Disconnect closes every subscription, like a dropped websocket. Until Reconnect, subscribing fails with err.
+func (m *MockHeimdallClient) Disconnect(err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for key, ch := range m.subs {
+		close(ch)
+		delete(m.subs, key)
+	}
+	m.SubscribeErr = err
+}
+
+func (m *MockHeimdallClient) Reconnect() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.SubscribeErr = nil
+}
+
+// Subscribers is the number of open subscriptions.
+func (m *MockHeimdallClient) Subscribers() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return len(m.subs)
+}
+
+func (m *MockHeimdallClient) GetTx(hash string) (*TxResponse, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	tx, ok := m.txs[txKey(hash)]
+	if !ok {
+		return nil, fmt.Errorf("tx %v not found", hash)
+	}
+	return tx, nil
+}
+
+func (m *MockHeimdallClient) GetSideTx(hash string) (*SideTxResponse, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	stx, ok := m.sideTxs[txKey(hash)]
+	if !ok {
+		return nil, fmt.Errorf("side-tx %v not found", hash)
+	}
+	return stx, nil
+}
@@ -0,0 +1,255 @@
+package heimdall
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	logger "github.com/tendermint/tendermint/libs/log"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testBlock(height int64, precommits ...*tmTypes.CommitSig) *tmTypes.Block {
+	return &tmTypes.Block{
+		Header:     tmTypes.Header{ChainID: "heimdall-80002", Height: height},
+		LastCommit: tmTypes.NewCommit(tmTypes.BlockID{}, precommits),
+	}
+}
+
+func testEvents(typ string) []abci.Event {
+	return []abci.Event{{Type: typ, Attributes: []cmn.KVPair{{Key: []byte("module"), Value: []byte("checkpoint")}}}}
+}
+
+func precommit(addr byte, sig ...byte) *tmTypes.CommitSig {
+	return &tmTypes.CommitSig{ValidatorAddress: bytes.Repeat([]byte{addr}, 20), Signature: sig}
+}
+
+// waitSubscribed waits until a query is blocked on the next block.
+func waitSubscribed(t *testing.T, m *MockHeimdallClient) {
+	require.Eventually(t, func() bool { return m.Subscribers() > 0 }, time.Second, time.Millisecond)
+}
+
+func TestMockGetBlock(t *testing.T) {
+	m := NewMockHeimdallClient()
+	m.AddBlock(testBlock(10), testEvents("checkpoint"))
+
+	b, err := GetBlockWithClient(context.Background(), m, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), b.Height)
+
+	events, err := GetBeginBlockEvents(context.Background(), m, 10)
+	require.NoError(t, err)
+	require.Equal(t, testEvents("checkpoint"), events)
+
+	// a future block is waited for
+	done := make(chan *tmTypes.Block)
+	go func() {
+		b, err := GetBlockWithClient(context.Background(), m, 12)
+		require.NoError(t, err)
+		done <- b
+	}()
+	waitSubscribed(t, m)
+	m.AddBlock(testBlock(11), nil)
+	m.AddBlock(testBlock(12), nil)
+	require.Equal(t, int64(12), (<-done).Height)
+	require.Equal(t, 0, m.Subscribers())
+
+	eventsCh := make(chan []abci.Event)
+	go func() {
+		events, err := GetBeginBlockEvents(context.Background(), m, 13)
+		require.NoError(t, err)
+		eventsCh <- events
+	}()
+	waitSubscribed(t, m)
+	m.AddBlock(testBlock(13), testEvents("milestone"))
+	require.Equal(t, testEvents("milestone"), <-eventsCh)
+	require.Equal(t, 0, m.Subscribers())
+}
+
+func TestMockBlockTxs(t *testing.T) {
+	m := NewMockHeimdallClient()
+	b, results := testTxBlock(10, testEvents("milestone-timeout"), nil)
+
+	// without results, every tx gets an empty one
+	m.AddBlock(b, nil)
+	height := int64(10)
+	res, err := m.BlockResults(&height)
+	require.NoError(t, err)
+	require.Len(t, res.Results.DeliverTx, 2)
+	require.Empty(t, res.Results.DeliverTx[0].Events)
+
+	m.AddBlockResults(b, nil, results)
+	res, err = m.BlockResults(&height)
+	require.NoError(t, err)
+	require.Equal(t, testEvents("milestone-timeout"), res.Results.DeliverTx[0].Events)
+
+	require.PanicsWithValue(t, "block 10 has 2 txs, got 1 DeliverTx results", func() {
+		m.AddBlockResults(b, nil, results[:1])
+	})
+}
+
+// errorLogger records the messages logged at error level.
+type errorLogger struct {
+	logger.Logger
+	mtx    sync.Mutex
+	errors []string
+}
+
+func (l *errorLogger) Error(msg string, keyvals ...interface{}) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func TestMockGetBlockErrors(t *testing.T) {
+	m := NewMockHeimdallClient()
+	m.SubscribeErr = errors.New("websocket closed")
+	_, err := GetBlockWithClient(context.Background(), m, 1)
+	require.ErrorIs(t, err, ErrSubscription)
+	require.ErrorContains(t, err, "failed to subscribe: websocket closed")
+	_, err = GetBeginBlockEvents(context.Background(), m, 1)
+	require.ErrorIs(t, err, ErrSubscription)
+	m.SubscribeErr = nil
+
+	// wait runs a query for height 1 in the background, and once it is subscribed does something to end it
+	wait := func(ctx context.Context, query func(context.Context, HeimdallClient, int64) error, then func()) error {
+		errCh := make(chan error)
+		go func() { errCh <- query(ctx, m, 1) }()
+		waitSubscribed(t, m)
+		then()
+		err := <-errCh
+		require.Equal(t, 0, m.Subscribers())
+		return err
+	}
+	getBlock := func(ctx context.Context, c HeimdallClient, h int64) error {
+		_, err := GetBlockWithClient(ctx, c, h)
+		return err
+	}
+	getEvents := func(ctx context.Context, c HeimdallClient, h int64) error {
+		_, err := GetBeginBlockEvents(ctx, c, h)
+		return err
+	}
+
+	for _, query := range []func(context.Context, HeimdallClient, int64) error{getBlock, getEvents} {
+		// any other event ends the wait
+		err = wait(context.Background(), query, func() { m.Publish(tmTypes.EventDataTx{}) })
+		require.ErrorIs(t, err, ErrUnexpectedEvent)
+
+		// a later block without the one waited for
+		err = wait(context.Background(), query, func() { m.Publish(tmTypes.EventDataNewBlock{Block: testBlock(2)}) })
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// the caller's deadline
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err = wait(ctx, query, func() {})
+		cancel()
+		require.ErrorIs(t, err, ErrTimeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// and cancellation
+		ctx, cancel = context.WithCancel(context.Background())
+		err = wait(ctx, query, cancel)
+		require.ErrorIs(t, err, context.Canceled)
+		require.NotErrorIs(t, err, ErrTimeout)
+
+		// the subscription closing is logged when unsubscribing, with the logger from the context or the default
+		l := &errorLogger{Logger: logger.NewNopLogger()}
+		err = wait(WithLogger(context.Background(), l), query, func() { m.Disconnect(nil) })
+		require.ErrorIs(t, err, ErrSubscription)
+		require.Equal(t, []string{"waitForBlock | Unsubscribe"}, l.errors)
+
+		defaultLogger := Logger
+		Logger = nil
+		err = wait(context.Background(), query, func() { m.Disconnect(nil) })
+		Logger = defaultLogger
+		require.ErrorIs(t, err, ErrSubscription)
+	}
+}
+
+func TestMockFetchVotes(t *testing.T) {
+	m := NewMockHeimdallClient()
+	precommits := []*tmTypes.CommitSig{precommit(3, 0x33), nil, precommit(1, 0x11, 0x11), precommit(2, 0x22)}
+	m.AddBlock(testBlock(101, precommits...), nil)
+
+	// votes for a block are in the commit of the next one
+	votes, sigs, chainID, err := FetchVotes(context.Background(), m, 100)
+	require.NoError(t, err)
+	require.Equal(t, precommits, votes)
+	require.Equal(t, []byte{0x11, 0x11, 0x22, 0x33}, sigs)
+	require.Equal(t, "heimdall-80002", chainID)
+}
+
+func TestFixtureHeimdallClient(t *testing.T) {
+	m, err := NewFixtureHeimdallClient()
+	require.NoError(t, err)
+
+	tx, err := m.GetTx("0x2e65d38c422e31f220b05fbc24328a77d034c1a9a099c57ff90693ded8579614")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1588003), tx.Height)
+	msg, err := tx.MsgMilestone()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3887762), msg.EndBlock)
+
+	// the fetched side-tx is signed by a quorum
+	stx, err := m.GetSideTx(tx.TxHash)
+	require.NoError(t, err)
+	txHash, _ := hex.DecodeString(tx.TxHash)
+	res := NewSideTxYesVote(txHash, stx.Data)
+	vs, err := DecodeValidatorSet(validatorSetData)
+	require.NoError(t, err)
+	report, err := VerifySideTxSigs(res, stx.Sigs, vs)
+	require.NoError(t, err)
+	require.True(t, report.Quorum)
+
+	_, err = m.GetTx("00")
+	require.Error(t, err)
+
+	qr, err := m.ABCIQuery("custom/checkpoint/ack-count", nil)
+	require.NoError(t, err)
+	ackCount, err := DecodeAckCountQuery(qr.Response.Value)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2809), ackCount)
+
+	qr, err = m.ABCIQuery("custom/checkpoint/checkpoint", []byte(`{"number":2809}`))
+	require.NoError(t, err)
+	cp, err := DecodeCheckpointQuery(qr.Response.Value)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint2809Root, cp.RootHash.String())
+
+	qr, err = m.ABCIQuery("custom/checkpoint/checkpoint", []byte(`{"number":1}`))
+	require.NoError(t, err)
+	require.False(t, qr.Response.IsOK())
+}
+
+func TestTendermintClientREST(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/txs/" + milestoneTxHash:
+			_, _ = w.Write(milestoneData)
+		case "/txs/" + milestoneTxHash + "/side-tx":
+			_, _ = w.Write(sideTxData)
+		default:
+			http.Error(w, `{"error":"tx not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tc := &TendermintClient{RESTURL: srv.URL, RESTClient: srv.Client()}
+	tx, err := tc.GetTx(milestoneTxHash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1588003), tx.Height)
+	stx, err := tc.GetSideTx(milestoneTxHash)
+	require.NoError(t, err)
+	require.Len(t, stx.Sigs, 7)
+
+	_, err = tc.GetTx("00")
+	require.ErrorContains(t, err, "404")
+}
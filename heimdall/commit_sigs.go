@@ -0,0 +1,85 @@
+package heimdall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/wallet"
+)
+
+var ErrInvalidPrecommit = errors.New("invalid precommit")
+
+// PrecommitSigner recovers the validator that signed a commit's precommit at idx. Heimdall validators sign the
+// keccak hash of the amino encoded canonical vote with their eth key, so the recovered address is the signer address
+// and has to match the precommit's validator address.
+func PrecommitSigner(chainID string, commit *tmTypes.Commit, idx int) (signer ethgo.Address, err error) {
+	pc := commit.Precommits[idx]
+	if len(pc.Signature) != 65 {
+		return signer, fmt.Errorf("%w %v: signature has %v bytes", ErrInvalidPrecommit, idx, len(pc.Signature))
+	}
+	if signer, err = wallet.EcrecoverMsg(commit.VoteSignBytes(chainID, idx), pc.Signature); err != nil {
+		return signer, fmt.Errorf("%w %v: %v", ErrInvalidPrecommit, idx, err)
+	}
+	if !bytes.Equal(signer[:], pc.ValidatorAddress) {
+		return signer, fmt.Errorf("%w %v: signed by %v, not validator %v", ErrInvalidPrecommit, idx, signer, pc.ValidatorAddress)
+	}
+	return
+}
+
+// VerifyCommit checks every precommit of commit, for the block at height, against the validator set at that height.
+// Like Tendermint's own commit verification, precommits for a nil or different block id are valid but do not count
+// towards the signed power.
+func VerifyCommit(chainID string, height int64, commit *tmTypes.Commit, vs *ValidatorSet) (report *SignatureReport, err error) {
+	if commit.Height() != height {
+		return nil, fmt.Errorf("commit is for height %v, not %v", commit.Height(), height)
+	}
+	report = &SignatureReport{TotalPower: vs.TotalVotingPower()}
+	seen := make(map[ethgo.Address]bool, len(commit.Precommits))
+	for idx, pc := range commit.Precommits {
+		if pc == nil {
+			continue
+		}
+		if pc.Type != tmTypes.PrecommitType || pc.Height != height || pc.Round != commit.Round() {
+			return nil, fmt.Errorf("%w %v: %v vote at %v/%v", ErrInvalidPrecommit, idx, pc.Type, pc.Height, pc.Round)
+		}
+		var signer ethgo.Address
+		if signer, err = PrecommitSigner(chainID, commit, idx); err != nil {
+			return nil, err
+		}
+		if seen[signer] {
+			return nil, fmt.Errorf("precommit %v: %w %v", idx, ErrDuplicateSigner, signer)
+		}
+		seen[signer] = true
+		v, ok := vs.BySigner(signer)
+		if !ok {
+			return nil, fmt.Errorf("precommit %v: %w: %v", idx, ErrUnknownSigner, signer)
+		}
+		if pc.BlockID.Equals(commit.BlockID) {
+			report.Signers = append(report.Signers, v)
+			report.SignedPower += v.VotingPower
+		}
+	}
+	report.Quorum = vs.HasQuorum(report.SignedPower)
+	return
+}
+
+// VerifyBlockCommit fetches the block at height and the commit for it, which is the last commit of the next block,
+// checks that the commit is for that block, and verifies its precommits against vs.
+func VerifyBlockCommit(ctx context.Context, client HeimdallClient, height int64, vs *ValidatorSet) (report *SignatureReport, block *tmTypes.Block, err error) {
+	if block, err = GetBlockWithClient(ctx, client, height); err != nil {
+		return
+	}
+	var next *tmTypes.Block
+	if next, err = GetBlockWithClient(ctx, client, height+1); err != nil {
+		return
+	}
+	commit := next.LastCommit
+	if !bytes.Equal(block.Hash(), commit.BlockID.Hash) {
+		return nil, nil, fmt.Errorf("commit at %v is for block %v, not %v", height+1, commit.BlockID.Hash, block.Hash())
+	}
+	report, err = VerifyCommit(block.ChainID, height, commit, vs)
+	return
+}
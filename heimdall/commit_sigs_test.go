@@ -0,0 +1,188 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"github.com/umbracle/ethgo"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+var recordCommit = flag.Bool("record-commit", false, fmt.Sprintf("record Heimdall blocks %v and %v and the validator set "+
+	"at %v into data/, from $HEIMDALL_RPC_URL and $HEIMDALL_REST_URL", recordedCommitHeight, recordedCommitHeight+1,
+	recordedCommitHeight))
+
+// the Amoy height checkpoint-2809.json was recorded at
+const recordedCommitHeight = 1495098
+
+func recordedCommitPath(name string, height int64) string {
+	return fmt.Sprintf("data/%v-%v.json", name, height)
+}
+
+func TestRecordCommit(t *testing.T) {
+	if !*recordCommit {
+		t.Skip("run with -record-commit to record the blocks and validator set at " + fmt.Sprint(recordedCommitHeight))
+	}
+	rpcURL := strings.TrimSuffix(os.Getenv("HEIMDALL_RPC_URL"), "/")
+	for _, h := range []int64{recordedCommitHeight, recordedCommitHeight + 1} {
+		resp, err := http.Get(fmt.Sprintf("%v/block?height=%v", rpcURL, h))
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		var rpcResp struct {
+			Result json.RawMessage `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(data, &rpcResp))
+		_, err = DecodeResultBlock(rpcResp.Result)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(recordedCommitPath("block", h), rpcResp.Result, 0644))
+	}
+
+	tc := &TendermintClient{RESTURL: strings.TrimSuffix(os.Getenv("HEIMDALL_REST_URL"), "/"), RESTClient: http.DefaultClient}
+	data, err := tc.getREST(fmt.Sprintf("/staking/validator-set?height=%v", recordedCommitHeight))
+	require.NoError(t, err)
+	_, err = DecodeValidatorSet(data)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(recordedCommitPath("validator-set", recordedCommitHeight), data, 0644))
+}
+
+// loadRecordedCommit loads the Amoy blocks and validator set written by TestRecordCommit.
+func loadRecordedCommit(t *testing.T) (*tmTypes.Block, *tmTypes.Block, *ValidatorSet) {
+	var blocks []*tmTypes.Block
+	for _, h := range []int64{recordedCommitHeight, recordedCommitHeight + 1} {
+		data, err := os.ReadFile(recordedCommitPath("block", h))
+		require.NoError(t, err, "record it with TestRecordCommit")
+		rb, err := DecodeResultBlock(data)
+		require.NoError(t, err)
+		blocks = append(blocks, rb.Block)
+	}
+	data, err := os.ReadFile(recordedCommitPath("validator-set", recordedCommitHeight))
+	require.NoError(t, err, "record it with TestRecordCommit")
+	vs, err := DecodeValidatorSet(data)
+	require.NoError(t, err)
+	return blocks[0], blocks[1], vs
+}
+
+func loadCommitFixture(t *testing.T) (*tmTypes.Block, *tmTypes.Block, *ValidatorSet) {
+	b1000, err := DecodeResultBlock(block1000Data)
+	require.NoError(t, err)
+	b1001, err := DecodeResultBlock(block1001Data)
+	require.NoError(t, err)
+	vs, err := DecodeValidatorSet(validatorSet1000Data)
+	require.NoError(t, err)
+	return b1000.Block, b1001.Block, vs
+}
+
+func TestVerifyCommit(t *testing.T) {
+	block, next, vs := loadRecordedCommit(t)
+	require.Equal(t, "heimdall-80002", block.ChainID)
+	require.Equal(t, block.Hash(), next.LastCommit.BlockID.Hash)
+
+	report, err := VerifyCommit(block.ChainID, recordedCommitHeight, next.LastCommit, vs)
+	require.NoError(t, err)
+	require.True(t, report.Quorum)
+	require.Equal(t, vs.TotalVotingPower(), report.TotalPower)
+	require.NotEmpty(t, report.Signers)
+
+	m := NewMockHeimdallClient()
+	m.AddBlock(block, nil)
+	m.AddBlock(next, nil)
+	blockReport, _, err := VerifyBlockCommit(context.Background(), m, recordedCommitHeight, vs)
+	require.NoError(t, err)
+	require.Equal(t, report, blockReport)
+
+	_, err = VerifyCommit(block.ChainID, recordedCommitHeight-1, next.LastCommit, vs)
+	require.Error(t, err)
+	_, err = VerifyCommit("heimdall-137", recordedCommitHeight, next.LastCommit, vs)
+	require.ErrorIs(t, err, ErrInvalidPrecommit)
+}
+
+// the test chain blocks are signed by deterministic keys with the same sign bytes VerifyCommit checks, so they only
+// show that changed commits fail.
+func TestVerifyCommitInvalid(t *testing.T) {
+	block, next, vs := loadCommitFixture(t)
+	require.Equal(t, block.Hash(), next.LastCommit.BlockID.Hash)
+
+	// the signatures are over the chain id and height
+	_, err := VerifyCommit("heimdall-137", 1000, next.LastCommit, vs)
+	require.ErrorIs(t, err, ErrInvalidPrecommit)
+	_, err = VerifyCommit(block.ChainID, 999, next.LastCommit, vs)
+	require.Error(t, err)
+
+	// without the largest validator: 40 of 100
+	withoutLargest := copyCommit(next.LastCommit)
+	for i, pc := range withoutLargest.Precommits {
+		if v, _ := vs.BySigner(ethgo.BytesToAddress(pc.ValidatorAddress)); v.VotingPower == 40 {
+			withoutLargest.Precommits[i] = nil
+		}
+	}
+	report, err := VerifyCommit(block.ChainID, 1000, withoutLargest, vs)
+	require.NoError(t, err)
+	require.False(t, report.Quorum)
+	require.Equal(t, int64(40), report.SignedPower)
+
+	// a signature from another validator's precommit
+	swapped := copyCommit(next.LastCommit)
+	swapped.Precommits[0].Signature = next.LastCommit.Precommits[2].Signature
+	_, err = VerifyCommit(block.ChainID, 1000, swapped, vs)
+	require.ErrorIs(t, err, ErrInvalidPrecommit)
+
+	// truncated signature
+	truncated := copyCommit(next.LastCommit)
+	truncated.Precommits[0].Signature = truncated.Precommits[0].Signature[:64]
+	_, err = VerifyCommit(block.ChainID, 1000, truncated, vs)
+	require.ErrorIs(t, err, ErrInvalidPrecommit)
+
+	// a validator set the signers aren't in
+	other, err := DecodeValidatorSet(validatorSetData)
+	require.NoError(t, err)
+	_, err = VerifyCommit(block.ChainID, 1000, next.LastCommit, other)
+	require.ErrorIs(t, err, ErrUnknownSigner)
+}
+
+// copyCommit copies the precommits, so they can be changed without changing the fixture.
+func copyCommit(c *tmTypes.Commit) *tmTypes.Commit {
+	pcs := make([]*tmTypes.CommitSig, len(c.Precommits))
+	for i, pc := range c.Precommits {
+		if pc != nil {
+			cp := *pc
+			pcs[i] = &cp
+		}
+	}
+	return tmTypes.NewCommit(c.BlockID, pcs)
+}
+
+func TestVerifyBlockCommit(t *testing.T) {
+	m, err := NewFixtureHeimdallClient()
+	require.NoError(t, err)
+	_, _, vs := loadCommitFixture(t)
+
+	report, block, err := VerifyBlockCommit(context.Background(), m, 1000, vs)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), block.Height)
+	require.True(t, report.Quorum)
+
+	// FetchVotes gives the same precommits
+	votes, sigs, chainID, err := FetchVotes(context.Background(), m, 1000)
+	require.NoError(t, err)
+	require.Equal(t, "heimdall-80002", chainID)
+	require.Len(t, votes, 4)
+	require.Len(t, sigs, 4*65)
+
+	// a commit for another block at the same height
+	_, next, _ := loadCommitFixture(t)
+	other := testBlock(1000)
+	other.ValidatorsHash = block.ValidatorsHash
+	m.AddBlock(other, nil)
+	m.AddBlock(next, nil)
+	_, _, err = VerifyBlockCommit(context.Background(), m, 1000, vs)
+	require.ErrorContains(t, err, "commit at 1001 is for block")
+}
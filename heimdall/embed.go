@@ -9,3 +9,63 @@ var checkPointData, _ = fchk.ReadFile("data/checkpoint.ndjson")
 //go:embed data/side-tx1.json
 var fstx embed.FS
 var sideTxData, _ = fstx.ReadFile("data/side-tx1.json")
+
+// the signers of side-tx1 with test voting powers, plus two validators that did not sign
+//
+//go:embed data/validator-set1.json
+var fvs embed.FS
+var validatorSetData, _ = fvs.ReadFile("data/validator-set1.json")
+
+//go:embed data/milestone1.json
+var fms embed.FS
+var milestoneData, _ = fms.ReadFile("data/milestone1.json")
+
+//go:embed data/checkpoint-2809.json
+var fcp embed.FS
+var checkpoint2809Data, _ = fcp.ReadFile("data/checkpoint-2809.json")
+
+// blocks 1000 and 1001 of a synthetic test chain, in Tendermint RPC /block format. the commit for 1000, in 1001, is
+// signed by deterministic test keys, the validators in validator-set-1000 - one of them precommitted nil. they only
+// serve the negative cases, the recorded Amoy blocks from TestRecordCommit are the positive ones.
+//
+//go:embed data/block-1000.json data/block-1001.json
+var fblk embed.FS
+var block1000Data, _ = fblk.ReadFile("data/block-1000.json")
+var block1001Data, _ = fblk.ReadFile("data/block-1001.json")
+
+//go:embed data/validator-set-1000.json
+var fvs1000 embed.FS
+var validatorSet1000Data, _ = fvs1000.ReadFile("data/validator-set-1000.json")
+
+// a span rebuilt for the checkpoint.ndjson blocks, in the REST response format. it is not a recorded response: the
+// selected producers are the ones listed in the sprint-end headers, the validator set powers are those of
+// validator-set1, and the id and range are the 6400 block span that would cover the blocks. TestRecordSpan records
+// the real one.
+//
+//go:embed data/span-rebuilt.json
+var fspan embed.FS
+var spanRebuiltData, _ = fspan.ReadFile("data/span-rebuilt.json")
+
+// witness test vectors for circuit implementations, from TestWitnessVectors
+//
+//go:embed data/witness-v1.json data/witness-v1.bin data/witness-v1-result.json
+var fwit embed.FS
+var witnessV1JSON, _ = fwit.ReadFile("data/witness-v1.json")
+var witnessV1Bin, _ = fwit.ReadFile("data/witness-v1.bin")
+var witnessV1Result, _ = fwit.ReadFile("data/witness-v1-result.json")
+
+// the same from a real block of checkpoint 2809, in its real root. the side-tx data is the checkpoint's, signed by test
+// keys
+//
+//go:embed data/witness-v1-checkpoint2809.json data/witness-v1-checkpoint2809.bin data/witness-v1-checkpoint2809-result.json
+var fwitcp embed.FS
+var witnessCheckpoint2809JSON, _ = fwitcp.ReadFile("data/witness-v1-checkpoint2809.json")
+var witnessCheckpoint2809Bin, _ = fwitcp.ReadFile("data/witness-v1-checkpoint2809.bin")
+var witnessCheckpoint2809Result, _ = fwitcp.ReadFile("data/witness-v1-checkpoint2809-result.json")
+
+// clerk records 1, 3, 2 and 5 of the state syncs in testStateSyncL1, in the order heimdall included them, with the
+// heights that included them
+//
+//go:embed data/clerk-records.json
+var fclerk embed.FS
+var clerkRecordsData, _ = fclerk.ReadFile("data/clerk-records.json")
@@ -0,0 +1,112 @@
+package heimdall
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paulgoleary/evm-research"
+	"github.com/umbracle/ethgo"
+	"math"
+)
+
+// HeaderProof is the Merkle path of one Bor block's header hash up to the root hash of the checkpoint or milestone
+// covering [StartBlock, EndBlock]. Version is the header leaf format, zero meaning HeaderV1.
+type HeaderProof struct {
+	Version     HeaderVersion `json:"version,omitempty"`
+	StartBlock  uint64        `json:"start_block"`
+	EndBlock    uint64        `json:"end_block"`
+	BlockNumber uint64        `json:"block_number"`
+	HeaderHash  ethgo.Hash    `json:"header_hash"`
+	Path        []ethgo.Hash  `json:"path"`
+}
+
+var ErrInvalidHeaderProof = errors.New("invalid header proof")
+
+// BuildHeaderProof returns the proof for blockNum within blocks - the full, contiguous block range of a checkpoint
+// or milestone - and the root hash of the range, with header leaves in the given version.
+func BuildHeaderProof(blocks []*ethgo.Block, blockNum uint64, version HeaderVersion) (p *HeaderProof, root ethgo.Hash, err error) {
+	var leaves [][32]byte
+	if leaves, err = headerLeaves(blocks, version); err != nil {
+		return
+	}
+	start := blocks[0].Number
+	end := start + uint64(len(blocks)) - 1
+	if blockNum < start || blockNum > end {
+		return nil, root, fmt.Errorf("block %v is not in range [%v, %v]", blockNum, start, end)
+	}
+
+	var tree *evm_research.Accumulator
+	if tree, err = checkpointTree(leaves); err != nil {
+		return
+	}
+	idx := blockNum - start
+	p = &HeaderProof{Version: version, StartBlock: start, EndBlock: end, BlockNumber: blockNum, HeaderHash: leaves[idx]}
+	if len(leaves) > 1 {
+		var path [][32]byte
+		if _, path, err = tree.Proof(idx); err != nil {
+			return nil, root, err
+		}
+		for _, sib := range path {
+			p.Path = append(p.Path, sib)
+		}
+	}
+	return p, checkpointRoot(tree), nil
+}
+
+// GetHeaderProof is BuildHeaderProof over a block range fetched like getRootHash does.
+func GetHeaderProof(getBlockRange func() ([]*ethgo.Block, error), blockNum uint64, version HeaderVersion) (p *HeaderProof, root ethgo.Hash, err error) {
+	var blocks []*ethgo.Block
+	if blocks, err = getBlockRange(); err != nil {
+		return
+	}
+	return BuildHeaderProof(blocks, blockNum, version)
+}
+
+// Root hashes the header hash up through the path.
+func (p *HeaderProof) Root() (root ethgo.Hash, err error) {
+	if p.EndBlock < p.StartBlock || p.BlockNumber < p.StartBlock || p.BlockNumber > p.EndBlock ||
+		p.EndBlock-p.StartBlock == math.MaxUint64 {
+		return root, fmt.Errorf("%w: block %v is not in range [%v, %v]", ErrInvalidHeaderProof, p.BlockNumber, p.StartBlock, p.EndBlock)
+	}
+	numBlocks := p.EndBlock - p.StartBlock + 1
+	if numBlocks == 1 {
+		if len(p.Path) != 0 {
+			return root, fmt.Errorf("%w: path length %v, expected 0", ErrInvalidHeaderProof, len(p.Path))
+		}
+		return p.HeaderHash, nil
+	}
+	path := make([][32]byte, len(p.Path))
+	for i := range p.Path {
+		path[i] = p.Path[i]
+	}
+	if root, err = newCheckpointTree(numBlocks).RootFromPath(p.HeaderHash, p.BlockNumber-p.StartBlock, path); err != nil {
+		return root, fmt.Errorf("%w: %v", ErrInvalidHeaderProof, err)
+	}
+	return
+}
+
+// Verify checks the proof against a checkpoint or milestone root_hash.
+func (p *HeaderProof) Verify(rootHash ethgo.Hash) error {
+	root, err := p.Root()
+	if err != nil {
+		return err
+	}
+	if root != rootHash {
+		return fmt.Errorf("%w: root %v, expected %v", ErrInvalidHeaderProof, root, rootHash)
+	}
+	return nil
+}
+
+// VerifyBlock checks that b is the proven block, then verifies the proof against rootHash.
+func (p *HeaderProof) VerifyBlock(b *ethgo.Block, rootHash ethgo.Hash) error {
+	if b.Number != p.BlockNumber {
+		return fmt.Errorf("%w: block %v, proof is for block %v", ErrInvalidHeaderProof, b.Number, p.BlockNumber)
+	}
+	leaf, err := p.Version.Leaf(b)
+	if err != nil {
+		return err
+	}
+	if h := ethgo.Hash(leaf); h != p.HeaderHash {
+		return fmt.Errorf("%w: %v header hash %v, proof has %v", ErrInvalidHeaderProof, p.Version.orV1(), h, p.HeaderHash)
+	}
+	return p.Verify(rootHash)
+}
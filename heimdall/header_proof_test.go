@@ -0,0 +1,165 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/xsleonard/go-merkle"
+	"golang.org/x/crypto/sha3"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+const checkpoint2809Root = "0x80df8b6d4fa3731c4b4960522efba1602e23ee1ebff9ac5f237a540de04df4cc"
+
+func TestHeaderProofCheckpoint(t *testing.T) {
+	blocks, err := loadCheckpointBlocks()
+	require.NoError(t, err)
+	root := ethgo.HexToHash(checkpoint2809Root)
+
+	for _, b := range blocks {
+		p, gotRoot, err := BuildHeaderProof(blocks, b.Number, HeaderV1)
+		require.NoError(t, err)
+		require.Equal(t, root, gotRoot)
+		require.Equal(t, 9, len(p.Path))
+		require.NoError(t, p.VerifyBlock(b, root), "block %v", b.Number)
+	}
+
+	p, _, err := BuildHeaderProof(blocks, 3639500, HeaderV1)
+	require.NoError(t, err)
+
+	// the wrong block, a tampered path and the wrong root all fail
+	require.ErrorIs(t, p.VerifyBlock(blocks[0], root), ErrInvalidHeaderProof)
+	other := *blocks[3639500-3639411]
+	other.ReceiptsRoot = ethgo.HexToHash("0x01")
+	require.ErrorIs(t, p.VerifyBlock(&other, root), ErrInvalidHeaderProof)
+
+	bad := *p
+	bad.Path = append([]ethgo.Hash(nil), p.Path...)
+	bad.Path[4][0] ^= 1
+	require.ErrorIs(t, bad.Verify(root), ErrInvalidHeaderProof)
+	bad.Path = p.Path[:8]
+	require.ErrorIs(t, bad.Verify(root), ErrInvalidHeaderProof)
+	bad = *p
+	bad.BlockNumber++
+	require.ErrorIs(t, bad.Verify(root), ErrInvalidHeaderProof)
+	require.ErrorIs(t, p.Verify(ethgo.HexToHash("0x01")), ErrInvalidHeaderProof)
+
+	_, _, err = BuildHeaderProof(blocks, 3639410, HeaderV1)
+	require.Error(t, err)
+	_, _, err = BuildHeaderProof(append(blocks[:10:10], blocks[11:20]...), 3639411, HeaderV1)
+	require.Error(t, err)
+}
+
+// borRootHash is Bor's GetRootHash over already fetched blocks: header leaves in a [][32]byte of the next power of
+// two, so the padding leaves are zero hashes, through go-merkle.
+func borRootHash(t *testing.T, blocks []*ethgo.Block) string {
+	headers := make([][32]byte, nextPowerOfTwo(uint64(len(blocks))))
+	for i, b := range blocks {
+		copy(headers[i][:], calcHeaderHash(b))
+	}
+	converted := make([][]byte, len(headers))
+	for i := range headers {
+		converted[i] = headers[i][:]
+	}
+	tree := merkle.NewTreeWithOpts(merkle.TreeOptions{EnableHashSorting: false, DisableHashLeaves: true})
+	require.NoError(t, tree.Generate(converted, sha3.NewLegacyKeccak256()))
+	return hex.EncodeToString(tree.Root().Hash)
+}
+
+func TestHeaderProofPartialRange(t *testing.T) {
+	all, err := loadCheckpointBlocks()
+	require.NoError(t, err)
+
+	for _, n := range []int{1, 2, 3, 100, 257, 300} {
+		blocks := all[7 : 7+n]
+		rootHex, err := getRootHash(func() ([]*ethgo.Block, error) { return blocks, nil }, HeaderV1)
+		require.NoError(t, err)
+		require.Equal(t, borRootHash(t, blocks), rootHex, "%v blocks", n)
+
+		if n != 1 && nextPowerOfTwo(uint64(n)) != uint64(n) {
+			// nil padding, which go-merkle promotes instead of hashing, gives another root
+			padded := make([][]byte, nextPowerOfTwo(uint64(n)))
+			for i := range blocks {
+				padded[i] = calcHeaderHash(blocks[i])
+			}
+			tree := merkle.NewTreeWithOpts(merkle.TreeOptions{EnableHashSorting: false, DisableHashLeaves: true})
+			require.NoError(t, tree.Generate(padded, sha3.NewLegacyKeccak256()))
+			require.NotEqual(t, hex.EncodeToString(tree.Root().Hash), rootHex, "%v blocks", n)
+		}
+
+		for _, i := range []int{0, n / 2, n - 1} {
+			p, root, err := GetHeaderProof(func() ([]*ethgo.Block, error) { return blocks, nil }, blocks[i].Number, HeaderV1)
+			require.NoError(t, err)
+			require.Equal(t, rootHex, hex.EncodeToString(root[:]))
+			require.NoError(t, p.VerifyBlock(blocks[i], root), "%v blocks, block %v", n, i)
+		}
+	}
+}
+
+var recordCheckpoint = flag.Uint64("record-checkpoint", 0, "record checkpoint N and its blocks as "+
+	partialCheckpointPath+" and "+partialCheckpointBlocksPath+", from $HEIMDALL_REST_URL and $BOR_RPC_URL")
+
+// a recorded checkpoint whose range isn't a power of two, so its root includes padding
+const (
+	partialCheckpointPath       = "data/checkpoint-partial.json"
+	partialCheckpointBlocksPath = "data/checkpoint-partial.ndjson"
+)
+
+func TestRecordCheckpoint(t *testing.T) {
+	if *recordCheckpoint == 0 {
+		t.Skip("run with -record-checkpoint N to record " + partialCheckpointPath)
+	}
+	tc := &TendermintClient{RESTURL: strings.TrimSuffix(os.Getenv("HEIMDALL_REST_URL"), "/"), RESTClient: http.DefaultClient}
+	data, err := tc.getREST(fmt.Sprintf("/checkpoints/%v", *recordCheckpoint))
+	require.NoError(t, err)
+	cp, _, err := DecodeCheckpointResponse(data)
+	require.NoError(t, err)
+	n := cp.EndBlock - cp.StartBlock + 1
+	require.NotEqual(t, nextPowerOfTwo(n), n, "checkpoint %v covers %v blocks", *recordCheckpoint, n)
+
+	src, err := NewRPCBlockSource(os.Getenv("BOR_RPC_URL"))
+	require.NoError(t, err)
+	f, err := os.Create(partialCheckpointBlocksPath)
+	require.NoError(t, err)
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	require.NoError(t, src.Blocks(context.Background(), cp.StartBlock, cp.EndBlock, func(b *ethgo.Block) error {
+		return enc.Encode(b)
+	}))
+	require.NoError(t, os.WriteFile(partialCheckpointPath, data, 0644))
+}
+
+func TestHeaderProofRecordedPartialRange(t *testing.T) {
+	data, err := os.ReadFile(partialCheckpointPath)
+	require.NoError(t, err, "record it with TestRecordCheckpoint")
+	cp, _, err := DecodeCheckpointResponse(data)
+	require.NoError(t, err)
+	n := cp.EndBlock - cp.StartBlock + 1
+	require.NotEqual(t, nextPowerOfTwo(n), n)
+
+	src := &NdjsonBlockSource{Path: partialCheckpointBlocksPath}
+	root, err := ComputeRootHash(context.Background(), src, cp.StartBlock, cp.EndBlock, HeaderV1)
+	require.NoError(t, err)
+	require.Equal(t, cp.RootHash, root)
+
+	var blocks []*ethgo.Block
+	require.NoError(t, src.Blocks(context.Background(), cp.StartBlock, cp.EndBlock, func(b *ethgo.Block) error {
+		blocks = append(blocks, b)
+		return nil
+	}))
+	// the zero padding is Bor's
+	require.Equal(t, cp.RootHash.String(), "0x"+borRootHash(t, blocks))
+	for _, i := range []uint64{0, n / 2, n - 1} {
+		p, gotRoot, err := BuildHeaderProof(blocks, cp.StartBlock+i, HeaderV1)
+		require.NoError(t, err)
+		require.Equal(t, cp.RootHash, gotRoot)
+		require.NoError(t, p.VerifyBlock(blocks[i], cp.RootHash), "block %v", blocks[i].Number)
+	}
+}
@@ -0,0 +1,71 @@
+package heimdall
+
+import (
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"math/big"
+)
+
+// HeaderVersion selects what a checkpoint header leaf commits to. Every field is left padded to 32 bytes and the
+// leaf is the keccak of the concatenation. only V1 is what Bor hashes today - the others are candidates for a hard
+// fork that lets checkpoints and milestones prove state.
+type HeaderVersion uint8
+
+const (
+	// HeaderV1 is number ++ timestamp ++ transactionsRoot ++ receiptsRoot.
+	HeaderV1 HeaderVersion = 1
+	// HeaderV2 is V1 ++ stateRoot.
+	HeaderV2 HeaderVersion = 2
+	// HeaderV2WithHash is V2 ++ the block hash.
+	HeaderV2WithHash HeaderVersion = 3
+)
+
+func (v HeaderVersion) String() string {
+	switch v {
+	case HeaderV1:
+		return "v1"
+	case HeaderV2:
+		return "v2"
+	case HeaderV2WithHash:
+		return "v2+hash"
+	}
+	return fmt.Sprintf("HeaderVersion(%d)", uint8(v))
+}
+
+// orV1 is the version of proofs serialized before there were versions.
+func (v HeaderVersion) orV1() HeaderVersion {
+	if v == 0 {
+		return HeaderV1
+	}
+	return v
+}
+
+// LeafBytes are the bytes that are hashed for b's leaf.
+func (v HeaderVersion) LeafBytes(b *ethgo.Block) ([]byte, error) {
+	fields := [][]byte{
+		new(big.Int).SetUint64(b.Number).Bytes(),
+		new(big.Int).SetUint64(b.Timestamp).Bytes(),
+		b.TransactionsRoot.Bytes(),
+		b.ReceiptsRoot.Bytes(),
+	}
+	switch v.orV1() {
+	case HeaderV1:
+	case HeaderV2:
+		fields = append(fields, b.StateRoot.Bytes())
+	case HeaderV2WithHash:
+		fields = append(fields, b.StateRoot.Bytes(), b.Hash.Bytes())
+	default:
+		return nil, fmt.Errorf("unknown header version %v", v)
+	}
+	return appendBytes32(fields...), nil
+}
+
+// Leaf is the header hash of b.
+func (v HeaderVersion) Leaf(b *ethgo.Block) (leaf [32]byte, err error) {
+	var data []byte
+	if data, err = v.LeafBytes(b); err != nil {
+		return
+	}
+	copy(leaf[:], ethgo.Keccak256(data))
+	return
+}
@@ -0,0 +1,106 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"testing"
+)
+
+// The header leaf layouts, as 32 byte words. Integers are big endian and left padded.
+func ExampleHeaderVersion_LeafBytes() {
+	b := &ethgo.Block{
+		Number:           0x3b5292,
+		Timestamp:        0x65d23308,
+		TransactionsRoot: ethgo.HexToHash("0x1111111111111111111111111111111111111111111111111111111111111111"),
+		ReceiptsRoot:     ethgo.HexToHash("0x2222222222222222222222222222222222222222222222222222222222222222"),
+		StateRoot:        ethgo.HexToHash("0x3333333333333333333333333333333333333333333333333333333333333333"),
+		Hash:             ethgo.HexToHash("0x4444444444444444444444444444444444444444444444444444444444444444"),
+	}
+	for _, v := range []HeaderVersion{HeaderV1, HeaderV2, HeaderV2WithHash} {
+		data, _ := v.LeafBytes(b)
+		leaf, _ := v.Leaf(b)
+		fmt.Printf("%v: %v bytes, leaf %x\n", v, len(data), leaf)
+		for i := 0; i < len(data); i += 32 {
+			fmt.Printf("  %3d %x\n", i, data[i:i+32])
+		}
+	}
+	// Output:
+	// v1: 128 bytes, leaf 03511e66ebcd8dca72ab920dd6e6113123fd11f0c6ac8d904c9d817bfffe8ebf
+	//     0 00000000000000000000000000000000000000000000000000000000003b5292
+	//    32 0000000000000000000000000000000000000000000000000000000065d23308
+	//    64 1111111111111111111111111111111111111111111111111111111111111111
+	//    96 2222222222222222222222222222222222222222222222222222222222222222
+	// v2: 160 bytes, leaf f14bdc147eb0457b732b286dfcb284fdfa68359b8c0010211d32be563078fff1
+	//     0 00000000000000000000000000000000000000000000000000000000003b5292
+	//    32 0000000000000000000000000000000000000000000000000000000065d23308
+	//    64 1111111111111111111111111111111111111111111111111111111111111111
+	//    96 2222222222222222222222222222222222222222222222222222222222222222
+	//   128 3333333333333333333333333333333333333333333333333333333333333333
+	// v2+hash: 192 bytes, leaf cbc18bd15418f5a4f848cd056deb96e3a73cd56bbeb2d901787d55efb7dcb5ff
+	//     0 00000000000000000000000000000000000000000000000000000000003b5292
+	//    32 0000000000000000000000000000000000000000000000000000000065d23308
+	//    64 1111111111111111111111111111111111111111111111111111111111111111
+	//    96 2222222222222222222222222222222222222222222222222222222222222222
+	//   128 3333333333333333333333333333333333333333333333333333333333333333
+	//   160 4444444444444444444444444444444444444444444444444444444444444444
+}
+
+func TestHeaderVersions(t *testing.T) {
+	blocks, err := loadCheckpointBlocks()
+	require.NoError(t, err)
+	getBlocks := func() ([]*ethgo.Block, error) { return blocks, nil }
+
+	roots := make(map[HeaderVersion]ethgo.Hash)
+	for _, v := range []HeaderVersion{HeaderV1, HeaderV2, HeaderV2WithHash} {
+		rootHex, err := getRootHash(getBlocks, v)
+		require.NoError(t, err)
+		root := ethgo.HexToHash(rootHex)
+		roots[v] = root
+
+		for _, i := range []int{0, 1, 255, 511} {
+			p, gotRoot, err := GetHeaderProof(getBlocks, blocks[i].Number, v)
+			require.NoError(t, err)
+			require.Equal(t, root, gotRoot)
+			require.Equal(t, v, p.Version)
+			require.NoError(t, p.VerifyBlock(blocks[i], root), "%v block %v", v, i)
+		}
+	}
+	// today's checkpoints are v1
+	require.Equal(t, checkpoint2809Root, roots[HeaderV1].String())
+	require.NotEqual(t, roots[HeaderV1], roots[HeaderV2])
+	require.NotEqual(t, roots[HeaderV2], roots[HeaderV2WithHash])
+
+	// only v2 commits to the state root
+	p1, _, err := BuildHeaderProof(blocks, blocks[7].Number, HeaderV1)
+	require.NoError(t, err)
+	p2, _, err := BuildHeaderProof(blocks, blocks[7].Number, HeaderV2)
+	require.NoError(t, err)
+	changed := *blocks[7]
+	changed.StateRoot = ethgo.HexToHash("0x01")
+	require.NoError(t, p1.VerifyBlock(&changed, roots[HeaderV1]))
+	require.ErrorIs(t, p2.VerifyBlock(&changed, roots[HeaderV2]), ErrInvalidHeaderProof)
+
+	// a proof's version is part of it
+	p2.Version = HeaderV1
+	require.ErrorIs(t, p2.VerifyBlock(blocks[7], roots[HeaderV2]), ErrInvalidHeaderProof)
+
+	// v1 proofs serialized without a version are still v1
+	data, err := json.Marshal(p1)
+	require.NoError(t, err)
+	var unversioned map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &unversioned))
+	delete(unversioned, "version")
+	data, err = json.Marshal(unversioned)
+	require.NoError(t, err)
+	var decoded HeaderProof
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, HeaderVersion(0), decoded.Version)
+	require.NoError(t, decoded.VerifyBlock(blocks[7], roots[HeaderV1]))
+
+	_, _, err = BuildHeaderProof(blocks, blocks[0].Number, HeaderVersion(9))
+	require.Error(t, err)
+	_, err = getRootHash(getBlocks, HeaderVersion(9))
+	require.Error(t, err)
+}
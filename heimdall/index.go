@@ -0,0 +1,259 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/umbracle/ethgo"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// event types and attribute keys of the checkpoint module's side-tx post handlers. these are emitted in the begin
+// blocker of the block after the one the tx was included in, once the side-tx votes are in.
+const (
+	EventTypeCheckpoint = "checkpoint"
+	EventTypeMilestone  = "milestone"
+
+	attrTxHash       = "txhash"
+	attrSideTxResult = "side-tx-result"
+	attrStartBlock   = "start-block"
+	attrEndBlock     = "end-block"
+	attrRootHash     = "root-hash"
+	attrHash         = "hash"
+	attrMilestoneID  = "milestone-id"
+)
+
+var (
+	ErrNotIndexed      = errors.New("bor block is not covered by the index")
+	ErrOverlappingSpan = errors.New("range overlaps an indexed range")
+)
+
+// RangeEntry is a checkpoint or milestone and the Bor block range it covers.
+type RangeEntry struct {
+	Kind       string `json:"kind"`
+	StartBlock uint64 `json:"start_block"`
+	EndBlock   uint64 `json:"end_block"`
+	// HeimdallHeight is the height of the block whose begin blocker emitted the event.
+	HeimdallHeight int64      `json:"heimdall_height"`
+	TxHash         string     `json:"tx_hash"`
+	RootHash       ethgo.Hash `json:"root_hash"`
+	// ID is the milestone id. checkpoints only get a number when acked on L1, so it is empty for them.
+	ID string `json:"id,omitempty"`
+}
+
+// ParseRangeEvent reads a checkpoint or milestone begin-block event. ok is false for any other event, and for
+// side-txs that were voted down.
+func ParseRangeEvent(ev abci.Event, height int64) (e RangeEntry, ok bool, err error) {
+	if ev.Type != EventTypeCheckpoint && ev.Type != EventTypeMilestone {
+		return
+	}
+	attrs := make(map[string]string, len(ev.Attributes))
+	for _, a := range ev.Attributes {
+		attrs[string(a.Key)] = string(a.Value)
+	}
+	if res, has := attrs[attrSideTxResult]; has && res != abci.SideTxResultType_Yes.String() {
+		return
+	}
+	// the tx itself emits an event of the same type without a tx hash, only the post handler's one counts
+	if e.TxHash, ok = attrs[attrTxHash]; !ok {
+		return
+	}
+	e.Kind, e.HeimdallHeight, e.ID = ev.Type, height, attrs[attrMilestoneID]
+	e.TxHash = strings.ToLower(strings.TrimPrefix(e.TxHash, "0x"))
+	if e.StartBlock, err = strconv.ParseUint(attrs[attrStartBlock], 10, 64); err != nil {
+		return e, false, fmt.Errorf("%v event at %v: %w", ev.Type, height, err)
+	}
+	if e.EndBlock, err = strconv.ParseUint(attrs[attrEndBlock], 10, 64); err != nil {
+		return e, false, fmt.Errorf("%v event at %v: %w", ev.Type, height, err)
+	}
+	if e.EndBlock < e.StartBlock {
+		return e, false, fmt.Errorf("%v event at %v: end block %v before start block %v", ev.Type, height, e.EndBlock, e.StartBlock)
+	}
+	root := attrs[attrRootHash]
+	if ev.Type == EventTypeMilestone {
+		root = attrs[attrHash]
+	}
+	e.RootHash = ethgo.HexToHash(root)
+	return
+}
+
+// RangeIndex is a set of non-overlapping Bor block ranges, sorted by start block.
+type RangeIndex struct {
+	entries    []RangeEntry
+	superseded []RangeEntry
+}
+
+// Insert adds an entry. Inserting an entry that is already indexed is a no-op, so blocks can be re-ingested.
+//
+// A checkpoint that isn't acked on L1 in time is proposed again from the same start block, and accepted again. Of
+// two checkpoints with the same start block, the one accepted at the later Heimdall height is indexed and the other
+// one is kept as superseded.
+func (ri *RangeIndex) Insert(e RangeEntry) error {
+	i := sort.Search(len(ri.entries), func(i int) bool { return ri.entries[i].EndBlock >= e.StartBlock })
+	j := i
+	for j < len(ri.entries) && ri.entries[j].StartBlock <= e.EndBlock {
+		j++
+	}
+	if i == j {
+		ri.entries = append(ri.entries, RangeEntry{})
+		copy(ri.entries[i+1:], ri.entries[i:])
+		ri.entries[i] = e
+		return nil
+	}
+	old := ri.entries[i]
+	if old == e {
+		return nil
+	}
+	for _, s := range ri.superseded {
+		if s == e {
+			return nil
+		}
+	}
+	if j > i+1 || e.Kind != EventTypeCheckpoint || old.Kind != EventTypeCheckpoint || e.StartBlock != old.StartBlock ||
+		e.HeimdallHeight == old.HeimdallHeight {
+		return fmt.Errorf("%w: [%v, %v] and [%v, %v] (tx %v)", ErrOverlappingSpan, e.StartBlock, e.EndBlock,
+			old.StartBlock, old.EndBlock, old.TxHash)
+	}
+	if e.HeimdallHeight < old.HeimdallHeight {
+		ri.superseded = append(ri.superseded, e)
+		return nil
+	}
+	ri.superseded = append(ri.superseded, old)
+	ri.entries[i] = e
+	return nil
+}
+
+// Find returns the entry whose range covers borBlock.
+func (ri *RangeIndex) Find(borBlock uint64) (e RangeEntry, err error) {
+	i := sort.Search(len(ri.entries), func(i int) bool { return ri.entries[i].EndBlock >= borBlock })
+	if i == len(ri.entries) || ri.entries[i].StartBlock > borBlock {
+		return e, fmt.Errorf("%w: %v", ErrNotIndexed, borBlock)
+	}
+	return ri.entries[i], nil
+}
+
+func (ri *RangeIndex) Len() int {
+	return len(ri.entries)
+}
+
+func (ri *RangeIndex) Entries() []RangeEntry {
+	return ri.entries
+}
+
+// Superseded are the checkpoints replaced by a later proposal from the same start block, in the order they were
+// replaced.
+func (ri *RangeIndex) Superseded() []RangeEntry {
+	return ri.superseded
+}
+
+// RangeIndexer ingests Heimdall begin-block events into separate checkpoint and milestone indexes - the two overlap,
+// since every checkpoint range is also covered by milestones.
+type RangeIndexer struct {
+	Client      HeimdallClient
+	Checkpoints RangeIndex
+	Milestones  RangeIndex
+	// LastHeight is the last Heimdall height ingested.
+	LastHeight int64
+}
+
+func NewRangeIndexer(client HeimdallClient) *RangeIndexer {
+	return &RangeIndexer{Client: client}
+}
+
+func (x *RangeIndexer) index(kind string) *RangeIndex {
+	if kind == EventTypeMilestone {
+		return &x.Milestones
+	}
+	return &x.Checkpoints
+}
+
+// IngestHeight indexes the checkpoint and milestone events of one Heimdall block.
+func (x *RangeIndexer) IngestHeight(ctx context.Context, height int64) (err error) {
+	var events []abci.Event
+	if events, err = GetBeginBlockEvents(ctx, x.Client, height); err != nil {
+		return
+	}
+	for _, ev := range events {
+		var e RangeEntry
+		var ok bool
+		if e, ok, err = ParseRangeEvent(ev, height); err != nil {
+			return
+		}
+		if !ok {
+			continue
+		}
+		if err = x.index(e.Kind).Insert(e); err != nil {
+			return fmt.Errorf("height %v: %w", height, err)
+		}
+	}
+	if height > x.LastHeight {
+		x.LastHeight = height
+	}
+	return
+}
+
+// IngestRange indexes heights from through to, inclusive.
+func (x *RangeIndexer) IngestRange(ctx context.Context, from, to int64) (err error) {
+	for h := from; h <= to; h++ {
+		if err = x.IngestHeight(ctx, h); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FindMilestone is the milestone covering borBlock.
+func (x *RangeIndexer) FindMilestone(borBlock uint64) (RangeEntry, error) {
+	return x.Milestones.Find(borBlock)
+}
+
+// FindCheckpoint is the checkpoint covering borBlock.
+func (x *RangeIndexer) FindCheckpoint(borBlock uint64) (RangeEntry, error) {
+	return x.Checkpoints.Find(borBlock)
+}
+
+type rangeIndexFile struct {
+	LastHeight int64        `json:"last_height"`
+	Entries    []RangeEntry `json:"entries"`
+	Superseded []RangeEntry `json:"superseded,omitempty"`
+}
+
+// Save writes the index to path. It is written to a temp file first, so an interrupted save leaves the previous
+// index in place.
+func (x *RangeIndexer) Save(path string) (err error) {
+	f := rangeIndexFile{LastHeight: x.LastHeight, Superseded: x.Checkpoints.superseded}
+	f.Entries = append(append(f.Entries, x.Checkpoints.entries...), x.Milestones.entries...)
+	var data []byte
+	if data, err = json.Marshal(&f); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadRangeIndexer reads an index written by Save. Ingesting can resume from LastHeight+1.
+func LoadRangeIndexer(client HeimdallClient, path string) (x *RangeIndexer, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	var f rangeIndexFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return
+	}
+	x = &RangeIndexer{Client: client, LastHeight: f.LastHeight}
+	for _, e := range append(f.Entries, f.Superseded...) {
+		if err = x.index(e.Kind).Insert(e); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,197 @@
+package heimdall
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/umbracle/ethgo"
+	"path/filepath"
+	"testing"
+)
+
+func rangeEvent(typ string, txHash string, start, end uint64, attrs ...string) abci.Event {
+	kv := []string{"module", "checkpoint", attrTxHash, txHash, attrSideTxResult, "Yes",
+		attrStartBlock, fmt.Sprint(start), attrEndBlock, fmt.Sprint(end)}
+	kv = append(kv, attrs...)
+	ev := abci.Event{Type: typ}
+	for i := 0; i < len(kv); i += 2 {
+		ev.Attributes = append(ev.Attributes, cmn.KVPair{Key: []byte(kv[i]), Value: []byte(kv[i+1])})
+	}
+	return ev
+}
+
+var milestone1Hash = ethgo.HexToHash("0x6f73bdeda24c8d6b978628e10c425f5a8bbf181a547dafdf5eb156135626728e")
+
+// the fixture milestone, emitted when its side-tx passed in the block after the tx
+var milestone1Event = rangeEvent(EventTypeMilestone, "0x"+milestoneTxHash, 3887749, 3887762,
+	attrHash, milestone1Hash.String(), attrMilestoneID, "milestone-1")
+
+func TestRangeIndex(t *testing.T) {
+	var ri RangeIndex
+	for _, r := range [][2]uint64{{20, 29}, {0, 9}, {40, 40}, {10, 19}} {
+		require.NoError(t, ri.Insert(RangeEntry{StartBlock: r[0], EndBlock: r[1], TxHash: fmt.Sprint(r[0])}))
+	}
+	require.Equal(t, 4, ri.Len())
+	for b := uint64(0); b < 30; b++ {
+		e, err := ri.Find(b)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprint(b/10*10), e.TxHash)
+	}
+	e, err := ri.Find(40)
+	require.NoError(t, err)
+	require.Equal(t, "40", e.TxHash)
+	for _, b := range []uint64{30, 39, 41} {
+		_, err = ri.Find(b)
+		require.ErrorIs(t, err, ErrNotIndexed)
+	}
+
+	// re-inserting is fine, anything else overlapping isn't
+	require.NoError(t, ri.Insert(RangeEntry{StartBlock: 10, EndBlock: 19, TxHash: "10"}))
+	require.ErrorIs(t, ri.Insert(RangeEntry{StartBlock: 10, EndBlock: 19, TxHash: "other"}), ErrOverlappingSpan)
+	require.ErrorIs(t, ri.Insert(RangeEntry{StartBlock: 29, EndBlock: 35}), ErrOverlappingSpan)
+	require.ErrorIs(t, ri.Insert(RangeEntry{StartBlock: 35, EndBlock: 50}), ErrOverlappingSpan)
+	require.NoError(t, ri.Insert(RangeEntry{StartBlock: 30, EndBlock: 39}))
+	require.Equal(t, 5, ri.Len())
+}
+
+func TestParseRangeEvent(t *testing.T) {
+	e, ok, err := ParseRangeEvent(milestone1Event, 1588004)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, RangeEntry{
+		Kind:           EventTypeMilestone,
+		StartBlock:     3887749,
+		EndBlock:       3887762,
+		HeimdallHeight: 1588004,
+		TxHash:         milestoneTxHash,
+		RootHash:       milestone1Hash,
+		ID:             "milestone-1",
+	}, e)
+
+	// voted down, not from the post handler, or not a range event at all
+	for _, ev := range []abci.Event{
+		rangeEvent(EventTypeCheckpoint, "aa", 1, 2, attrSideTxResult, "No"),
+		{Type: EventTypeMilestone, Attributes: []cmn.KVPair{{Key: []byte(attrStartBlock), Value: []byte("1")}}},
+		{Type: "slashing"},
+	} {
+		_, ok, err = ParseRangeEvent(ev, 1)
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+
+	_, _, err = ParseRangeEvent(rangeEvent(EventTypeCheckpoint, "aa", 2, 1), 1)
+	require.Error(t, err)
+	_, _, err = ParseRangeEvent(rangeEvent(EventTypeCheckpoint, "aa", 1, 1, attrEndBlock, "x"), 1)
+	require.Error(t, err)
+}
+
+func TestRangeIndexer(t *testing.T) {
+	m := NewMockHeimdallClient()
+	m.AddBlock(testBlock(1588003), testEvents("message"))
+	m.AddBlock(testBlock(1588004), []abci.Event{milestone1Event})
+	m.AddBlock(testBlock(1588005), []abci.Event{
+		rangeEvent(EventTypeCheckpoint, "bb", 3887000, 3887999, attrRootHash, checkpoint2809Root),
+		rangeEvent(EventTypeMilestone, "cc", 3887763, 3887780, attrHash, "0x01"),
+	})
+
+	x := NewRangeIndexer(m)
+	require.NoError(t, x.IngestRange(context.Background(), 1588003, 1588005))
+	require.Equal(t, int64(1588005), x.LastHeight)
+	require.Equal(t, 2, x.Milestones.Len())
+	require.Equal(t, 1, x.Checkpoints.Len())
+
+	ms, err := x.FindMilestone(3887750)
+	require.NoError(t, err)
+	require.Equal(t, milestoneTxHash, ms.TxHash)
+	ms, err = x.FindMilestone(3887763)
+	require.NoError(t, err)
+	require.Equal(t, "cc", ms.TxHash)
+	_, err = x.FindMilestone(3887781)
+	require.ErrorIs(t, err, ErrNotIndexed)
+	cp, err := x.FindCheckpoint(3887762)
+	require.NoError(t, err)
+	require.Equal(t, checkpoint2809Root, cp.RootHash.String())
+
+	// the indexed milestone tx is the one the REST fixtures have
+	fx, err := NewFixtureHeimdallClient()
+	require.NoError(t, err)
+	ms, err = x.FindMilestone(3887762)
+	require.NoError(t, err)
+	tx, err := fx.GetTx(ms.TxHash)
+	require.NoError(t, err)
+	msg, err := tx.MsgMilestone()
+	require.NoError(t, err)
+	require.Equal(t, ms.RootHash, msg.Hash)
+
+	// save, reload and resume
+	path := filepath.Join(t.TempDir(), "index.json")
+	require.NoError(t, x.Save(path))
+	y, err := LoadRangeIndexer(m, path)
+	require.NoError(t, err)
+	require.Equal(t, x.LastHeight, y.LastHeight)
+	require.Equal(t, x.Milestones.Entries(), y.Milestones.Entries())
+	require.Equal(t, x.Checkpoints.Entries(), y.Checkpoints.Entries())
+
+	m.AddBlock(testBlock(1588006), []abci.Event{rangeEvent(EventTypeMilestone, "dd", 3887781, 3887790)})
+	require.NoError(t, y.IngestRange(context.Background(), y.LastHeight+1, 1588006))
+	ms, err = y.FindMilestone(3887785)
+	require.NoError(t, err)
+	require.Equal(t, int64(1588006), ms.HeimdallHeight)
+
+	// re-ingesting is idempotent, a conflicting range is not
+	require.NoError(t, y.IngestHeight(context.Background(), 1588004))
+	m.AddBlock(testBlock(1588007), []abci.Event{rangeEvent(EventTypeMilestone, "ee", 3887785, 3887795)})
+	require.ErrorIs(t, y.IngestHeight(context.Background(), 1588007), ErrOverlappingSpan)
+}
+
+func TestRangeIndexerReproposedCheckpoint(t *testing.T) {
+	m := NewMockHeimdallClient()
+	m.AddBlock(testBlock(100), []abci.Event{rangeEvent(EventTypeCheckpoint, "aa", 1000, 1255, attrRootHash, "0x01")})
+	m.AddBlock(testBlock(101), testEvents("message"))
+	// not acked in time, so proposed again from the same start block, with more blocks
+	m.AddBlock(testBlock(102), []abci.Event{rangeEvent(EventTypeCheckpoint, "bb", 1000, 1300, attrRootHash, "0x02")})
+	m.AddBlock(testBlock(103), []abci.Event{rangeEvent(EventTypeCheckpoint, "cc", 1301, 1400, attrRootHash, "0x03")})
+
+	x := NewRangeIndexer(m)
+	require.NoError(t, x.IngestRange(context.Background(), 100, 103))
+	require.Equal(t, 2, x.Checkpoints.Len())
+	cp, err := x.FindCheckpoint(1100)
+	require.NoError(t, err)
+	require.Equal(t, "bb", cp.TxHash)
+	require.Equal(t, int64(102), cp.HeimdallHeight)
+	cp, err = x.FindCheckpoint(1280)
+	require.NoError(t, err)
+	require.Equal(t, "bb", cp.TxHash)
+	require.Len(t, x.Checkpoints.Superseded(), 1)
+	require.Equal(t, "aa", x.Checkpoints.Superseded()[0].TxHash)
+
+	// re-ingesting either proposal changes nothing
+	require.NoError(t, x.IngestRange(context.Background(), 100, 102))
+	require.Equal(t, 2, x.Checkpoints.Len())
+	require.Len(t, x.Checkpoints.Superseded(), 1)
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	require.NoError(t, x.Save(path))
+	y, err := LoadRangeIndexer(m, path)
+	require.NoError(t, err)
+	require.Equal(t, x.Checkpoints.Entries(), y.Checkpoints.Entries())
+	require.Equal(t, x.Checkpoints.Superseded(), y.Checkpoints.Superseded())
+
+	// an older proposal ingested after the one that replaced it is kept as superseded
+	var ri RangeIndex
+	later := RangeEntry{Kind: EventTypeCheckpoint, StartBlock: 10, EndBlock: 30, HeimdallHeight: 5, TxHash: "later"}
+	earlier := RangeEntry{Kind: EventTypeCheckpoint, StartBlock: 10, EndBlock: 20, HeimdallHeight: 3, TxHash: "earlier"}
+	require.NoError(t, ri.Insert(later))
+	require.NoError(t, ri.Insert(earlier))
+	require.Equal(t, []RangeEntry{later}, ri.Entries())
+	require.Equal(t, []RangeEntry{earlier}, ri.Superseded())
+
+	// only checkpoints from the same start block replace each other
+	require.ErrorIs(t, ri.Insert(RangeEntry{Kind: EventTypeCheckpoint, StartBlock: 11, EndBlock: 30, HeimdallHeight: 6}), ErrOverlappingSpan)
+	require.ErrorIs(t, ri.Insert(RangeEntry{Kind: EventTypeCheckpoint, StartBlock: 10, EndBlock: 30, HeimdallHeight: 5}), ErrOverlappingSpan)
+	var ms RangeIndex
+	require.NoError(t, ms.Insert(RangeEntry{Kind: EventTypeMilestone, StartBlock: 10, EndBlock: 20, HeimdallHeight: 3}))
+	require.ErrorIs(t, ms.Insert(RangeEntry{Kind: EventTypeMilestone, StartBlock: 10, EndBlock: 25, HeimdallHeight: 4}), ErrOverlappingSpan)
+}
@@ -0,0 +1,180 @@
+package heimdall
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/umbracle/ethgo"
+	"math/big"
+)
+
+var (
+	ErrInvalidLightProof = errors.New("invalid light proof")
+	// ErrStateRootNotCommitted is returned for a state proof whose header leaves don't include the state root, so the
+	// signatures say nothing about the state.
+	ErrStateRootNotCommitted = errors.New("header version does not commit to the state root")
+)
+
+// StorageProof is one storage slot of an eth_getProof response.
+type StorageProof struct {
+	Key   common.Hash     `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// AccountProof is an eth_getProof response.
+type AccountProof struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageProof  `json:"storageProof"`
+}
+
+func proofDB(nodes []hexutil.Bytes) *memorydb.Database {
+	db := memorydb.New()
+	for _, n := range nodes {
+		_ = db.Put(crypto.Keccak256(n), n)
+	}
+	return db
+}
+
+// Verify checks the account and its storage slots against a state root. An account or slot that isn't in the
+// trie has to be claimed as empty.
+func (ap *AccountProof) Verify(stateRoot common.Hash) (err error) {
+	var enc []byte
+	if enc, err = trie.VerifyProof(stateRoot, crypto.Keccak256(ap.Address[:]), proofDB(ap.AccountProof)); err != nil {
+		return fmt.Errorf("%w: account %v: %v", ErrInvalidLightProof, ap.Address, err)
+	}
+	if ap.Balance == nil {
+		return fmt.Errorf("%w: account %v has no balance", ErrInvalidLightProof, ap.Address)
+	}
+	acc := types.StateAccount{Root: types.EmptyRootHash, CodeHash: types.EmptyCodeHash[:]}
+	if enc != nil {
+		if err = rlp.DecodeBytes(enc, &acc); err != nil {
+			return fmt.Errorf("%w: account %v: %v", ErrInvalidLightProof, ap.Address, err)
+		}
+	}
+	var balance big.Int
+	if acc.Balance != nil {
+		balance.Set(acc.Balance.ToBig())
+	}
+	if uint64(ap.Nonce) != acc.Nonce || ap.Balance.ToInt().Cmp(&balance) != 0 || ap.StorageHash != acc.Root ||
+		!bytes.Equal(ap.CodeHash[:], acc.CodeHash) {
+		return fmt.Errorf("%w: account %v does not match the proof", ErrInvalidLightProof, ap.Address)
+	}
+	for _, sp := range ap.StorageProof {
+		if sp.Value == nil {
+			return fmt.Errorf("%w: slot %v has no value", ErrInvalidLightProof, sp.Key)
+		}
+		if enc, err = trie.VerifyProof(ap.StorageHash, crypto.Keccak256(sp.Key[:]), proofDB(sp.Proof)); err != nil {
+			return fmt.Errorf("%w: slot %v: %v", ErrInvalidLightProof, sp.Key, err)
+		}
+		var value []byte
+		if enc != nil {
+			if err = rlp.DecodeBytes(enc, &value); err != nil {
+				return fmt.Errorf("%w: slot %v: %v", ErrInvalidLightProof, sp.Key, err)
+			}
+		}
+		if new(big.Int).SetBytes(value).Cmp(sp.Value.ToInt()) != 0 {
+			return fmt.Errorf("%w: slot %v does not match the proof", ErrInvalidLightProof, sp.Key)
+		}
+	}
+	return nil
+}
+
+// LightProof bundles everything needed to check Bor state offline, given only a trusted validator set: an account
+// proof against a block's state root, the block header, the header's path into a checkpoint root and the checkpoint
+// side-tx signed by the validators. Milestones sign the hash of their end block rather than a root of header leaves,
+// so their side-txs don't verify.
+type LightProof struct {
+	// Account is optional - without it the bundle only proves the header.
+	Account     *AccountProof   `json:"account,omitempty"`
+	HeaderRLP   hexutil.Bytes   `json:"header_rlp"`
+	HeaderProof *HeaderProof    `json:"header_proof"`
+	SideTx      *SideTxResponse `json:"side_tx"`
+}
+
+// LightProofResult is what a verified light proof attests to.
+type LightProofResult struct {
+	Header     *types.Header
+	RootHash   ethgo.Hash
+	Signatures *SignatureReport
+}
+
+// headerBlock is the part of a header that header leaves are computed from.
+func headerBlock(h *types.Header) *ethgo.Block {
+	return &ethgo.Block{
+		Number:           h.Number.Uint64(),
+		Timestamp:        h.Time,
+		TransactionsRoot: ethgo.Hash(h.TxHash),
+		ReceiptsRoot:     ethgo.Hash(h.ReceiptHash),
+		StateRoot:        ethgo.Hash(h.Root),
+		Hash:             ethgo.Hash(h.Hash()),
+	}
+}
+
+// NewLightProof assembles a light proof for header, which has to be one of blocks - the full block range of the
+// checkpoint signed in stx.
+func NewLightProof(header *types.Header, blocks []*ethgo.Block, version HeaderVersion, stx *SideTxResponse, account *AccountProof) (lp *LightProof, err error) {
+	lp = &LightProof{Account: account, SideTx: stx}
+	if lp.HeaderRLP, err = rlp.EncodeToBytes(header); err != nil {
+		return
+	}
+	if lp.HeaderProof, _, err = BuildHeaderProof(blocks, header.Number.Uint64(), version); err != nil {
+		return
+	}
+	return
+}
+
+// Verify checks every link of the proof: the account against the header's state root, the header against the
+// checkpoint root, the checkpoint root and range against the signed side-tx data, and the signatures against vs. The
+// signatures have to be from more than 2/3 of the voting power.
+func (lp *LightProof) Verify(vs *ValidatorSet) (res *LightProofResult, err error) {
+	if lp.HeaderProof == nil || lp.SideTx == nil {
+		return nil, fmt.Errorf("%w: missing header proof or side-tx", ErrInvalidLightProof)
+	}
+	res = &LightProofResult{Header: &types.Header{}}
+	if err = rlp.DecodeBytes(lp.HeaderRLP, res.Header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidLightProof, err)
+	}
+
+	if lp.Account != nil {
+		if lp.HeaderProof.Version.orV1() == HeaderV1 {
+			return nil, ErrStateRootNotCommitted
+		}
+		if err = lp.Account.Verify(res.Header.Root); err != nil {
+			return nil, err
+		}
+	}
+
+	var signed *CheckpointData
+	if signed, err = DecodeCheckpointData(lp.SideTx.Data); err != nil {
+		return nil, fmt.Errorf("%w: side-tx data: %v", ErrInvalidLightProof, err)
+	}
+	if signed.Start.Uint64() != lp.HeaderProof.StartBlock || signed.End.Uint64() != lp.HeaderProof.EndBlock {
+		return nil, fmt.Errorf("%w: side-tx is for blocks [%v, %v], header proof for [%v, %v]", ErrInvalidLightProof,
+			signed.Start, signed.End, lp.HeaderProof.StartBlock, lp.HeaderProof.EndBlock)
+	}
+	if err = lp.HeaderProof.VerifyBlock(headerBlock(res.Header), signed.RootHash); err != nil {
+		return nil, err
+	}
+	res.RootHash = signed.RootHash
+
+	if res.Signatures, err = VerifySideTxSigs(NewSideTxYesVote(nil, lp.SideTx.Data), lp.SideTx.Sigs, vs); err != nil {
+		return nil, err
+	}
+	if !res.Signatures.Quorum {
+		return nil, fmt.Errorf("%w: %v of %v", ErrNoQuorum, res.Signatures.SignedPower, res.Signatures.TotalPower)
+	}
+	return
+}
@@ -0,0 +1,294 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/ethereum/go-ethereum/triedb"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"math/big"
+	"testing"
+)
+
+func proveKey(t *testing.T, tr *trie.Trie, key []byte) (proof []hexutil.Bytes) {
+	db := memorydb.New()
+	require.NoError(t, tr.Prove(crypto.Keccak256(key), db))
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		proof = append(proof, common.CopyBytes(it.Value()))
+	}
+	return
+}
+
+func newTestTrie() *trie.Trie {
+	return trie.NewEmpty(triedb.NewDatabase(rawdb.NewMemoryDatabase(), nil))
+}
+
+// testState is a state trie with one account holding two storage slots, and an eth_getProof for the account, one
+// of its slots and one empty slot.
+func testState(t *testing.T) (root common.Hash, ap *AccountProof) {
+	addr := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	slot, emptySlot := common.HexToHash("0x01"), common.HexToHash("0x02")
+	storage := newTestTrie()
+	for k, v := range map[common.Hash]int64{slot: 0x1234, common.HexToHash("0x03"): 7} {
+		enc, err := rlp.EncodeToBytes(big.NewInt(v).Bytes())
+		require.NoError(t, err)
+		storage.MustUpdate(crypto.Keccak256(k[:]), enc)
+	}
+
+	acc := &types.StateAccount{
+		Nonce:    3,
+		Balance:  uint256.NewInt(1e18),
+		Root:     storage.Hash(),
+		CodeHash: crypto.Keccak256([]byte{0x60, 0x00}),
+	}
+	state := newTestTrie()
+	enc, err := rlp.EncodeToBytes(acc)
+	require.NoError(t, err)
+	state.MustUpdate(crypto.Keccak256(addr[:]), enc)
+	other := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	enc, err = rlp.EncodeToBytes(&types.StateAccount{Balance: uint256.NewInt(1), Root: types.EmptyRootHash, CodeHash: types.EmptyCodeHash[:]})
+	require.NoError(t, err)
+	state.MustUpdate(crypto.Keccak256(other[:]), enc)
+
+	ap = &AccountProof{
+		Address:      addr,
+		AccountProof: proveKey(t, state, addr[:]),
+		Balance:      (*hexutil.Big)(big.NewInt(1e18)),
+		CodeHash:     common.BytesToHash(acc.CodeHash),
+		Nonce:        3,
+		StorageHash:  acc.Root,
+		StorageProof: []StorageProof{
+			{Key: slot, Value: (*hexutil.Big)(big.NewInt(0x1234)), Proof: proveKey(t, storage, slot[:])},
+			{Key: emptySlot, Value: (*hexutil.Big)(new(big.Int)), Proof: proveKey(t, storage, emptySlot[:])},
+		},
+	}
+	return state.Hash(), ap
+}
+
+func TestAccountProof(t *testing.T) {
+	root, ap := testState(t)
+	require.NoError(t, ap.Verify(root))
+
+	require.ErrorIs(t, ap.Verify(common.HexToHash("0x01")), ErrInvalidLightProof)
+
+	wrong := *ap
+	wrong.Balance = (*hexutil.Big)(big.NewInt(2e18))
+	require.ErrorIs(t, wrong.Verify(root), ErrInvalidLightProof)
+
+	wrong = *ap
+	wrong.StorageProof = []StorageProof{ap.StorageProof[0]}
+	wrong.StorageProof[0].Value = (*hexutil.Big)(big.NewInt(0x1235))
+	require.ErrorIs(t, wrong.Verify(root), ErrInvalidLightProof)
+
+	// an account that isn't there proves as empty
+	missing := &AccountProof{
+		Address:      common.HexToAddress("0x0c"),
+		AccountProof: ap.AccountProof,
+		Balance:      (*hexutil.Big)(new(big.Int)),
+		CodeHash:     types.EmptyCodeHash,
+		StorageHash:  types.EmptyRootHash,
+	}
+	require.NoError(t, missing.Verify(root))
+	missing.Nonce = 1
+	require.ErrorIs(t, missing.Verify(root), ErrInvalidLightProof)
+}
+
+// testCheckpoint is a signed v2 checkpoint for blocks [100, 107], where block 103 has the given state root.
+func testCheckpoint(t *testing.T, stateRoot common.Hash, sigCount int) (header *types.Header, blocks []*ethgo.Block, stx *SideTxResponse, vs *ValidatorSet) {
+	for n := uint64(100); n <= 107; n++ {
+		h := &types.Header{
+			Number:      new(big.Int).SetUint64(n),
+			Time:        1700000000 + 2*n,
+			Difficulty:  big.NewInt(1),
+			TxHash:      types.EmptyTxsHash,
+			ReceiptHash: types.EmptyReceiptsHash,
+			Root:        common.BigToHash(new(big.Int).SetUint64(n)),
+			Extra:       make([]byte, 97),
+		}
+		if n == 103 {
+			h.Root = stateRoot
+			header = h
+		}
+		blocks = append(blocks, headerBlock(h))
+	}
+	_, root, err := BuildHeaderProof(blocks, 100, HeaderV2)
+	require.NoError(t, err)
+
+	data, err := (&CheckpointData{
+		Start:      big.NewInt(100),
+		End:        big.NewInt(107),
+		RootHash:   root,
+		BorChainID: big.NewInt(80002),
+	}).Encode()
+	require.NoError(t, err)
+	keys, vs := testSigners(t, 4)
+	stx = &SideTxResponse{Data: data, Sigs: signSideTx(t, keys[:sigCount], data)}
+	return
+}
+
+func TestLightProof(t *testing.T) {
+	stateRoot, ap := testState(t)
+	header, blocks, stx, vs := testCheckpoint(t, stateRoot, 3)
+
+	lp, err := NewLightProof(header, blocks, HeaderV2, stx, ap)
+	require.NoError(t, err)
+	res, err := lp.Verify(vs)
+	require.NoError(t, err)
+	require.Equal(t, header.Hash(), res.Header.Hash())
+	require.Equal(t, int64(300), res.Signatures.SignedPower)
+
+	// the bundle is self contained
+	data, err := json.Marshal(lp)
+	require.NoError(t, err)
+	var decoded LightProof
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	_, err = decoded.Verify(vs)
+	require.NoError(t, err)
+
+	// a header with another state root isn't in the checkpoint
+	other := types.CopyHeader(header)
+	other.Root = common.HexToHash("0x01")
+	bad := *lp
+	bad.HeaderRLP, _ = rlp.EncodeToBytes(other)
+	bad.Account = nil
+	_, err = bad.Verify(vs)
+	require.ErrorIs(t, err, ErrInvalidHeaderProof)
+
+	// v2 leaves don't commit to the rest of the header, so a header differing elsewhere still verifies
+	other = types.CopyHeader(header)
+	other.Extra = make([]byte, 98)
+	bad.HeaderRLP, _ = rlp.EncodeToBytes(other)
+	_, err = bad.Verify(vs)
+	require.NoError(t, err)
+
+	// an account proof from some other state
+	_, otherAp := testState(t)
+	otherAp.Nonce = 4
+	bad = *lp
+	bad.Account = otherAp
+	_, err = bad.Verify(vs)
+	require.ErrorIs(t, err, ErrInvalidLightProof)
+
+	// v1 headers say nothing about state
+	v1, err := NewLightProof(header, blocks, HeaderV1, stx, ap)
+	require.NoError(t, err)
+	_, err = v1.Verify(vs)
+	require.ErrorIs(t, err, ErrStateRootNotCommitted)
+
+	// the header proof has to be for the signed range
+	bad = *lp
+	bad.HeaderProof, _, err = BuildHeaderProof(blocks[:4], header.Number.Uint64(), HeaderV2)
+	require.NoError(t, err)
+	_, err = bad.Verify(vs)
+	require.ErrorIs(t, err, ErrInvalidLightProof)
+
+	// 2 of 4 validators is not enough
+	_, _, stx, _ = testCheckpoint(t, stateRoot, 2)
+	bad = *lp
+	bad.SideTx = stx
+	_, err = bad.Verify(vs)
+	require.ErrorIs(t, err, ErrNoQuorum)
+}
+
+func TestLightProofMissingFields(t *testing.T) {
+	stateRoot, ap := testState(t)
+	header, blocks, stx, vs := testCheckpoint(t, stateRoot, 3)
+	lp, err := NewLightProof(header, blocks, HeaderV2, stx, ap)
+	require.NoError(t, err)
+	require.NotEmpty(t, lp.Account.StorageProof)
+
+	for _, drop := range []func(account map[string]interface{}){
+		func(account map[string]interface{}) { delete(account, "balance") },
+		func(account map[string]interface{}) {
+			delete(account["storageProof"].([]interface{})[0].(map[string]interface{}), "value")
+		},
+	} {
+		data, err := json.Marshal(lp)
+		require.NoError(t, err)
+		var bundle map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &bundle))
+		drop(bundle["account"].(map[string]interface{}))
+		data, err = json.Marshal(bundle)
+		require.NoError(t, err)
+
+		var decoded LightProof
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		_, err = decoded.Verify(vs)
+		require.ErrorIs(t, err, ErrInvalidLightProof)
+	}
+}
+
+// testCheckpoint2809 is block 3639700 of the real checkpoint 2809, all of its blocks, and its real data signed in the
+// checkpoint layout by 3 of 4 test validators.
+func testCheckpoint2809(t *testing.T) (header *types.Header, blocks []*ethgo.Block, stx *SideTxResponse, vs *ValidatorSet) {
+	var err error
+	blocks, err = loadCheckpointBlocks()
+	require.NoError(t, err)
+	for _, h := range loadBorHeaders(t) {
+		if h.Number.Uint64() == 3639700 {
+			header = h
+		}
+	}
+	require.NotNil(t, header)
+	cp, _, err := DecodeCheckpointResponse(checkpoint2809Data)
+	require.NoError(t, err)
+	chainID, _ := new(big.Int).SetString(cp.BorChainID, 10)
+	data, err := (&CheckpointData{
+		Proposer:   ethgo.Address(cp.Proposer),
+		Start:      new(big.Int).SetUint64(cp.StartBlock),
+		End:        new(big.Int).SetUint64(cp.EndBlock),
+		RootHash:   cp.RootHash,
+		BorChainID: chainID,
+	}).Encode()
+	require.NoError(t, err)
+	keys, vs := testSigners(t, 4)
+	stx = &SideTxResponse{Data: data, Sigs: signSideTx(t, keys[:3], data)}
+	return
+}
+
+// TestLightProofCheckpoint2809 proves a real Amoy header against the real root of checkpoint 2809.
+func TestLightProofCheckpoint2809(t *testing.T) {
+	header, blocks, stx, vs := testCheckpoint2809(t)
+	lp, err := NewLightProof(header, blocks, HeaderV1, stx, nil)
+	require.NoError(t, err)
+	res, err := lp.Verify(vs)
+	require.NoError(t, err)
+	require.Equal(t, ethgo.HexToHash(checkpoint2809Root), res.RootHash)
+	require.Equal(t, header.Hash(), res.Header.Hash())
+
+	// a header from another time isn't in the checkpoint
+	other := types.CopyHeader(header)
+	other.Time++
+	bad := *lp
+	bad.HeaderRLP, _ = rlp.EncodeToBytes(other)
+	_, err = bad.Verify(vs)
+	require.ErrorIs(t, err, ErrInvalidHeaderProof)
+
+	// a milestone signs the hash of its end block, not a root of the headers, so neither the real milestone side-tx1
+	// nor one for this range reads as a checkpoint
+	milestone, _, err := DecodeSideTxResponse(sideTxData)
+	require.NoError(t, err)
+	_, err = DecodeCheckpointData(milestone.Data)
+	require.ErrorIs(t, err, ErrNotCheckpointData)
+	signed, err := DecodeCheckpointData(stx.Data)
+	require.NoError(t, err)
+	milestoneType := abi.MustNewType("tuple(address, uint256, uint256, bytes32, uint256, uint256)")
+	data, err := milestoneType.Encode([]interface{}{signed.Proposer, signed.Start, signed.End, blocks[len(blocks)-1].Hash, signed.BorChainID, 0})
+	require.NoError(t, err)
+	keys, _ := testSigners(t, 4)
+	bad = *lp
+	bad.SideTx = &SideTxResponse{Data: data, Sigs: signSideTx(t, keys[:3], data)}
+	_, err = bad.Verify(vs)
+	require.ErrorIs(t, err, ErrInvalidLightProof)
+}
@@ -0,0 +1,185 @@
+package heimdall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"sort"
+)
+
+const QueryMilestoneByNumber = "custom/checkpoint/milestone-by-number"
+
+var (
+	ErrMilestoneGap      = errors.New("milestone is not in continuity")
+	ErrMilestoneConflict = errors.New("conflicting milestones")
+	ErrMilestoneHash     = errors.New("milestone hash does not match the bor blocks")
+	ErrMilestoneInvalid  = errors.New("invalid milestone")
+)
+
+// GetMilestone queries milestone number at a Heimdall height, or the latest height if it is zero.
+func GetMilestone(client HeimdallClient, number uint64, height int64) (m *Milestone, err error) {
+	var value []byte
+	if value, err = queryAt(client, QueryMilestoneByNumber, []byte(fmt.Sprintf(`{"number":%v}`, number)), height); err != nil {
+		return
+	}
+	return DecodeMilestoneQuery(value)
+}
+
+// MilestoneHasher computes the hash of a milestone from its Bor blocks.
+type MilestoneHasher func(blocks []*ethgo.Block) (ethgo.Hash, error)
+
+// MilestoneEndBlockHash is the hash Bor votes on for a milestone: the hash of its end block.
+func MilestoneEndBlockHash(blocks []*ethgo.Block) (ethgo.Hash, error) {
+	if len(blocks) == 0 {
+		return ethgo.Hash{}, errors.New("empty block range")
+	}
+	return blocks[len(blocks)-1].Hash, nil
+}
+
+// MilestoneRootHash is the checkpoint root hash over the milestone's headers.
+func MilestoneRootHash(blocks []*ethgo.Block) (hash ethgo.Hash, err error) {
+	var root string
+	if root, err = getRootHash(func() ([]*ethgo.Block, error) { return blocks, nil }, HeaderV1); err != nil {
+		return
+	}
+	return ethgo.HexToHash(root), nil
+}
+
+// MilestoneChain checks a sequence of milestones as Heimdall accepts them: each one starts right after the last one
+// ends and is at least MinLength blocks long. The same milestone seen again is ignored, but one that ends inside an
+// accepted milestone, or overlaps one with another hash, is a conflict - Bor reorged, or the source of the
+// milestones is not to be trusted. Any other milestone that doesn't start right after the last one is a gap.
+type MilestoneChain struct {
+	// MinLength is Heimdall's milestone length parameter, not checked if zero.
+	MinLength uint64
+	// Source, if set, is used to recompute the hash of every milestone with Hasher.
+	Source BlockSource
+	// Hasher defaults to MilestoneEndBlockHash.
+	Hasher MilestoneHasher
+
+	milestones []*Milestone
+}
+
+// Milestones are the accepted milestones, in order.
+func (c *MilestoneChain) Milestones() []*Milestone {
+	return c.milestones
+}
+
+// Last is the last accepted milestone, or nil.
+func (c *MilestoneChain) Last() *Milestone {
+	if len(c.milestones) == 0 {
+		return nil
+	}
+	return c.milestones[len(c.milestones)-1]
+}
+
+// Add checks m against the chain, and accepts it if it continues the chain.
+func (c *MilestoneChain) Add(ctx context.Context, m *Milestone) (err error) {
+	if m.EndBlock < m.StartBlock {
+		return fmt.Errorf("%w: %v ends at %v before it starts at %v", ErrMilestoneInvalid, m.MilestoneID, m.EndBlock, m.StartBlock)
+	}
+	if c.MinLength > 0 && m.EndBlock-m.StartBlock+1 < c.MinLength {
+		return fmt.Errorf("%w: %v is %v blocks, less than %v", ErrMilestoneInvalid, m.MilestoneID,
+			m.EndBlock-m.StartBlock+1, c.MinLength)
+	}
+
+	if prev, ok := c.covering(m.EndBlock); ok {
+		if prev.StartBlock == m.StartBlock && prev.EndBlock == m.EndBlock && prev.Hash == m.Hash {
+			return
+		}
+		return fmt.Errorf("%w: %v [%v, %v] ends in %v [%v, %v], with hashes %v and %v", ErrMilestoneConflict,
+			m.MilestoneID, m.StartBlock, m.EndBlock, prev.MilestoneID, prev.StartBlock, prev.EndBlock, m.Hash, prev.Hash)
+	}
+	for _, prev := range c.overlapping(m.StartBlock, m.EndBlock) {
+		if prev.Hash != m.Hash {
+			return fmt.Errorf("%w: %v [%v, %v] overlaps %v [%v, %v], with hashes %v and %v", ErrMilestoneConflict,
+				m.MilestoneID, m.StartBlock, m.EndBlock, prev.MilestoneID, prev.StartBlock, prev.EndBlock, m.Hash, prev.Hash)
+		}
+	}
+	if last := c.Last(); last != nil && m.StartBlock != last.EndBlock+1 {
+		return fmt.Errorf("%w: %v starts at %v, the last milestone %v ends at %v", ErrMilestoneGap, m.MilestoneID,
+			m.StartBlock, last.MilestoneID, last.EndBlock)
+	}
+
+	if c.Source != nil {
+		if err = c.checkHash(ctx, m); err != nil {
+			return
+		}
+	}
+	c.milestones = append(c.milestones, m)
+	return
+}
+
+// overlapping are the accepted milestones whose ranges overlap [start, end].
+func (c *MilestoneChain) overlapping(start, end uint64) []*Milestone {
+	i := sort.Search(len(c.milestones), func(i int) bool { return c.milestones[i].EndBlock >= start })
+	j := i
+	for j < len(c.milestones) && c.milestones[j].StartBlock <= end {
+		j++
+	}
+	return c.milestones[i:j]
+}
+
+// covering is the accepted milestone whose range covers borBlock.
+func (c *MilestoneChain) covering(borBlock uint64) (m *Milestone, ok bool) {
+	i := sort.Search(len(c.milestones), func(i int) bool { return c.milestones[i].EndBlock >= borBlock })
+	if i == len(c.milestones) || c.milestones[i].StartBlock > borBlock {
+		return
+	}
+	return c.milestones[i], true
+}
+
+func (c *MilestoneChain) checkHash(ctx context.Context, m *Milestone) (err error) {
+	var blocks []*ethgo.Block
+	if err = c.Source.Blocks(ctx, m.StartBlock, m.EndBlock, func(b *ethgo.Block) error {
+		blocks = append(blocks, b)
+		return nil
+	}); err != nil {
+		return
+	}
+	hasher := c.Hasher
+	if hasher == nil {
+		hasher = MilestoneEndBlockHash
+	}
+	var hash ethgo.Hash
+	if hash, err = hasher(blocks); err != nil {
+		return
+	}
+	if hash != m.Hash {
+		return fmt.Errorf("%w: %v [%v, %v] is %v, the blocks hash to %v", ErrMilestoneHash, m.MilestoneID,
+			m.StartBlock, m.EndBlock, m.Hash, hash)
+	}
+	return
+}
+
+// Finality is the milestone that finalized borBlock. ok is false if no accepted milestone covers it yet.
+func (c *MilestoneChain) Finality(borBlock uint64) (m *Milestone, ok bool) {
+	return c.covering(borBlock)
+}
+
+// FinalizedBlock is the last Bor block finalized by a milestone, or zero.
+func (c *MilestoneChain) FinalizedBlock() uint64 {
+	if last := c.Last(); last != nil {
+		return last.EndBlock
+	}
+	return 0
+}
+
+// IngestMilestones queries milestones from to to and adds them to the chain, stopping at the first that can't be
+// fetched or isn't accepted.
+func (c *MilestoneChain) IngestMilestones(ctx context.Context, client HeimdallClient, from, to uint64, height int64) (err error) {
+	for number := from; number <= to; number++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var m *Milestone
+		if m, err = GetMilestone(client, number, height); err != nil {
+			return fmt.Errorf("milestone %v: %w", number, err)
+		}
+		if err = c.Add(ctx, m); err != nil {
+			return fmt.Errorf("milestone %v: %w", number, err)
+		}
+	}
+	return
+}
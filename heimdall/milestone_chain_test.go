@@ -0,0 +1,143 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testMilestones splits the checkpoint 2809 blocks into milestones at the given end blocks, hashed with hasher.
+func testMilestones(t *testing.T, hasher MilestoneHasher, ends ...uint64) (ms []*Milestone) {
+	blocks, err := loadCheckpointBlocks()
+	require.NoError(t, err)
+	start := uint64(checkpoint2809Start)
+	for i, end := range ends {
+		hash, err := hasher(blocks[start-checkpoint2809Start : end-checkpoint2809Start+1])
+		require.NoError(t, err)
+		ms = append(ms, &Milestone{
+			Proposer:    HeimdallAddress(ethgo.HexToAddress("0x4ad84f7014b7b44f723f284a85b1662337971439")),
+			StartBlock:  start,
+			EndBlock:    end,
+			Hash:        hash,
+			BorChainID:  "80002",
+			MilestoneID: fmt.Sprintf("milestone-%v", i+1),
+		})
+		start = end + 1
+	}
+	return
+}
+
+func testBlockSource(t *testing.T) BlockSource {
+	path := filepath.Join(t.TempDir(), "blocks.ndjson")
+	require.NoError(t, os.WriteFile(path, checkPointData, 0644))
+	return &NdjsonBlockSource{Path: path}
+}
+
+func TestMilestoneChain(t *testing.T) {
+	ctx := context.Background()
+	ms := testMilestones(t, MilestoneEndBlockHash, 3639430, 3639450, 3639480, 3639500)
+
+	c := &MilestoneChain{MinLength: 12, Source: testBlockSource(t)}
+	require.Equal(t, uint64(0), c.FinalizedBlock())
+	_, ok := c.Finality(checkpoint2809Start)
+	require.False(t, ok)
+	for _, m := range ms[:3] {
+		require.NoError(t, c.Add(ctx, m))
+	}
+	// seen again
+	require.NoError(t, c.Add(ctx, ms[1]))
+	require.Len(t, c.Milestones(), 3)
+	require.Equal(t, uint64(3639480), c.FinalizedBlock())
+
+	m, ok := c.Finality(3639431)
+	require.True(t, ok)
+	require.Equal(t, "milestone-2", m.MilestoneID)
+	m, ok = c.Finality(3639430)
+	require.True(t, ok)
+	require.Equal(t, "milestone-1", m.MilestoneID)
+	_, ok = c.Finality(3639481)
+	require.False(t, ok)
+
+	// a reorg: the same range with another hash
+	reorged := *ms[1]
+	reorged.MilestoneID, reorged.Hash = "milestone-2b", ethgo.HexToHash("0x01")
+	require.ErrorIs(t, c.Add(ctx, &reorged), ErrMilestoneConflict)
+
+	// ending inside an accepted milestone, whatever the hash
+	inside := *ms[1]
+	inside.StartBlock += 2
+	require.ErrorIs(t, c.Add(ctx, &inside), ErrMilestoneConflict)
+	shorter := *ms[1]
+	shorter.EndBlock -= 2
+	shorter.Hash = ethgo.HexToHash("0x03")
+	require.ErrorIs(t, c.Add(ctx, &shorter), ErrMilestoneConflict)
+	spans := *ms[0]
+	spans.EndBlock = ms[1].EndBlock - 1
+	require.ErrorIs(t, c.Add(ctx, &spans), ErrMilestoneConflict)
+
+	// overlapping the last milestone past its end: a conflict with another hash, else a gap
+	overlap := *ms[3]
+	overlap.StartBlock -= 5
+	require.ErrorIs(t, c.Add(ctx, &overlap), ErrMilestoneConflict)
+	extends := *ms[2]
+	extends.EndBlock = ms[3].EndBlock
+	require.ErrorIs(t, c.Add(ctx, &extends), ErrMilestoneGap)
+	gap := *ms[3]
+	gap.StartBlock++
+	require.ErrorIs(t, c.Add(ctx, &gap), ErrMilestoneGap)
+	require.Len(t, c.Milestones(), 3)
+
+	short := *ms[3]
+	short.EndBlock = short.StartBlock + 10
+	require.ErrorIs(t, c.Add(ctx, &short), ErrMilestoneInvalid)
+	backwards := *ms[3]
+	backwards.EndBlock = backwards.StartBlock - 1
+	require.ErrorIs(t, c.Add(ctx, &backwards), ErrMilestoneInvalid)
+
+	// the hash is recomputed from the blocks
+	wrongHash := *ms[3]
+	wrongHash.Hash = ms[2].Hash
+	require.ErrorIs(t, c.Add(ctx, &wrongHash), ErrMilestoneHash)
+	require.NoError(t, c.Add(ctx, ms[3]))
+	require.Equal(t, uint64(3639500), c.FinalizedBlock())
+
+	// with the checkpoint root hash scheme
+	rootMs := testMilestones(t, MilestoneRootHash, 3639430, 3639450)
+	c = &MilestoneChain{Source: testBlockSource(t)}
+	require.ErrorIs(t, c.Add(ctx, rootMs[0]), ErrMilestoneHash)
+	c.Hasher = MilestoneRootHash
+	require.NoError(t, c.Add(ctx, rootMs[0]))
+	require.NoError(t, c.Add(ctx, rootMs[1]))
+	all := testMilestones(t, MilestoneRootHash, checkpoint2809End)
+	require.Equal(t, checkpoint2809Root, all[0].Hash.String())
+}
+
+func TestMilestoneChainIngest(t *testing.T) {
+	ms := testMilestones(t, MilestoneEndBlockHash, 3639430, 3639450, 3639480)
+	m := NewMockHeimdallClient()
+	for i, ms := range ms {
+		value, err := json.Marshal(ms)
+		require.NoError(t, err)
+		m.AddQuery(QueryMilestoneByNumber, []byte(fmt.Sprintf(`{"number":%v}`, i+1)), value)
+	}
+	got, err := GetMilestone(m, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, ms[1], got)
+
+	c := &MilestoneChain{Source: testBlockSource(t)}
+	require.NoError(t, c.IngestMilestones(context.Background(), m, 1, 3, 0))
+	require.Equal(t, uint64(3639480), c.FinalizedBlock())
+	require.ErrorContains(t, c.IngestMilestones(context.Background(), m, 4, 4, 0), "milestone 4")
+
+	// a node that serves a reorged milestone 2
+	reorged := *ms[1]
+	reorged.Hash = ethgo.HexToHash("0x02")
+	value, _ := json.Marshal(&reorged)
+	m.AddQuery(QueryMilestoneByNumber, []byte(`{"number":2}`), value)
+	require.ErrorIs(t, c.IngestMilestones(context.Background(), m, 1, 3, 0), ErrMilestoneConflict)
+}
@@ -3,117 +3,149 @@ package heimdall
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/pkg/errors"
 	abci "github.com/tendermint/tendermint/abci/types"
 	logger "github.com/tendermint/tendermint/libs/log"
-	httpClient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
 	tmTypes "github.com/tendermint/tendermint/types"
 	"sort"
 	"time"
 )
 
-var Logger logger.Logger
+// Logger is the default logger of the query functions, for contexts without one from WithLogger.
+var Logger logger.Logger = logger.NewNopLogger()
 
 const (
-	// CommitTimeout commit timeout
+	// CommitTimeout is how long a query waits for a future block when the caller's context has no deadline.
 	CommitTimeout = 2 * time.Minute
 )
 
-// GetBlockWithClient get block through per height
-func GetBlockWithClient(client *httpClient.HTTP, height int64) (*tmTypes.Block, error) {
-	c, cancel := context.WithTimeout(context.Background(), CommitTimeout)
-	defer cancel()
-
-	// get block using client
-	block, err := client.Block(&height)
-	if err == nil && block != nil {
-		return block.Block, nil
-	}
+var (
+	// ErrNotFound is a block that should exist, since a later one was produced, but can't be fetched.
+	ErrNotFound = errors.New("block not found")
+	// ErrTimeout is the caller's deadline, or CommitTimeout, passing before the block was produced. It also wraps
+	// context.DeadlineExceeded.
+	ErrTimeout = errors.New("timed out waiting for block")
+	// ErrSubscription is the new block subscription failing or being closed.
+	ErrSubscription = errors.New("failed to subscribe")
+	// ErrUnexpectedEvent is the new block subscription delivering something other than a new block.
+	ErrUnexpectedEvent = errors.New("unexpected event")
+)
 
-	// subscriber
-	subscriber := fmt.Sprintf("new-block-%v", height)
+type loggerKey struct{}
 
-	// query for event
-	query := tmTypes.QueryForEvent(tmTypes.EventNewBlock).String()
+// WithLogger attaches a logger for the query functions to ctx.
+func WithLogger(ctx context.Context, l logger.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
 
-	// register for the next event of this type
-	eventCh, err := client.Subscribe(c, subscriber, query)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to subscribe")
+func loggerFrom(ctx context.Context) logger.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(logger.Logger); ok && l != nil {
+		return l
 	}
-
-	// unsubscribe query
-	defer func() {
-		if err := client.Unsubscribe(c, subscriber, query); err != nil {
-			Logger.Error("GetBlockWithClient | Unsubscribe", "Error", err)
-		}
-	}()
-
-	for {
-		select {
-		case event := <-eventCh:
-			eventData := event.Data
-			switch t := eventData.(type) {
-			case tmTypes.EventDataNewBlock:
-				if t.Block.Height == height {
-					return t.Block, nil
-				}
-			default:
-				return nil, errors.New("timed out waiting for event")
-			}
-		case <-c.Done():
-			return nil, errors.New("timed out waiting for event")
-		}
+	if Logger != nil {
+		return Logger
 	}
+	return logger.NewNopLogger()
 }
 
-// GetBeginBlockEvents get block through per height
-func GetBeginBlockEvents(client *httpClient.HTTP, height int64) ([]abci.Event, error) {
-	c, cancel := context.WithTimeout(context.Background(), CommitTimeout)
-	defer cancel()
+// waitForBlock returns fetch() if it succeeds, and otherwise waits for the new block event at height. fetch is tried
+// again once subscribed, in case the block was produced in between, and when a later block shows up without the
+// one at height having been seen.
+func waitForBlock[T any](ctx context.Context, client HeimdallClient, height int64, fetch func() (T, error),
+	fromEvent func(tmTypes.EventDataNewBlock) T) (res T, err error) {
 
-	// get block using client
-	blockResults, err := client.BlockResults(&height)
-	if err == nil && blockResults != nil {
-		return blockResults.Results.BeginBlock.GetEvents(), nil
+	if res, err = fetch(); err == nil {
+		return
 	}
 
-	// subscriber
-	subscriber := fmt.Sprintf("new-block-%v", height)
+	c, cancel := ctx, context.CancelFunc(func() {})
+	if _, has := ctx.Deadline(); !has {
+		c, cancel = context.WithTimeout(ctx, CommitTimeout)
+	}
+	defer cancel()
 
-	// query for event
+	subscriber := fmt.Sprintf("new-block-%v", height)
 	query := tmTypes.QueryForEvent(tmTypes.EventNewBlock).String()
 
 	// register for the next event of this type
-	eventCh, err := client.Subscribe(c, subscriber, query)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to subscribe")
+	var eventCh <-chan ctypes.ResultEvent
+	if eventCh, err = client.Subscribe(c, subscriber, query); err != nil {
+		return res, fmt.Errorf("%w: %v", ErrSubscription, err)
 	}
-
-	// unsubscribe query
 	defer func() {
-		_ = client.Unsubscribe(c, subscriber, query)
+		// c may be done already, which shouldn't keep the subscription open
+		if err := client.Unsubscribe(context.Background(), subscriber, query); err != nil {
+			loggerFrom(ctx).Error("waitForBlock | Unsubscribe", "height", height, "Error", err)
+		}
 	}()
 
+	if res, err = fetch(); err == nil {
+		return
+	}
+
 	for {
 		select {
-		case event := <-eventCh:
-			eventData := event.Data
-			switch t := eventData.(type) {
-			case tmTypes.EventDataNewBlock:
-				if t.Block.Height == height {
-					return t.ResultBeginBlock.GetEvents(), nil
+		case event, ok := <-eventCh:
+			if !ok {
+				return res, fmt.Errorf("%w: subscription closed waiting for block %v", ErrSubscription, height)
+			}
+			nb, isBlock := event.Data.(tmTypes.EventDataNewBlock)
+			if !isBlock {
+				return res, fmt.Errorf("%w: %T waiting for block %v", ErrUnexpectedEvent, event.Data, height)
+			}
+			switch {
+			case nb.Block.Height == height:
+				return fromEvent(nb), nil
+			case nb.Block.Height > height:
+				if res, err = fetch(); err != nil {
+					return res, fmt.Errorf("%w: %v, at height %v: %v", ErrNotFound, height, nb.Block.Height, err)
 				}
-			default:
-				return nil, errors.New("timed out waiting for event")
+				return
 			}
 		case <-c.Done():
-			return nil, errors.New("timed out waiting for event")
+			if errors.Is(c.Err(), context.DeadlineExceeded) {
+				return res, fmt.Errorf("%w %v: %w", ErrTimeout, height, c.Err())
+			}
+			return res, c.Err()
 		}
 	}
 }
 
+// GetBlockWithClient gets the block at height, waiting for it if it hasn't been produced yet.
+func GetBlockWithClient(ctx context.Context, client HeimdallClient, height int64) (*tmTypes.Block, error) {
+	return waitForBlock(ctx, client, height,
+		func() (b *tmTypes.Block, err error) {
+			var res *ctypes.ResultBlock
+			if res, err = client.Block(&height); err != nil {
+				return
+			}
+			if res == nil || res.Block == nil {
+				return nil, fmt.Errorf("no block at %v", height)
+			}
+			return res.Block, nil
+		},
+		func(nb tmTypes.EventDataNewBlock) *tmTypes.Block { return nb.Block })
+}
+
+// GetBeginBlockEvents gets the events of the begin blocker at height, waiting for the block if it hasn't been
+// produced yet.
+func GetBeginBlockEvents(ctx context.Context, client HeimdallClient, height int64) ([]abci.Event, error) {
+	return waitForBlock(ctx, client, height,
+		func() (events []abci.Event, err error) {
+			var res *ctypes.ResultBlockResults
+			if res, err = client.BlockResults(&height); err != nil {
+				return
+			}
+			if res == nil || res.Results == nil {
+				return nil, fmt.Errorf("no block results at %v", height)
+			}
+			return res.Results.BeginBlock.GetEvents(), nil
+		},
+		func(nb tmTypes.EventDataNewBlock) []abci.Event { return nb.ResultBeginBlock.GetEvents() })
+}
+
 // GetVoteSigs returns sigs bytes from vote
 func GetVoteSigs(unFilteredVotes []*tmTypes.CommitSig) (sigs []byte) {
 	votes := make([]*tmTypes.CommitSig, 0)
@@ -138,11 +170,12 @@ func GetVoteSigs(unFilteredVotes []*tmTypes.CommitSig) (sigs []byte) {
 
 // FetchVotes fetches votes and extracts sigs from it
 func FetchVotes(
-	client *httpClient.HTTP,
+	ctx context.Context,
+	client HeimdallClient,
 	height int64,
 ) (votes []*tmTypes.CommitSig, sigs []byte, chainID string, err error) {
 	// get block client
-	blockDetails, err := GetBlockWithClient(client, height+1)
+	blockDetails, err := GetBlockWithClient(ctx, client, height+1)
 
 	if err != nil {
 		return nil, nil, "", err
@@ -0,0 +1,265 @@
+package heimdall
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+// rootChainVerifierAsm takes submitCheckpoint calldata and counts the signatures the way StakeManager.checkSignatures
+// does: the vote hash is keccak256(0x01 ++ data) and each [r, s, v] is ecrecovered. A signer equal to the last one is
+// skipped, and counting stops at the first signer below the last one. The power of a signer is at the storage slot
+// of its address, zero for unknown signers, and the total power at slot 0. It returns (voteHash, signedPower), or
+// reverts with 2 if signedPower is under total * 2 / 3 + 1.
+const rootChainVerifierAsm = `
+	PUSH 0
+	CALLDATALOAD
+	PUSH 224
+	SHR
+	PUSH 0x%x
+	EQ
+	ISZERO
+	JUMPI @fail_call
+
+	;; vote hash of 0x01 ++ data, built at 0x200
+	PUSH 4
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	PUSH 1
+	PUSH 0x200
+	MSTORE8
+	DUP1
+	DUP3
+	PUSH 32
+	ADD
+	PUSH 0x201
+	CALLDATACOPY
+	PUSH 1
+	ADD
+	PUSH 0x200
+	KECCAK256
+	PUSH 0xa0
+	MSTORE
+	POP
+
+	;; count at 0x120, first [r, s, v] at 0x140. i at 0x100, last signer at 0xe0, power at 0xc0
+	PUSH 36
+	CALLDATALOAD
+	PUSH 4
+	ADD
+	DUP1
+	CALLDATALOAD
+	PUSH 0x120
+	MSTORE
+	PUSH 32
+	ADD
+	PUSH 0x140
+	MSTORE
+
+loop:
+	PUSH 0x120
+	MLOAD
+	PUSH 0x100
+	MLOAD
+	EQ
+	JUMPI @done
+
+	PUSH 0x100
+	MLOAD
+	PUSH 96
+	MUL
+	PUSH 0x140
+	MLOAD
+	ADD
+	PUSH 0xa0
+	MLOAD
+	PUSH 0
+	MSTORE
+	DUP1
+	PUSH 64
+	ADD
+	CALLDATALOAD
+	PUSH 0x20
+	MSTORE
+	DUP1
+	CALLDATALOAD
+	PUSH 0x40
+	MSTORE
+	PUSH 32
+	ADD
+	CALLDATALOAD
+	PUSH 0x60
+	MSTORE
+
+	PUSH 0
+	PUSH 0x80
+	MSTORE
+	PUSH 0x20
+	PUSH 0x80
+	PUSH 0x80
+	PUSH 0
+	PUSH 1
+	GAS
+	STATICCALL
+	POP
+	PUSH 0x80
+	MLOAD
+
+	;; the same signer again is skipped, a lower one ends the count
+	DUP1
+	PUSH 0xe0
+	MLOAD
+	EQ
+	JUMPI @skip
+	DUP1
+	PUSH 0xe0
+	MLOAD
+	GT
+	JUMPI @unordered
+	DUP1
+	PUSH 0xe0
+	MSTORE
+	SLOAD
+	PUSH 0xc0
+	MLOAD
+	ADD
+	PUSH 0xc0
+	MSTORE
+	JUMP @next
+
+skip:
+	POP
+next:
+	PUSH 0x100
+	MLOAD
+	PUSH 1
+	ADD
+	PUSH 0x100
+	MSTORE
+	JUMP @loop
+
+unordered:
+	POP
+done:
+	PUSH 1
+	PUSH 3
+	PUSH 2
+	PUSH 0
+	SLOAD
+	MUL
+	DIV
+	ADD
+	PUSH 0xc0
+	MLOAD
+	LT
+	JUMPI @fail_quorum
+	PUSH 0x40
+	PUSH 0xa0
+	RETURN
+
+fail_call:
+	PUSH 0
+	PUSH 0
+	REVERT
+fail_quorum:
+	PUSH 2
+	PUSH 0
+	MSTORE
+	PUSH 32
+	PUSH 0
+	REVERT
+`
+
+// rootChainVerifier runs the RootChain signature check on submitCheckpoint calldata in an in-process EVM, with the
+// stake of a validator set.
+type rootChainVerifier struct {
+	addr common.Address
+	sdb  *state.StateDB
+}
+
+func newRootChainVerifier(t *testing.T, vs *ValidatorSet) *rootChainVerifier {
+	c := asm.NewCompiler(false)
+	c.Feed(asm.Lex([]byte(fmt.Sprintf(rootChainVerifierAsm, SubmitCheckpointMethod.ID())), false))
+	out, errs := c.Compile()
+	require.Empty(t, errs)
+	code, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	require.NoError(t, err)
+
+	v := &rootChainVerifier{addr: common.HexToAddress("0x0000000000000000000000000000000000002001")}
+	v.sdb, err = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	v.sdb.SetCode(v.addr, code)
+	v.sdb.SetState(v.addr, common.Hash{}, common.BigToHash(big.NewInt(vs.TotalVotingPower())))
+	for _, val := range vs.Validators {
+		v.sdb.SetState(v.addr, common.BytesToHash(val.Signer[:]), common.BigToHash(big.NewInt(val.VotingPower)))
+	}
+	return v
+}
+
+// Check runs submitCheckpoint calldata and returns the vote hash and signed power the verifier computed.
+func (v *rootChainVerifier) Check(calldata []byte) (voteHash ethgo.Hash, signedPower int64, err error) {
+	var out []byte
+	out, _, err = runtime.Call(v.addr, calldata, &runtime.Config{State: v.sdb})
+	if errors.Is(err, vm.ErrExecutionReverted) && len(out) == 32 && out[31] == 2 {
+		err = ErrNoQuorum
+	}
+	if err != nil {
+		return
+	}
+	copy(voteHash[:], out[:32])
+	signedPower = new(big.Int).SetBytes(out[32:64]).Int64()
+	return
+}
+
+var checkSignaturesMethod = abi.MustNewMethod("function checkSignatures(uint256 blockInterval, bytes32 voteHash, bytes32 stateRoot, address proposer, uint256[3][] sigs) returns (uint256)")
+
+// loadRootArtifact reads a compiled contract under build/contracts/root and returns its abi and runtime code.
+func loadRootArtifact(t *testing.T, name string) (methods map[string]*abi.Method, code []byte) {
+	art, err := os.ReadFile(fmt.Sprintf("../build/contracts/root/%v.sol/%v.json", name, name))
+	require.NoError(t, err, "compile %v from maticnetwork/contracts into build/contracts/root", name)
+	var jart struct {
+		Abi              json.RawMessage `json:"abi"`
+		DeployedBytecode string          `json:"deployedBytecode"`
+	}
+	require.NoError(t, json.Unmarshal(art, &jart))
+	a, err := abi.NewABI(string(jart.Abi))
+	require.NoError(t, err)
+	return a.Methods, common.FromHex(jart.DeployedBytecode)
+}
+
+// TestRootChainArtifact pins the assembly verifier to the compiled RootChain and StakeManager: submitCheckpoint and
+// checkSignatures have the selectors the verifier and the submission calldata use, and both are dispatched by the
+// runtime code.
+func TestRootChainArtifact(t *testing.T) {
+	for _, tt := range []struct {
+		contract string
+		method   *abi.Method
+	}{
+		{"RootChain", SubmitCheckpointMethod},
+		{"StakeManager", checkSignaturesMethod},
+	} {
+		methods, code := loadRootArtifact(t, tt.contract)
+		m, ok := methods[tt.method.Name]
+		require.True(t, ok, "%v has no %v", tt.contract, tt.method.Name)
+		require.Equal(t, tt.method.ID(), m.ID())
+		require.True(t, bytes.Contains(code, append([]byte{byte(vm.PUSH4)}, m.ID()...)), "%v does not dispatch %v", tt.contract, tt.method.Name)
+	}
+}
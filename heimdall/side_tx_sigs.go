@@ -0,0 +1,107 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/wallet"
+	"math/big"
+)
+
+var (
+	ErrUnknownSigner   = errors.New("signer is not in the validator set")
+	ErrDuplicateSigner = errors.New("duplicate signer")
+	ErrNoQuorum        = errors.New("not enough voting power")
+)
+
+// SideTxSig is one validator signature from a side-tx response, where it is encoded as decimal strings
+// [r, s, v].
+type SideTxSig struct {
+	R, S, V *big.Int
+}
+
+func (sig *SideTxSig) UnmarshalJSON(data []byte) (err error) {
+	var parts []string
+	if err = json.Unmarshal(data, &parts); err != nil {
+		return
+	}
+	if len(parts) != 3 {
+		return fmt.Errorf("side-tx sig should have 3 parts, has %v", len(parts))
+	}
+	vals := make([]*big.Int, 3)
+	for i := range parts {
+		var ok bool
+		if vals[i], ok = new(big.Int).SetString(parts[i], 10); !ok {
+			return fmt.Errorf("invalid side-tx sig part %q", parts[i])
+		}
+	}
+	for i, name := range []string{"r", "s"} {
+		if vals[i].Sign() < 0 || vals[i].BitLen() > 256 {
+			return fmt.Errorf("side-tx sig %v %v is not a 256 bit value", name, vals[i])
+		}
+	}
+	if v := vals[2]; !v.IsUint64() || (v.Uint64() > 1 && v.Uint64() != 27 && v.Uint64() != 28) {
+		return fmt.Errorf("side-tx sig v %v is not 0, 1, 27 or 28", v)
+	}
+	sig.R, sig.S, sig.V = vals[0], vals[1], vals[2]
+	return
+}
+
+func (sig SideTxSig) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{sig.R.String(), sig.S.String(), sig.V.String()})
+}
+
+// Bytes is the 65 byte [r, s, v] signature, with v as 0 or 1.
+func (sig *SideTxSig) Bytes() []byte {
+	var b [65]byte
+	sig.R.FillBytes(b[:32])
+	sig.S.FillBytes(b[32:64])
+	v := sig.V.Uint64()
+	if v >= 27 {
+		v -= 27
+	}
+	b[64] = byte(v)
+	return b[:]
+}
+
+// Signer recovers the address that signed the side-tx vote.
+func (sig *SideTxSig) Signer(vote *SideTxVote) (ethgo.Address, error) {
+	return wallet.EcrecoverMsg(vote.SignBytes(), sig.Bytes())
+}
+
+// SignatureReport is the outcome of checking side-tx signatures against a validator set.
+type SignatureReport struct {
+	// Signers are the validators that signed, in signature order.
+	Signers     []Validator `json:"signers"`
+	SignedPower int64       `json:"signed_power"`
+	TotalPower  int64       `json:"total_power"`
+	// Quorum is true if more than 2/3 of the total voting power signed.
+	Quorum bool `json:"quorum"`
+}
+
+// VerifySideTxSigs recovers the signer of each signature over the side-tx sign bytes and totals their voting power.
+// A signature from outside the validator set, or a second signature from the same validator, fails verification
+// rather than being skipped.
+func VerifySideTxSigs(vote *SideTxVote, sigs []SideTxSig, vs *ValidatorSet) (report *SignatureReport, err error) {
+	report = &SignatureReport{TotalPower: vs.TotalVotingPower()}
+	seen := make(map[ethgo.Address]bool, len(sigs))
+	for i := range sigs {
+		var signer ethgo.Address
+		if signer, err = sigs[i].Signer(vote); err != nil {
+			return nil, fmt.Errorf("sig %v: %w", i, err)
+		}
+		if seen[signer] {
+			return nil, fmt.Errorf("sig %v: %w %v", i, ErrDuplicateSigner, signer)
+		}
+		seen[signer] = true
+		v, ok := vs.BySigner(signer)
+		if !ok {
+			return nil, fmt.Errorf("sig %v: %w: %v", i, ErrUnknownSigner, signer)
+		}
+		report.Signers = append(report.Signers, v)
+		report.SignedPower += v.VotingPower
+	}
+	report.Quorum = vs.HasQuorum(report.SignedPower)
+	return
+}
@@ -0,0 +1,113 @@
+package heimdall
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/wallet"
+	"testing"
+)
+
+func loadSideTx1(t *testing.T) (*SideTxVote, []SideTxSig) {
+	stx, _, err := DecodeSideTxResponse(sideTxData)
+	require.NoError(t, err)
+	txHash, _ := hex.DecodeString(milestoneTxHash)
+	return NewSideTxYesVote(txHash, stx.Data), stx.Sigs
+}
+
+func TestVerifySideTxSigs(t *testing.T) {
+	res, sigs := loadSideTx1(t)
+	require.Equal(t, 7, len(sigs))
+	vs, err := DecodeValidatorSet(validatorSetData)
+	require.NoError(t, err)
+	require.Equal(t, int64(95000), vs.TotalVotingPower())
+
+	report, err := VerifySideTxSigs(res, sigs, vs)
+	require.NoError(t, err)
+	require.True(t, report.Quorum)
+	require.Equal(t, int64(75000), report.SignedPower)
+	require.Equal(t, int64(95000), report.TotalPower)
+	require.Equal(t, 7, len(report.Signers))
+	signed := make(map[uint64]bool)
+	for _, v := range report.Signers {
+		signed[v.ID] = true
+	}
+	require.False(t, signed[8] || signed[9])
+
+	// without the largest signer there is no quorum: 60000 of 95000
+	var withoutLargest []SideTxSig
+	for i := range sigs {
+		if report.Signers[i].VotingPower != 15000 {
+			withoutLargest = append(withoutLargest, sigs[i])
+		}
+	}
+	report, err = VerifySideTxSigs(res, withoutLargest, vs)
+	require.NoError(t, err)
+	require.False(t, report.Quorum)
+	require.Equal(t, int64(60000), report.SignedPower)
+
+	// exactly 2/3 is not enough
+	exact, err := NewValidatorSet([]Validator{{ID: 1, Signer: ethgo.HexToAddress("0x01"), VotingPower: 2}, {ID: 2, Signer: ethgo.HexToAddress("0x02"), VotingPower: 1}})
+	require.NoError(t, err)
+	require.False(t, exact.HasQuorum(2))
+	require.True(t, exact.HasQuorum(3))
+
+	_, err = VerifySideTxSigs(res, append(sigs, sigs[2]), vs)
+	require.ErrorIs(t, err, ErrDuplicateSigner)
+
+	// a valid signature from a key outside the set
+	key, err := wallet.GenerateKey()
+	require.NoError(t, err)
+	sigBytes, err := key.SignMsg(res.SignBytes())
+	require.NoError(t, err)
+	var outsider SideTxSig
+	require.NoError(t, json.Unmarshal([]byte(`["1","1","27"]`), &outsider))
+	outsider.R.SetBytes(sigBytes[:32])
+	outsider.S.SetBytes(sigBytes[32:64])
+	outsider.V.SetUint64(uint64(sigBytes[64]))
+	_, err = VerifySideTxSigs(res, append(sigs[:3:3], outsider), vs)
+	require.ErrorIs(t, err, ErrUnknownSigner)
+
+	// signatures over different data recover to other addresses
+	other := *res
+	other.Data = append([]byte{}, res.Data...)
+	other.Data[0] ^= 1
+	_, err = VerifySideTxSigs(&other, sigs, vs)
+	require.ErrorIs(t, err, ErrUnknownSigner)
+
+	_, err = NewValidatorSet([]Validator{{ID: 1, Signer: ethgo.HexToAddress("0x01"), VotingPower: 2}, {ID: 2, Signer: ethgo.HexToAddress("0x01"), VotingPower: 1}})
+	require.Error(t, err)
+}
+
+func TestSideTxSigUnmarshal(t *testing.T) {
+	maxWord := "115792089237316195423570985008687907853269984665640564039457584007913129639935" // 2^256 - 1
+	for _, tc := range []struct {
+		json string
+		ok   bool
+	}{
+		{`["1","2","0"]`, true},
+		{`["1","2","1"]`, true},
+		{`["1","2","27"]`, true},
+		{`["1","2","28"]`, true},
+		{`["` + maxWord + `","` + maxWord + `","27"]`, true},
+		{`["115792089237316195423570985008687907853269984665640564039457584007913129639936","2","27"]`, false},
+		{`["1","115792089237316195423570985008687907853269984665640564039457584007913129639936","27"]`, false},
+		{`["-1","2","27"]`, false},
+		{`["1","2","2"]`, false},
+		{`["1","2","29"]`, false},
+		{`["1","2","-1"]`, false},
+		{`["1","2","18446744073709551643"]`, false},
+		{`["1","2"]`, false},
+		{`["1","x","27"]`, false},
+	} {
+		var sig SideTxSig
+		err := json.Unmarshal([]byte(tc.json), &sig)
+		if !tc.ok {
+			require.Error(t, err, tc.json)
+			continue
+		}
+		require.NoError(t, err, tc.json)
+		require.Len(t, sig.Bytes(), 65)
+	}
+}
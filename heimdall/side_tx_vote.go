@@ -0,0 +1,54 @@
+package heimdall
+
+import (
+	"fmt"
+	"github.com/umbracle/ethgo"
+)
+
+// SideTxResult is a validator's vote on a side-tx, as abci.SideTxResultType.
+type SideTxResult int32
+
+const (
+	SideTxSkip SideTxResult = 0
+	SideTxYes  SideTxResult = 1
+	SideTxNo   SideTxResult = 2
+)
+
+func (r SideTxResult) String() string {
+	switch r {
+	case SideTxSkip:
+		return "Skip"
+	case SideTxYes:
+		return "Yes"
+	case SideTxNo:
+		return "No"
+	}
+	return fmt.Sprintf("SideTxResult(%d)", int32(r))
+}
+
+// SideTxVote is a validator's side-tx vote, the same as the Tendermint fork's SideTxResultWithData.
+type SideTxVote struct {
+	TxHash []byte
+	Result SideTxResult
+	Data   []byte
+}
+
+// NewSideTxYesVote is the 'yes' vote on a side-tx with the given data, the one that checkpoint and milestone
+// signatures are over.
+func NewSideTxYesVote(txHash, data []byte) *SideTxVote {
+	return &SideTxVote{TxHash: txHash, Result: SideTxYes, Data: data}
+}
+
+// SignBytes are the bytes a validator signs for the vote, as SideTxResultWithData.GetBytes: the low byte of the
+// result followed by the data. The tx hash is not signed - the signature can only be matched to its tx through the
+// data.
+func (v *SideTxVote) SignBytes() []byte {
+	b := make([]byte, 0, 1+len(v.Data))
+	b = append(b, byte(uint32(v.Result)))
+	return append(b, v.Data...)
+}
+
+// SignHash is the keccak256 of the sign bytes, the hash that is signed and that the RootChain recovers signers from.
+func (v *SideTxVote) SignHash() ethgo.Hash {
+	return ethgo.BytesToHash(ethgo.Keccak256(v.SignBytes()))
+}
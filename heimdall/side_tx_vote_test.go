@@ -0,0 +1,61 @@
+package heimdall
+
+import (
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"github.com/umbracle/ethgo"
+	"testing"
+)
+
+// the encoder is checked against the fork's SideTxResultWithData.GetBytes, and pinned by hashes, so it stays right
+// once the fork is no longer a dependency.
+func TestSideTxVoteSignBytes(t *testing.T) {
+	vote, sigs := loadSideTx1(t)
+	require.Equal(t, SideTxYes, vote.Result)
+	require.Equal(t, int32(abci.SideTxResultType_Yes), int32(SideTxYes))
+	require.Equal(t, int32(abci.SideTxResultType_No), int32(SideTxNo))
+	require.Equal(t, int32(abci.SideTxResultType_Skip), int32(SideTxSkip))
+
+	golden := map[SideTxResult]string{
+		SideTxYes: "0x5b12af40bc83104a848260fb8941ca275d5f6a46ac53dcf1a5b307c9e2d66974",
+		SideTxNo:  "0xaa4e12687efe2e2a143e869f2ca1e56eaa2f6227712926e41fb3733a4fdfecdc",
+	}
+	for _, result := range []SideTxResult{SideTxSkip, SideTxYes, SideTxNo, 257, -1} {
+		for _, data := range [][]byte{vote.Data, nil} {
+			v := &SideTxVote{TxHash: vote.TxHash, Result: result, Data: data}
+			fork := &tmTypes.SideTxResultWithData{
+				SideTxResult: tmTypes.SideTxResult{TxHash: vote.TxHash, Result: int32(result)},
+				Data:         data,
+			}
+			require.Equal(t, fork.GetBytes(), v.SignBytes(), "%v, %v bytes", result, len(data))
+			require.Equal(t, ethgo.BytesToHash(ethgo.Keccak256(fork.GetBytes())), v.SignHash())
+		}
+	}
+	for result, hash := range golden {
+		v := &SideTxVote{Result: result, Data: vote.Data}
+		require.Equal(t, hash, v.SignHash().String(), "%v", result)
+	}
+
+	signBytes := vote.SignBytes()
+	require.Len(t, signBytes, 1+len(vote.Data))
+	require.Equal(t, byte(1), signBytes[0])
+	require.Equal(t, VoteHash(vote.Data), vote.SignHash())
+	// the tx hash isn't signed
+	require.Equal(t, signBytes, NewSideTxYesVote(nil, vote.Data).SignBytes())
+
+	vs, err := DecodeValidatorSet(validatorSetData)
+	require.NoError(t, err)
+	signer, err := sigs[0].Signer(vote)
+	require.NoError(t, err)
+	_, ok := vs.BySigner(signer)
+	require.True(t, ok)
+	// a 'no' vote over the same data was not what was signed
+	signer, err = sigs[0].Signer(&SideTxVote{Result: SideTxNo, Data: vote.Data})
+	require.NoError(t, err)
+	_, ok = vs.BySigner(signer)
+	require.False(t, ok)
+
+	require.Equal(t, "Yes", SideTxYes.String())
+	require.Equal(t, "SideTxResult(7)", SideTxResult(7).String())
+}
@@ -0,0 +1,196 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/umbracle/ethgo"
+	"math/big"
+)
+
+const QuerySpan = "custom/bor/span"
+
+const (
+	// bor header extra data is 32 bytes of vanity, the producers of the next sprint at the end of a sprint, and a 65
+	// byte seal.
+	borExtraVanity = 32
+	borExtraSeal   = 65
+	// each producer is its address and its power, left padded to 20 bytes.
+	borProducerBytes = 40
+)
+
+var (
+	ErrInvalidSeal = errors.New("invalid bor header seal")
+	ErrNotProducer = errors.New("header is not sealed by a selected producer of the span")
+	ErrNotInSpan   = errors.New("block is not in the span")
+)
+
+// Span is a Heimdall bor span: the Bor blocks it covers, the validator set when it was proposed, and the producers
+// selected from it to seal the span's blocks.
+type Span struct {
+	ID                uint64        `json:"span_id"`
+	StartBlock        uint64        `json:"start_block"`
+	EndBlock          uint64        `json:"end_block"`
+	ValidatorSet      *ValidatorSet `json:"validator_set"`
+	SelectedProducers []Validator   `json:"selected_producers"`
+	BorChainID        string        `json:"bor_chain_id"`
+}
+
+func (s *Span) validate() (err error) {
+	if s.EndBlock < s.StartBlock {
+		return fmt.Errorf("span %v ends at %v before it starts at %v", s.ID, s.EndBlock, s.StartBlock)
+	}
+	if s.ValidatorSet != nil {
+		if s.ValidatorSet, err = NewValidatorSet(s.ValidatorSet.Validators); err != nil {
+			return fmt.Errorf("span %v: %w", s.ID, err)
+		}
+	}
+	if _, err = NewValidatorSet(s.SelectedProducers); err != nil {
+		return fmt.Errorf("span %v producers: %w", s.ID, err)
+	}
+	return
+}
+
+// DecodeSpanResponse decodes a REST /bor/span/{id} response.
+func DecodeSpanResponse(data []byte) (s *Span, height uint64, err error) {
+	if s, height, err = decodeREST[Span](data); err != nil {
+		return
+	}
+	err = s.validate()
+	return
+}
+
+// DecodeSpanQuery decodes the value of a custom/bor/span query.
+func DecodeSpanQuery(value []byte) (s *Span, err error) {
+	s = &Span{}
+	if err = json.Unmarshal(value, s); err != nil {
+		return
+	}
+	err = s.validate()
+	return
+}
+
+// GetSpan queries span id at a Heimdall height, or the latest height if it is zero.
+func GetSpan(client HeimdallClient, id uint64, height int64) (s *Span, err error) {
+	var value []byte
+	if value, err = queryAt(client, QuerySpan, []byte(fmt.Sprintf(`{"RecordID":%v}`, id)), height); err != nil {
+		return
+	}
+	return DecodeSpanQuery(value)
+}
+
+// Producer is the selected producer with address signer.
+func (s *Span) Producer(signer ethgo.Address) (v Validator, ok bool) {
+	for _, p := range s.SelectedProducers {
+		if p.Signer == signer {
+			return p, true
+		}
+	}
+	return
+}
+
+// BorSealHash is the hash a Bor block producer signs: the RLP of the header without the seal, as in Bor's
+// encodeSigHeader. the base fee is included when the header has one, which it does from the Jaipur fork on.
+func BorSealHash(h *types.Header) (hash ethgo.Hash, err error) {
+	if len(h.Extra) < borExtraVanity+borExtraSeal {
+		return hash, fmt.Errorf("%w: extra data is %v bytes", ErrInvalidSeal, len(h.Extra))
+	}
+	enc := []interface{}{
+		h.ParentHash,
+		h.UncleHash,
+		h.Coinbase,
+		h.Root,
+		h.TxHash,
+		h.ReceiptHash,
+		h.Bloom,
+		h.Difficulty,
+		h.Number,
+		h.GasLimit,
+		h.GasUsed,
+		h.Time,
+		h.Extra[:len(h.Extra)-borExtraSeal],
+		h.MixDigest,
+		h.Nonce,
+	}
+	if h.BaseFee != nil {
+		enc = append(enc, h.BaseFee)
+	}
+	var data []byte
+	if data, err = rlp.EncodeToBytes(enc); err != nil {
+		return
+	}
+	return ethgo.BytesToHash(crypto.Keccak256(data)), nil
+}
+
+// BorSealSigner recovers the producer that sealed h from the signature at the end of its extra data.
+func BorSealSigner(h *types.Header) (signer ethgo.Address, err error) {
+	var hash ethgo.Hash
+	if hash, err = BorSealHash(h); err != nil {
+		return
+	}
+	var pub []byte
+	if pub, err = crypto.Ecrecover(hash[:], h.Extra[len(h.Extra)-borExtraSeal:]); err != nil {
+		return signer, fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+	}
+	copy(signer[:], crypto.Keccak256(pub[1:])[12:])
+	return
+}
+
+// BorHeaderProducers are the producers listed in the extra data of a sprint-end header, which Bor uses for the next
+// sprint. Other headers list none.
+func BorHeaderProducers(h *types.Header) (producers []Validator, err error) {
+	if len(h.Extra) < borExtraVanity+borExtraSeal {
+		return nil, fmt.Errorf("%w: extra data is %v bytes", ErrInvalidSeal, len(h.Extra))
+	}
+	data := h.Extra[borExtraVanity : len(h.Extra)-borExtraSeal]
+	if len(data)%borProducerBytes != 0 {
+		return nil, fmt.Errorf("producer list of block %v is %v bytes", h.Number, len(data))
+	}
+	for i := 0; i < len(data); i += borProducerBytes {
+		p := Validator{
+			Signer:      ethgo.BytesToAddress(data[i : i+20]),
+			VotingPower: new(big.Int).SetBytes(data[i+20 : i+borProducerBytes]).Int64(),
+		}
+		producers = append(producers, p)
+	}
+	return
+}
+
+// VerifyHeader checks that h is in the span and was sealed by one of its selected producers. A sprint-end header
+// whose next sprint is still in the span has to list exactly the span's producers.
+func (s *Span) VerifyHeader(h *types.Header) (producer Validator, err error) {
+	num := h.Number.Uint64()
+	if num < s.StartBlock || num > s.EndBlock {
+		return producer, fmt.Errorf("%w: %v is not in span %v [%v, %v]", ErrNotInSpan, num, s.ID, s.StartBlock, s.EndBlock)
+	}
+	var signer ethgo.Address
+	if signer, err = BorSealSigner(h); err != nil {
+		return
+	}
+	var ok bool
+	if producer, ok = s.Producer(signer); !ok {
+		return producer, fmt.Errorf("%w: block %v sealed by %v in span %v", ErrNotProducer, num, signer, s.ID)
+	}
+
+	var listed []Validator
+	if listed, err = BorHeaderProducers(h); err != nil {
+		return
+	}
+	if len(listed) > 0 && num < s.EndBlock {
+		if len(listed) != len(s.SelectedProducers) {
+			return producer, fmt.Errorf("%w: block %v lists %v producers, span %v has %v", ErrNotProducer, num,
+				len(listed), s.ID, len(s.SelectedProducers))
+		}
+		// bor sorts them by address, the span needn't
+		for _, l := range listed {
+			if p, ok := s.Producer(l.Signer); !ok || p.VotingPower != l.VotingPower {
+				return producer, fmt.Errorf("%w: block %v lists producer %v with power %v, which isn't in span %v",
+					ErrNotProducer, num, l.Signer, l.VotingPower, s.ID)
+			}
+		}
+	}
+	return
+}
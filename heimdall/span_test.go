@@ -0,0 +1,234 @@
+package heimdall
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+var recordSpan = flag.Bool("record-span", false, "record "+recordedSpanPath+" from $HEIMDALL_REST_URL")
+
+// the Amoy span covering the checkpoint.ndjson blocks
+const (
+	recordedSpanID   = 569
+	recordedSpanPath = "data/span-569.json"
+)
+
+func TestRecordSpan(t *testing.T) {
+	if !*recordSpan {
+		t.Skip("run with -record-span to record " + recordedSpanPath)
+	}
+	tc := &TendermintClient{RESTURL: strings.TrimSuffix(os.Getenv("HEIMDALL_REST_URL"), "/"), RESTClient: http.DefaultClient}
+	data, err := tc.getREST(fmt.Sprintf("/bor/span/%v", recordedSpanID))
+	require.NoError(t, err)
+	_, _, err = DecodeSpanResponse(data)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(recordedSpanPath, data, 0644))
+}
+
+// loadRecordedSpan is the Amoy span recorded by TestRecordSpan.
+func loadRecordedSpan(t *testing.T) *Span {
+	data, err := os.ReadFile(recordedSpanPath)
+	require.NoError(t, err, "record it with TestRecordSpan")
+	s, _, err := DecodeSpanResponse(data)
+	require.NoError(t, err)
+	return s
+}
+
+// the checkpoint.ndjson blocks leave out the logs bloom and the base fee. the base fee was 15 wei throughout, so
+// every block without txs, whose bloom is empty, can be rebuilt exactly - the hash checks it.
+type recordedBorHeader struct {
+	Hash        common.Hash      `json:"hash"`
+	ParentHash  common.Hash      `json:"parentHash"`
+	UncleHash   common.Hash      `json:"sha3Uncles"`
+	Coinbase    common.Address   `json:"miner"`
+	Root        common.Hash      `json:"stateRoot"`
+	TxHash      common.Hash      `json:"transactionsRoot"`
+	ReceiptHash common.Hash      `json:"receiptsRoot"`
+	Difficulty  *hexutil.Big     `json:"difficulty"`
+	Number      *hexutil.Big     `json:"number"`
+	GasLimit    hexutil.Uint64   `json:"gasLimit"`
+	GasUsed     hexutil.Uint64   `json:"gasUsed"`
+	Time        hexutil.Uint64   `json:"timestamp"`
+	Extra       hexutil.Bytes    `json:"extraData"`
+	MixDigest   common.Hash      `json:"mixHash"`
+	Nonce       types.BlockNonce `json:"nonce"`
+}
+
+func loadBorHeaders(t *testing.T) (headers []*types.Header) {
+	scanner := bufio.NewScanner(bytes.NewReader(checkPointData))
+	for scanner.Scan() {
+		var r recordedBorHeader
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		if r.GasUsed != 0 {
+			continue
+		}
+		h := &types.Header{
+			ParentHash:  r.ParentHash,
+			UncleHash:   r.UncleHash,
+			Coinbase:    r.Coinbase,
+			Root:        r.Root,
+			TxHash:      r.TxHash,
+			ReceiptHash: r.ReceiptHash,
+			Difficulty:  r.Difficulty.ToInt(),
+			Number:      r.Number.ToInt(),
+			GasLimit:    uint64(r.GasLimit),
+			GasUsed:     uint64(r.GasUsed),
+			Time:        uint64(r.Time),
+			Extra:       r.Extra,
+			MixDigest:   r.MixDigest,
+			Nonce:       r.Nonce,
+			BaseFee:     big.NewInt(15),
+		}
+		require.Equal(t, r.Hash, h.Hash(), "block %v", h.Number)
+		headers = append(headers, h)
+	}
+	require.NoError(t, scanner.Err())
+	return
+}
+
+func TestDecodeSpan(t *testing.T) {
+	s, _, err := DecodeSpanResponse(spanRebuiltData)
+	require.NoError(t, err)
+	require.Equal(t, uint64(569), s.ID)
+	require.Equal(t, uint64(3635456), s.StartBlock)
+	require.Equal(t, uint64(3641855), s.EndBlock)
+	require.Len(t, s.SelectedProducers, 6)
+	require.Equal(t, int64(67000), s.ValidatorSet.TotalVotingPower())
+	p, ok := s.Producer(ethgo.HexToAddress("0x09207a6efee346cb3e4a54ac18523e3715d38b3f"))
+	require.True(t, ok)
+	require.Equal(t, uint64(5), p.ID)
+	require.Equal(t, int64(55000), p.VotingPower)
+
+	// the query value is the result of the REST response
+	var rest struct {
+		Result json.RawMessage `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(spanRebuiltData, &rest))
+	m := NewMockHeimdallClient()
+	m.AddQuery(QuerySpan, []byte(`{"RecordID":569}`), rest.Result)
+	queried, err := GetSpan(m, 569, 0)
+	require.NoError(t, err)
+	require.Equal(t, s, queried)
+	_, err = GetSpan(m, 570, 0)
+	require.Error(t, err)
+
+	_, err = DecodeSpanQuery([]byte(`{"span_id":1,"start_block":10,"end_block":9}`))
+	require.Error(t, err)
+	_, err = DecodeSpanQuery([]byte(`{"span_id":1,"selected_producers":[{"ID":1,"signer":"0x01","power":1},{"ID":1,"signer":"0x01","power":1}]}`))
+	require.Error(t, err)
+}
+
+func TestSpanVerifyHeader(t *testing.T) {
+	headers := loadBorHeaders(t)
+	require.Len(t, headers, 507)
+	s := loadRecordedSpan(t)
+
+	produced := make(map[uint64]int)
+	sprintEnds := 0
+	for _, h := range headers {
+		p, err := s.VerifyHeader(h)
+		require.NoError(t, err, "block %v", h.Number)
+		produced[p.ID]++
+		if listed, _ := BorHeaderProducers(h); len(listed) > 0 {
+			sprintEnds++
+			require.Zero(t, (h.Number.Uint64()+1)%16)
+		}
+	}
+	require.Equal(t, map[uint64]int{1: 110, 2: 80, 3: 66, 4: 79, 5: 172}, produced)
+	require.Equal(t, 31, sprintEnds)
+
+	h := types.CopyHeader(headers[0])
+	signer, err := BorSealSigner(h)
+	require.NoError(t, err)
+	require.Equal(t, ethgo.HexToAddress("0x09207a6efee346cb3e4a54ac18523e3715d38b3f"), signer)
+
+	// any change to the header changes the signer
+	h.Time++
+	_, err = s.VerifyHeader(h)
+	require.ErrorIs(t, err, ErrNotProducer)
+	// before Jaipur there was no base fee to sign
+	h = types.CopyHeader(headers[0])
+	h.BaseFee = nil
+	_, err = s.VerifyHeader(h)
+	require.ErrorIs(t, err, ErrNotProducer)
+
+	h = types.CopyHeader(headers[0])
+	h.Extra = h.Extra[:borExtraVanity+borExtraSeal-1]
+	_, err = s.VerifyHeader(h)
+	require.ErrorIs(t, err, ErrInvalidSeal)
+
+	other := *s
+	other.StartBlock, other.EndBlock = s.EndBlock+1, s.EndBlock+6400
+	_, err = other.VerifyHeader(headers[0])
+	require.ErrorIs(t, err, ErrNotInSpan)
+
+	// a span without the producer
+	other = *s
+	other.SelectedProducers = nil
+	for _, p := range s.SelectedProducers {
+		if p.Signer != signer {
+			other.SelectedProducers = append(other.SelectedProducers, p)
+		}
+	}
+	_, err = other.VerifyHeader(headers[0])
+	require.ErrorIs(t, err, ErrNotProducer)
+
+	// or whose producers aren't the ones bor was given
+	var sprintEnd *types.Header
+	for _, h := range headers {
+		if len(h.Extra) > borExtraVanity+borExtraSeal {
+			sprintEnd = h
+			break
+		}
+	}
+	other = *s
+	other.SelectedProducers = append([]Validator(nil), s.SelectedProducers...)
+	other.SelectedProducers[5].VotingPower++
+	_, err = other.VerifyHeader(sprintEnd)
+	require.ErrorIs(t, err, ErrNotProducer)
+	// except for the span's last block, which lists the next span's producers
+	other.EndBlock = sprintEnd.Number.Uint64()
+	_, err = other.VerifyHeader(sprintEnd)
+	require.NoError(t, err, fmt.Sprint(sprintEnd.Number))
+}
+
+func TestSpanRecorded(t *testing.T) {
+	s := loadRecordedSpan(t)
+	require.Equal(t, uint64(recordedSpanID), s.ID)
+	require.Equal(t, "80002", s.BorChainID)
+
+	// every block of the checkpoint was sealed by one of the span's producers, and the sprint-end headers list them
+	// with the same powers
+	headers := loadBorHeaders(t)
+	require.LessOrEqual(t, s.StartBlock, headers[0].Number.Uint64())
+	require.GreaterOrEqual(t, s.EndBlock, headers[len(headers)-1].Number.Uint64())
+	for _, h := range headers {
+		_, err := s.VerifyHeader(h)
+		require.NoError(t, err, "block %v", h.Number)
+	}
+
+	// the rebuilt span has the same producers
+	rebuilt, _, err := DecodeSpanResponse(spanRebuiltData)
+	require.NoError(t, err)
+	powers := func(vals []Validator) map[ethgo.Address]int64 {
+		m := make(map[ethgo.Address]int64, len(vals))
+		for _, v := range vals {
+			m[v.Signer] = v.VotingPower
+		}
+		return m
+	}
+	require.Equal(t, powers(rebuilt.SelectedProducers), powers(s.SelectedProducers))
+}
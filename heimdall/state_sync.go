@@ -0,0 +1,358 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"github.com/umbracle/ethgo/jsonrpc"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+const QueryRecord = "custom/clerk/record"
+
+// StateSyncedEvent is the event StateSender emits on L1 for every state sync.
+var StateSyncedEvent = abi.MustNewEvent(`event StateSynced(
+	uint256 indexed id,
+	address indexed sender,
+	address indexed receiver,
+	bytes data)`)
+
+var ErrStateSyncConflict = errors.New("conflicting state syncs")
+
+// StateSynced is a StateSynced log of the StateSender contract.
+type StateSynced struct {
+	ID          uint64        `json:"id"`
+	Contract    ethgo.Address `json:"contract"`
+	Sender      ethgo.Address `json:"sender"`
+	Receiver    ethgo.Address `json:"receiver"`
+	Data        hexutil.Bytes `json:"data"`
+	BlockNumber uint64        `json:"block_number"`
+	TxHash      ethgo.Hash    `json:"tx_hash"`
+	LogIndex    uint64        `json:"log_index"`
+	// Time is the time of the L1 block, if it was fetched.
+	Time time.Time `json:"time"`
+}
+
+// ParseStateSynced decodes a StateSynced log.
+func ParseStateSynced(l *ethgo.Log) (ss *StateSynced, err error) {
+	var vals map[string]interface{}
+	if vals, err = StateSyncedEvent.ParseLog(l); err != nil {
+		return
+	}
+	id, ok := vals["id"].(*big.Int)
+	if !ok || !id.IsUint64() {
+		return nil, fmt.Errorf("state sync id %v out of range", vals["id"])
+	}
+	ss = &StateSynced{
+		ID:          id.Uint64(),
+		Contract:    l.Address,
+		Sender:      vals["sender"].(ethgo.Address),
+		Receiver:    vals["receiver"].(ethgo.Address),
+		Data:        vals["data"].([]byte),
+		BlockNumber: l.BlockNumber,
+		TxHash:      l.TransactionHash,
+		LogIndex:    l.LogIndex,
+	}
+	return
+}
+
+// StateSyncQuerier is the subset of the eth JSON-RPC api needed to fetch state syncs. *jsonrpc.Eth satisfies it.
+type StateSyncQuerier interface {
+	GetLogs(filter *ethgo.LogFilter) ([]*ethgo.Log, error)
+	BlockGetter
+}
+
+var _ StateSyncQuerier = &jsonrpc.Eth{}
+
+// FetchStateSynced gets the StateSynced logs of stateSender in blocks from to to, in chain order, with the times of
+// their blocks.
+func FetchStateSynced(q StateSyncQuerier, stateSender ethgo.Address, from, to uint64) (events []*StateSynced, err error) {
+	fromBlockNum, toBlockNum := ethgo.BlockNumber(from), ethgo.BlockNumber(to)
+	topic := StateSyncedEvent.ID()
+	var ll []*ethgo.Log
+	if ll, err = q.GetLogs(&ethgo.LogFilter{
+		Address: []ethgo.Address{stateSender},
+		Topics:  [][]*ethgo.Hash{{&topic}},
+		From:    &fromBlockNum,
+		To:      &toBlockNum,
+	}); err != nil {
+		return
+	}
+	sort.SliceStable(ll, func(i, j int) bool {
+		if ll[i].BlockNumber != ll[j].BlockNumber {
+			return ll[i].BlockNumber < ll[j].BlockNumber
+		}
+		return ll[i].LogIndex < ll[j].LogIndex
+	})
+
+	times := make(map[uint64]time.Time)
+	for _, l := range ll {
+		var ss *StateSynced
+		if ss, err = ParseStateSynced(l); err != nil {
+			return nil, fmt.Errorf("log %v of block %v: %w", l.LogIndex, l.BlockNumber, err)
+		}
+		t, ok := times[l.BlockNumber]
+		if !ok {
+			var b *ethgo.Block
+			if b, err = q.GetBlockByNumber(ethgo.BlockNumber(l.BlockNumber), false); err != nil {
+				return
+			}
+			if b == nil {
+				return nil, fmt.Errorf("block %v: %w", l.BlockNumber, ErrNotFound)
+			}
+			t = time.Unix(int64(b.Timestamp), 0).UTC()
+			times[l.BlockNumber] = t
+		}
+		ss.Time = t
+		events = append(events, ss)
+	}
+	return
+}
+
+// ClerkRecord is a state sync as the clerk module stores it, once the validators voted it in. Contract is the
+// receiver of the state sync, and RecordTime the time of the Heimdall block that included it.
+type ClerkRecord struct {
+	StateSyncRecord
+	Data       hexutil.Bytes `json:"data"`
+	BorChainID string        `json:"bor_chain_id"`
+	RecordTime time.Time     `json:"record_time"`
+}
+
+// GetClerkRecord queries state sync record id at a Heimdall height, or the latest height if it is zero.
+func GetClerkRecord(client HeimdallClient, id uint64, height int64) (r *ClerkRecord, err error) {
+	var value []byte
+	if value, err = queryAt(client, QueryRecord, []byte(fmt.Sprintf(`{"record_id":%v}`, id)), height); err != nil {
+		return
+	}
+	r = new(ClerkRecord)
+	if err = json.Unmarshal(value, r); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// StateSync is one state sync id, as it was seen on L1 and in Heimdall.
+type StateSync struct {
+	ID     uint64       `json:"id"`
+	L1     *StateSynced `json:"l1,omitempty"`
+	Record *ClerkRecord `json:"record,omitempty"`
+	// Latency is from the L1 block to the Heimdall block that included the record, once both were seen.
+	Latency time.Duration `json:"latency,omitempty"`
+	// Mismatch is how the record differs from the L1 log, if it does.
+	Mismatch string `json:"mismatch,omitempty"`
+}
+
+func (s *StateSync) match() {
+	if s.L1 == nil || s.Record == nil {
+		return
+	}
+	s.Latency = s.Record.RecordTime.Sub(s.L1.Time)
+	switch {
+	case s.Record.Contract != s.L1.Receiver:
+		s.Mismatch = fmt.Sprintf("record contract %v, the receiver is %v", s.Record.Contract, s.L1.Receiver)
+	case ethgo.HexToHash(s.Record.TxHash) != s.L1.TxHash:
+		s.Mismatch = fmt.Sprintf("record tx %v, the log is in %v", s.Record.TxHash, s.L1.TxHash)
+	case s.Record.LogIndex != s.L1.LogIndex:
+		s.Mismatch = fmt.Sprintf("record log index %v, the log is %v", s.Record.LogIndex, s.L1.LogIndex)
+	case string(s.Record.Data) != string(s.L1.Data):
+		s.Mismatch = "record data differs from the log data"
+	}
+}
+
+// StateSyncSequence is the ids seen on one side: the ones missing between First and Last, and the ones that came
+// after a higher id.
+type StateSyncSequence struct {
+	First      uint64   `json:"first"`
+	Last       uint64   `json:"last"`
+	Count      int      `json:"count"`
+	Gaps       []uint64 `json:"gaps,omitempty"`
+	OutOfOrder []uint64 `json:"out_of_order,omitempty"`
+}
+
+type stateSyncSequence struct {
+	ids        map[uint64]bool
+	highest    uint64
+	outOfOrder []uint64
+}
+
+func (s *stateSyncSequence) add(id uint64) {
+	if s.ids == nil {
+		s.ids = make(map[uint64]bool)
+	}
+	if len(s.ids) > 0 && id < s.highest {
+		s.outOfOrder = append(s.outOfOrder, id)
+	}
+	s.ids[id] = true
+	s.highest = max(s.highest, id)
+}
+
+func (s *stateSyncSequence) report() (seq StateSyncSequence) {
+	seq.Count, seq.OutOfOrder = len(s.ids), s.outOfOrder
+	if len(s.ids) == 0 {
+		return
+	}
+	seq.First, seq.Last = s.highest, s.highest
+	for id := range s.ids {
+		seq.First = min(seq.First, id)
+	}
+	for id := seq.First; id < seq.Last; id++ {
+		if !s.ids[id] {
+			seq.Gaps = append(seq.Gaps, id)
+		}
+	}
+	return
+}
+
+// StateSyncReport is where the tracked state syncs stand. Pending are seen on L1 but not yet in Heimdall, Unknown
+// are in Heimdall but were not seen on L1.
+type StateSyncReport struct {
+	L1          StateSyncSequence `json:"l1"`
+	Heimdall    StateSyncSequence `json:"heimdall"`
+	Matched     int               `json:"matched"`
+	Pending     []uint64          `json:"pending,omitempty"`
+	Unknown     []uint64          `json:"unknown,omitempty"`
+	Mismatched  []uint64          `json:"mismatched,omitempty"`
+	MeanLatency time.Duration     `json:"mean_latency"`
+	MaxLatency  time.Duration     `json:"max_latency"`
+	Syncs       []*StateSync      `json:"syncs"`
+}
+
+// StateSyncTracker matches the StateSynced logs of L1 with the clerk records of Heimdall by id. Both sides can be
+// added in any order, and as they come - out of order ids are flagged in the order they were added.
+type StateSyncTracker struct {
+	mtx      sync.Mutex
+	syncs    map[uint64]*StateSync
+	l1       stateSyncSequence
+	heimdall stateSyncSequence
+}
+
+func NewStateSyncTracker() *StateSyncTracker {
+	return &StateSyncTracker{syncs: make(map[uint64]*StateSync)}
+}
+
+func (t *StateSyncTracker) get(id uint64) *StateSync {
+	s, ok := t.syncs[id]
+	if !ok {
+		s = &StateSync{ID: id}
+		t.syncs[id] = s
+	}
+	return s
+}
+
+// AddStateSynced adds an L1 log. The same log seen again is ignored, another log with the same id is a conflict.
+func (t *StateSyncTracker) AddStateSynced(ss *StateSynced) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	s := t.get(ss.ID)
+	if s.L1 != nil {
+		if s.L1.TxHash == ss.TxHash && s.L1.LogIndex == ss.LogIndex {
+			return nil
+		}
+		return fmt.Errorf("%w: id %v is log %v of %v and log %v of %v", ErrStateSyncConflict, ss.ID,
+			s.L1.LogIndex, s.L1.TxHash, ss.LogIndex, ss.TxHash)
+	}
+	s.L1 = ss
+	s.match()
+	t.l1.add(ss.ID)
+	return nil
+}
+
+// AddRecord adds a Heimdall record. The same record seen again is ignored, another one with the same id is a
+// conflict.
+func (t *StateSyncTracker) AddRecord(r *ClerkRecord) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	s := t.get(r.ID)
+	if s.Record != nil {
+		if s.Record.TxHash == r.TxHash && s.Record.LogIndex == r.LogIndex {
+			return nil
+		}
+		return fmt.Errorf("%w: record %v is log %v of %v and log %v of %v", ErrStateSyncConflict, r.ID,
+			s.Record.LogIndex, s.Record.TxHash, r.LogIndex, r.TxHash)
+	}
+	s.Record = r
+	s.match()
+	t.heimdall.add(r.ID)
+	return nil
+}
+
+// FetchStateSynced adds the StateSynced logs of blocks from to to.
+func (t *StateSyncTracker) FetchStateSynced(q StateSyncQuerier, stateSender ethgo.Address, from, to uint64) (err error) {
+	var events []*StateSynced
+	if events, err = FetchStateSynced(q, stateSender, from, to); err != nil {
+		return
+	}
+	for _, ss := range events {
+		if err = t.AddStateSynced(ss); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// IngestRecords queries records from to to and adds them, stopping at the first that can't be fetched.
+func (t *StateSyncTracker) IngestRecords(ctx context.Context, client HeimdallClient, from, to uint64, height int64) (err error) {
+	for id := from; id <= to; id++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		var r *ClerkRecord
+		if r, err = GetClerkRecord(client, id, height); err != nil {
+			return fmt.Errorf("record %v: %w", id, err)
+		}
+		if err = t.AddRecord(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// RecordHandler is an EventService handler for EventTypeRecord, that adds the record of each event as of the height
+// it was included at.
+func (t *StateSyncTracker) RecordHandler(client HeimdallClient) EventHandler {
+	return func(ctx context.Context, ev HeimdallEvent) (err error) {
+		var r *ClerkRecord
+		if r, err = GetClerkRecord(client, ev.StateSync.ID, ev.Height); err != nil {
+			return
+		}
+		return t.AddRecord(r)
+	}
+}
+
+// Report is the state of every id tracked so far, sorted by id.
+func (t *StateSyncTracker) Report() *StateSyncReport {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	rep := &StateSyncReport{L1: t.l1.report(), Heimdall: t.heimdall.report()}
+	var total time.Duration
+	for _, s := range t.syncs {
+		c := *s
+		rep.Syncs = append(rep.Syncs, &c)
+	}
+	sort.Slice(rep.Syncs, func(i, j int) bool { return rep.Syncs[i].ID < rep.Syncs[j].ID })
+	for _, s := range rep.Syncs {
+		switch {
+		case s.Record == nil:
+			rep.Pending = append(rep.Pending, s.ID)
+		case s.L1 == nil:
+			rep.Unknown = append(rep.Unknown, s.ID)
+		case s.Mismatch != "":
+			rep.Mismatched = append(rep.Mismatched, s.ID)
+		default:
+			rep.Matched++
+			total += s.Latency
+			rep.MaxLatency = max(rep.MaxLatency, s.Latency)
+		}
+	}
+	if rep.Matched > 0 {
+		rep.MeanLatency = total / time.Duration(rep.Matched)
+	}
+	return rep
+}
@@ -0,0 +1,231 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"math/big"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var syncStateMethod = abi.MustNewMethod("function syncState(address receiver, bytes data)")
+
+// evmL1 is an L1 with the StateSender contract, run in an in-process EVM. It answers the log and block queries of
+// StateSyncQuerier.
+type evmL1 struct {
+	sdb         *state.StateDB
+	sender      common.Address
+	stateSender ethgo.Address
+	blocks      []*ethgo.Block
+	logs        []*ethgo.Log
+}
+
+func newEVML1(t *testing.T) *evmL1 {
+	art, err := os.ReadFile("../build/contracts/root/StateSender.sol/StateSender.json")
+	require.NoError(t, err)
+	var jart struct {
+		Bytecode string `json:"bytecode"`
+	}
+	require.NoError(t, json.Unmarshal(art, &jart))
+
+	l := &evmL1{sender: common.HexToAddress("0x5e4de4")}
+	l.sdb, err = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	_, addr, _, err := runtime.Create(common.FromHex(jart.Bytecode), &runtime.Config{State: l.sdb, Origin: l.sender})
+	require.NoError(t, err)
+	l.stateSender = ethgo.Address(addr)
+	return l
+}
+
+// mine adds a block at timestamp with one syncState tx for each of data, all to receiver.
+func (l *evmL1) mine(t *testing.T, timestamp uint64, receiver ethgo.Address, data ...[]byte) {
+	num := uint64(len(l.blocks) + 1)
+	logIndex := uint64(0)
+	b := &ethgo.Block{Number: num, Timestamp: timestamp, Hash: ethgo.BytesToHash(ethgo.Keccak256([]byte(fmt.Sprintf("l1-block-%v", num))))}
+	for i, d := range data {
+		input, err := syncStateMethod.Encode([]interface{}{receiver, d})
+		require.NoError(t, err)
+		txHash := common.BytesToHash(ethgo.Keccak256([]byte(fmt.Sprintf("l1-tx-%v-%v", num, i))))
+		l.sdb.SetTxContext(txHash, i)
+		_, _, err = runtime.Call(common.Address(l.stateSender), input, &runtime.Config{
+			State: l.sdb, Origin: l.sender, BlockNumber: new(big.Int).SetUint64(num), Time: timestamp,
+		})
+		require.NoError(t, err)
+		for _, log := range l.sdb.GetLogs(txHash, num, common.Hash(b.Hash)) {
+			el := &ethgo.Log{
+				LogIndex:        logIndex,
+				TransactionHash: ethgo.Hash(txHash),
+				BlockNumber:     num,
+				BlockHash:       b.Hash,
+				Address:         ethgo.Address(log.Address),
+				Data:            log.Data,
+			}
+			for _, topic := range log.Topics {
+				el.Topics = append(el.Topics, ethgo.Hash(topic))
+			}
+			l.logs = append(l.logs, el)
+			logIndex++
+		}
+	}
+	l.blocks = append(l.blocks, b)
+}
+
+func (l *evmL1) GetLogs(filter *ethgo.LogFilter) (ret []*ethgo.Log, err error) {
+	for _, log := range l.logs {
+		if log.BlockNumber >= uint64(*filter.From) && log.BlockNumber <= uint64(*filter.To) &&
+			log.Address == filter.Address[0] && log.Topics[0] == *filter.Topics[0][0] {
+			ret = append(ret, log)
+		}
+	}
+	return
+}
+
+func (l *evmL1) GetBlockByNumber(i ethgo.BlockNumber, full bool) (*ethgo.Block, error) {
+	if i < 1 || int(i) > len(l.blocks) {
+		return nil, nil
+	}
+	return l.blocks[i-1], nil
+}
+
+var stateSyncReceiver = ethgo.HexToAddress("0x0000000000000000000000000000000000001001")
+
+// testStateSyncL1 mines state syncs 1 to 6, over 4 blocks 12 seconds apart.
+func testStateSyncL1(t *testing.T) *evmL1 {
+	l := newEVML1(t)
+	l.mine(t, 1700000000, stateSyncReceiver, []byte("sync-1"))
+	l.mine(t, 1700000012, stateSyncReceiver, []byte("sync-2"), []byte("sync-3"))
+	l.mine(t, 1700000024, stateSyncReceiver)
+	l.mine(t, 1700000036, stateSyncReceiver, []byte("sync-4"), []byte("sync-5"), []byte("sync-6"))
+	return l
+}
+
+// testClerkRecord is one of the clerk-records.json fixtures: the record, and the Heimdall height that included it.
+type testClerkRecord struct {
+	Height int64           `json:"height"`
+	Record json.RawMessage `json:"record"`
+}
+
+func loadClerkRecords(t *testing.T) (recs []testClerkRecord) {
+	require.NoError(t, json.Unmarshal(clerkRecordsData, &recs))
+	return
+}
+
+func TestFetchStateSynced(t *testing.T) {
+	l := testStateSyncL1(t)
+	events, err := FetchStateSynced(l, l.stateSender, 2, 4)
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+	for i, ev := range events {
+		require.Equal(t, uint64(i+2), ev.ID)
+		require.Equal(t, ethgo.Address(l.sender), ev.Sender)
+		require.Equal(t, stateSyncReceiver, ev.Receiver)
+		require.Equal(t, fmt.Sprintf("sync-%v", ev.ID), string(ev.Data))
+	}
+	require.Equal(t, uint64(4), events[4].BlockNumber)
+	require.Equal(t, uint64(2), events[4].LogIndex)
+	require.Equal(t, time.Unix(1700000036, 0).UTC(), events[4].Time)
+
+	events, err = FetchStateSynced(l, ethgo.HexToAddress("0x01"), 1, 4)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestStateSyncTracker(t *testing.T) {
+	l := testStateSyncL1(t)
+	tr := NewStateSyncTracker()
+	require.NoError(t, tr.FetchStateSynced(l, l.stateSender, 1, 4))
+
+	// the records come in the order heimdall included them: 1, 3, 2 and 5
+	for _, rec := range loadClerkRecords(t) {
+		var r ClerkRecord
+		require.NoError(t, json.Unmarshal(rec.Record, &r))
+		require.NoError(t, tr.AddRecord(&r))
+	}
+	rep := tr.Report()
+	require.Equal(t, StateSyncSequence{First: 1, Last: 6, Count: 6}, rep.L1)
+	require.Equal(t, StateSyncSequence{First: 1, Last: 5, Count: 4, Gaps: []uint64{4}, OutOfOrder: []uint64{2}}, rep.Heimdall)
+	require.Equal(t, 4, rep.Matched)
+	require.Equal(t, []uint64{4, 6}, rep.Pending)
+	require.Empty(t, rep.Unknown)
+	require.Empty(t, rep.Mismatched)
+	require.Len(t, rep.Syncs, 6)
+	require.Equal(t, 4*time.Minute+48*time.Second, rep.Syncs[0].Latency)
+	require.Equal(t, 5*time.Minute+12*time.Second, rep.MaxLatency)
+	require.Equal(t, 5*time.Minute, rep.MeanLatency)
+
+	// the same log again is fine, another log with its id isn't
+	events, err := FetchStateSynced(l, l.stateSender, 1, 1)
+	require.NoError(t, err)
+	require.NoError(t, tr.AddStateSynced(events[0]))
+	conflict := *events[0]
+	conflict.LogIndex++
+	require.ErrorIs(t, tr.AddStateSynced(&conflict), ErrStateSyncConflict)
+
+	// a record that doesn't match its log, and one for a log that wasn't fetched
+	var r4 ClerkRecord
+	require.NoError(t, json.Unmarshal(loadClerkRecords(t)[3].Record, &r4))
+	r4.ID = 4
+	require.NoError(t, tr.AddRecord(&r4))
+	r7 := r4
+	r7.ID = 7
+	require.NoError(t, tr.AddRecord(&r7))
+	rep = tr.Report()
+	require.Equal(t, []uint64{4}, rep.Mismatched)
+	require.Contains(t, rep.Syncs[3].Mismatch, "record tx")
+	require.Equal(t, []uint64{6}, rep.Pending)
+	require.Equal(t, []uint64{7}, rep.Unknown)
+	require.Equal(t, []uint64{2, 4}, rep.Heimdall.OutOfOrder)
+	require.Equal(t, []uint64{6}, rep.Heimdall.Gaps)
+}
+
+func TestStateSyncTrackerHeimdall(t *testing.T) {
+	l := testStateSyncL1(t)
+	recs := loadClerkRecords(t)
+	m := NewMockHeimdallClient()
+	for _, rec := range recs {
+		var r ClerkRecord
+		require.NoError(t, json.Unmarshal(rec.Record, &r))
+		m.AddQueryAt(rec.Height, QueryRecord, []byte(fmt.Sprintf(`{"record_id":%v}`, r.ID)), rec.Record)
+		m.AddQuery(QueryRecord, []byte(fmt.Sprintf(`{"record_id":%v}`, r.ID)), rec.Record)
+	}
+
+	r, err := GetClerkRecord(m, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), r.ID)
+	require.Equal(t, stateSyncReceiver, r.Contract)
+	require.Equal(t, "sync-3", string(r.Data))
+	require.Equal(t, "80002", r.BorChainID)
+
+	tr := NewStateSyncTracker()
+	require.NoError(t, tr.IngestRecords(context.Background(), m, 1, 3, 0))
+	require.ErrorContains(t, tr.IngestRecords(context.Background(), m, 4, 5, 0), "record 4")
+	require.Equal(t, 3, tr.Report().Heimdall.Count)
+
+	// following the record events of each height
+	tr = NewStateSyncTracker()
+	require.NoError(t, tr.FetchStateSynced(l, l.stateSender, 1, 4))
+	h := tr.RecordHandler(m)
+	for _, rec := range recs {
+		var r ClerkRecord
+		require.NoError(t, json.Unmarshal(rec.Record, &r))
+		he, ok, err := ParseHeimdallEvent(testEvent(EventTypeRecord, attrRecordID, strconv.FormatUint(r.ID, 10),
+			attrRecordContract, r.Contract.String(), attrRecordTxHash, r.TxHash,
+			attrRecordTxLogIndex, strconv.FormatUint(r.LogIndex, 10)), rec.Height)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.NoError(t, h(context.Background(), he))
+	}
+	rep := tr.Report()
+	require.Equal(t, 4, rep.Matched)
+	require.Equal(t, []uint64{2}, rep.Heimdall.OutOfOrder)
+}
@@ -0,0 +1,317 @@
+package heimdall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	abci "github.com/tendermint/tendermint/abci/types"
+	logger "github.com/tendermint/tendermint/libs/log"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"github.com/umbracle/ethgo"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// more event types: the milestone timeout, emitted by the DeliverTx handler of a MsgMilestoneTimeout when no
+// milestone was agreed on in time, and the clerk module's state-sync records.
+const (
+	EventTypeMilestoneTimeout = "milestone-timeout"
+	EventTypeRecord           = "record"
+
+	attrHeaderIndex        = "header-index"
+	attrRecordID           = "record-id"
+	attrRecordContract     = "record-contract"
+	attrRecordTxHash       = "record-tx-hash"
+	attrRecordTxLogIndex   = "record-tx-log-index"
+	eventServiceSubscriber = "heimdall-event-service"
+)
+
+// ErrDisconnected is the subscription channel being closed under the service.
+var ErrDisconnected = errors.New("heimdall event subscription closed")
+
+// StateSyncRecord is a state-sync event: an L1 StateSender log that heimdall has voted in.
+type StateSyncRecord struct {
+	ID       uint64        `json:"id"`
+	Contract ethgo.Address `json:"contract"`
+	TxHash   string        `json:"tx_hash"`
+	LogIndex uint64        `json:"log_index"`
+}
+
+// HeimdallEvent is one typed begin-block or DeliverTx event. Which of the fields is set depends on the type of Raw.
+type HeimdallEvent struct {
+	Height int64
+	Raw    abci.Event
+	// Range is set for checkpoints and milestones.
+	Range *RangeEntry
+	// CheckpointNumber is set for checkpoint acks.
+	CheckpointNumber uint64
+	// StateSync is set for state-sync records.
+	StateSync *StateSyncRecord
+}
+
+func (e *HeimdallEvent) Type() string {
+	return e.Raw.Type
+}
+
+// ParseHeimdallEvent reads one of the events the event service fans out. ok is false for other events and for
+// side-txs that were voted down.
+func ParseHeimdallEvent(ev abci.Event, height int64) (he HeimdallEvent, ok bool, err error) {
+	he = HeimdallEvent{Height: height, Raw: ev}
+	attrs := make(map[string]string, len(ev.Attributes))
+	for _, a := range ev.Attributes {
+		attrs[string(a.Key)] = string(a.Value)
+	}
+	if res, has := attrs[attrSideTxResult]; has && res != abci.SideTxResultType_Yes.String() {
+		return he, false, nil
+	}
+	switch ev.Type {
+	case EventTypeCheckpoint, EventTypeMilestone:
+		var e RangeEntry
+		if e, ok, err = ParseRangeEvent(ev, height); ok {
+			he.Range = &e
+		}
+	case EventTypeCheckpointAck:
+		if he.CheckpointNumber, err = strconv.ParseUint(attrs[attrHeaderIndex], 10, 64); err != nil {
+			return he, false, fmt.Errorf("%v event at %v: %w", ev.Type, height, err)
+		}
+		ok = true
+	case EventTypeMilestoneTimeout:
+		ok = true
+	case EventTypeRecord:
+		r := &StateSyncRecord{Contract: ethgo.HexToAddress(attrs[attrRecordContract]), TxHash: attrs[attrRecordTxHash]}
+		if r.ID, err = strconv.ParseUint(attrs[attrRecordID], 10, 64); err != nil {
+			return he, false, fmt.Errorf("%v event at %v: %w", ev.Type, height, err)
+		}
+		if r.LogIndex, err = strconv.ParseUint(attrs[attrRecordTxLogIndex], 10, 64); err != nil {
+			return he, false, fmt.Errorf("%v event at %v: %w", ev.Type, height, err)
+		}
+		he.StateSync, ok = r, true
+	}
+	return
+}
+
+// EventHandler is called with every event of the types it was registered for. An error stops the service.
+type EventHandler func(ctx context.Context, ev HeimdallEvent) error
+
+// EventService follows new Heimdall blocks and fans their begin-block events, then the events of their txs, out to
+// handlers. It resubscribes when the subscription fails, and fetches the results of any heights it missed in
+// between, so every height after LastHeight is handled exactly once, in order.
+type EventService struct {
+	Client HeimdallClient
+	Logger logger.Logger
+	// RetryDelay is the wait before resubscribing.
+	RetryDelay time.Duration
+
+	mtx        sync.Mutex
+	lastHeight int64
+	handlers   map[string][]EventHandler
+}
+
+// NewEventService creates a service that handles the heights after lastHeight, or starts at the next new block if
+// lastHeight is zero.
+func NewEventService(client HeimdallClient, lastHeight int64) *EventService {
+	return &EventService{
+		Client:     client,
+		Logger:     logger.NewNopLogger(),
+		RetryDelay: 5 * time.Second,
+		lastHeight: lastHeight,
+		handlers:   make(map[string][]EventHandler),
+	}
+}
+
+// Handle registers h for events of the given types.
+func (s *EventService) Handle(h EventHandler, eventTypes ...string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, t := range eventTypes {
+		s.handlers[t] = append(s.handlers[t], h)
+	}
+}
+
+func (s *EventService) handlersFor(eventType string) []EventHandler {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.handlers[eventType]
+}
+
+// LastHeight is the last height whose events were all handled - a restarted service can resume from it.
+func (s *EventService) LastHeight() int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.lastHeight
+}
+
+// Run handles events until ctx is done or a handler fails.
+func (s *EventService) Run(ctx context.Context) error {
+	for {
+		err := s.follow(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var he *handlerError
+		if errors.As(err, &he) {
+			return he.err
+		}
+		s.Logger.Error("EventService | resubscribing", "lastHeight", s.LastHeight(), "Error", err)
+		select {
+		case <-time.After(s.RetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+// liveBlock is a new block whose tx events are still coming in.
+type liveBlock struct {
+	block       *tmTypes.Block
+	beginEvents []abci.Event
+	txEvents    map[uint32][]abci.Event
+}
+
+func (s *EventService) follow(ctx context.Context) (err error) {
+	// tendermint publishes the txs of a block after the block, so a block is handled once its txs are in
+	blockQuery := tmTypes.QueryForEvent(tmTypes.EventNewBlock).String()
+	txQuery := tmTypes.QueryForEvent(tmTypes.EventTx).String()
+	var blockCh, txCh <-chan ctypes.ResultEvent
+	if txCh, err = s.Client.Subscribe(ctx, eventServiceSubscriber, txQuery, txSubscriptionCapacity); err != nil {
+		return
+	}
+	defer s.unsubscribe(txQuery)
+	if blockCh, err = s.Client.Subscribe(ctx, eventServiceSubscriber, blockQuery); err != nil {
+		return
+	}
+	defer s.unsubscribe(blockQuery)
+
+	var live *liveBlock
+	early := make(map[int64]map[uint32][]abci.Event)
+	for {
+		select {
+		case ev, ok := <-blockCh:
+			if !ok {
+				return ErrDisconnected
+			}
+			nb, isBlock := ev.Data.(tmTypes.EventDataNewBlock)
+			if !isBlock {
+				continue
+			}
+			if s.LastHeight() != 0 && nb.Block.Height <= s.LastHeight() {
+				continue
+			}
+			// a block whose txs didn't all arrive is fetched instead
+			live = nil
+			if err = s.catchUp(ctx, nb.Block.Height-1); err != nil {
+				return
+			}
+			if s.LastHeight() == 0 {
+				// the service starts at this block, so it is caught up like any other if its txs don't all arrive
+				s.setLastHeight(nb.Block.Height - 1)
+			}
+			if nb.Block.Height == s.LastHeight()+1 {
+				live = &liveBlock{block: nb.Block, beginEvents: nb.ResultBeginBlock.GetEvents(), txEvents: early[nb.Block.Height]}
+				if live.txEvents == nil {
+					live.txEvents = make(map[uint32][]abci.Event)
+				}
+			}
+			for h := range early {
+				if h <= nb.Block.Height {
+					delete(early, h)
+				}
+			}
+		case ev, ok := <-txCh:
+			if !ok {
+				return ErrDisconnected
+			}
+			tx, isTx := ev.Data.(tmTypes.EventDataTx)
+			if !isTx {
+				continue
+			}
+			switch {
+			case live != nil && tx.Height == live.block.Height:
+				live.txEvents[tx.Index] = tx.Result.Events
+			case tx.Height > s.LastHeight():
+				if early[tx.Height] == nil {
+					early[tx.Height] = make(map[uint32][]abci.Event)
+				}
+				early[tx.Height][tx.Index] = tx.Result.Events
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if live != nil && len(live.txEvents) == len(live.block.Txs) {
+			events := append([]abci.Event{}, live.beginEvents...)
+			for i := range live.block.Txs {
+				events = append(events, live.txEvents[uint32(i)]...)
+			}
+			if err = s.dispatch(ctx, live.block.Height, events); err != nil {
+				return
+			}
+			live = nil
+		}
+	}
+}
+
+// the txs of a block come in a burst, which a subscription with the default capacity of 1 would drop
+const txSubscriptionCapacity = 100
+
+func (s *EventService) unsubscribe(query string) {
+	if err := s.Client.Unsubscribe(context.Background(), eventServiceSubscriber, query); err != nil {
+		s.Logger.Error("EventService | Unsubscribe", "query", query, "Error", err)
+	}
+}
+
+// catchUp handles the heights up to height that came while the service wasn't subscribed, or whose events the
+// subscription dropped.
+func (s *EventService) catchUp(ctx context.Context, height int64) (err error) {
+	for h := s.LastHeight() + 1; s.LastHeight() != 0 && h <= height; h++ {
+		var res *ctypes.ResultBlockResults
+		if res, err = s.Client.BlockResults(&h); err != nil {
+			return
+		}
+		events := append([]abci.Event{}, res.Results.BeginBlock.GetEvents()...)
+		for _, dt := range res.Results.DeliverTx {
+			events = append(events, dt.GetEvents()...)
+		}
+		if err = s.dispatch(ctx, h, events); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *EventService) dispatch(ctx context.Context, height int64, events []abci.Event) (err error) {
+	for _, ev := range events {
+		var he HeimdallEvent
+		var ok bool
+		if he, ok, err = ParseHeimdallEvent(ev, height); err != nil {
+			s.Logger.Error("EventService | skipping event", "height", height, "type", ev.Type, "Error", err)
+			err = nil
+			continue
+		}
+		if !ok {
+			continue
+		}
+		for _, h := range s.handlersFor(ev.Type) {
+			if err = h(ctx, he); err != nil {
+				return &handlerError{fmt.Errorf("%v event at %v: %w", ev.Type, height, err)}
+			}
+		}
+	}
+	s.setLastHeight(height)
+	return
+}
+
+func (s *EventService) setLastHeight(height int64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.lastHeight = height
+}
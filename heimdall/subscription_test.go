@@ -0,0 +1,233 @@
+package heimdall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	tmTypes "github.com/tendermint/tendermint/types"
+	"github.com/umbracle/ethgo"
+	"testing"
+	"time"
+)
+
+func testEvent(typ string, kv ...string) abci.Event {
+	ev := abci.Event{Type: typ}
+	for i := 0; i < len(kv); i += 2 {
+		ev.Attributes = append(ev.Attributes, cmn.KVPair{Key: []byte(kv[i]), Value: []byte(kv[i+1])})
+	}
+	return ev
+}
+
+var (
+	testAckEvent    = testEvent(EventTypeCheckpointAck, attrSideTxResult, "Yes", attrHeaderIndex, "2809")
+	testRecordEvent = testEvent(EventTypeRecord, attrRecordID, "42", attrRecordContract,
+		"0x0000000000000000000000000000000000001001", attrRecordTxHash, "0xabcd", attrRecordTxLogIndex, "3")
+)
+
+func TestParseHeimdallEvent(t *testing.T) {
+	he, ok, err := ParseHeimdallEvent(testAckEvent, 7)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, EventTypeCheckpointAck, he.Type())
+	require.Equal(t, uint64(2809), he.CheckpointNumber)
+	require.Equal(t, int64(7), he.Height)
+
+	he, ok, err = ParseHeimdallEvent(testRecordEvent, 7)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, &StateSyncRecord{ID: 42, Contract: ethgo.HexToAddress("0x1001"), TxHash: "0xabcd", LogIndex: 3}, he.StateSync)
+
+	he, ok, err = ParseHeimdallEvent(milestone1Event, 7)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, milestone1Hash, he.Range.RootHash)
+
+	_, ok, err = ParseHeimdallEvent(testEvent(EventTypeMilestoneTimeout), 7)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = ParseHeimdallEvent(testEvent(EventTypeCheckpointAck, attrSideTxResult, "No", attrHeaderIndex, "1"), 7)
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, ok, err = ParseHeimdallEvent(testEvent(EventTypeStakeUpdate), 7)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, err = ParseHeimdallEvent(testEvent(EventTypeCheckpointAck), 7)
+	require.Error(t, err)
+	_, _, err = ParseHeimdallEvent(testEvent(EventTypeRecord, attrRecordID, "x"), 7)
+	require.Error(t, err)
+}
+
+type seenEvent struct {
+	height int64
+	typ    string
+}
+
+// testTxBlock is a block with a tx for each of txEvents, and their DeliverTx results.
+func testTxBlock(height int64, txEvents ...[]abci.Event) (*tmTypes.Block, []abci.ResponseDeliverTx) {
+	b := testBlock(height)
+	var results []abci.ResponseDeliverTx
+	for i, evs := range txEvents {
+		b.Txs = append(b.Txs, tmTypes.Tx(fmt.Sprintf("tx-%v-%v", height, i)))
+		results = append(results, abci.ResponseDeliverTx{Events: evs})
+	}
+	return b, results
+}
+
+// waitFollowing waits until the event service is subscribed to both blocks and txs.
+func waitFollowing(t *testing.T, m *MockHeimdallClient) {
+	require.Eventually(t, func() bool { return m.Subscribers() == 2 }, time.Second, time.Millisecond)
+}
+
+func TestEventService(t *testing.T) {
+	m := NewMockHeimdallClient()
+	m.AddBlock(testBlock(10), nil)
+	m.AddBlock(testBlock(11), []abci.Event{rangeEvent(EventTypeCheckpoint, "0x11", 1, 256)})
+
+	s := NewEventService(m, 10)
+	s.RetryDelay = time.Millisecond
+	all := make(chan seenEvent, 100)
+	s.Handle(func(ctx context.Context, ev HeimdallEvent) error {
+		all <- seenEvent{ev.Height, ev.Type()}
+		return nil
+	}, EventTypeCheckpoint, EventTypeMilestone, EventTypeCheckpointAck, EventTypeMilestoneTimeout, EventTypeRecord)
+	milestones := make(chan HeimdallEvent, 100)
+	s.Handle(func(ctx context.Context, ev HeimdallEvent) error {
+		milestones <- ev
+		return nil
+	}, EventTypeMilestone)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	waitFollowing(t, m)
+
+	// 11 came before the service subscribed
+	m.AddBlock(testBlock(12), []abci.Event{milestone1Event})
+	require.Eventually(t, func() bool { return s.LastHeight() == 12 }, time.Second, time.Millisecond)
+
+	// 13 and 14 come while the node is down. a milestone timeout is a tx, so its event is in the DeliverTx results
+	m.Disconnect(errors.New("connection refused"))
+	b, results := testTxBlock(13, testEvents("message"), []abci.Event{testEvent(EventTypeMilestoneTimeout)})
+	m.AddBlockResults(b, []abci.Event{testAckEvent}, results)
+	m.AddBlock(testBlock(14), []abci.Event{testRecordEvent, testEvent(EventTypeStakeUpdate)})
+	m.Reconnect()
+	waitFollowing(t, m)
+
+	// and live, from the tx events that follow the block
+	b, results = testTxBlock(15, testEvents("message"), []abci.Event{testEvent(EventTypeMilestoneTimeout)})
+	m.AddBlockResults(b, nil, results)
+	require.Eventually(t, func() bool { return s.LastHeight() == 15 }, time.Second, time.Millisecond)
+
+	// a block that was already handled isn't handled again
+	m.AddBlockResults(b, nil, results)
+	m.AddBlock(testBlock(16), nil)
+	require.Eventually(t, func() bool { return s.LastHeight() == 16 }, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Equal(t, 0, m.Subscribers())
+
+	close(all)
+	var seen []seenEvent
+	for ev := range all {
+		seen = append(seen, ev)
+	}
+	require.Equal(t, []seenEvent{
+		{11, EventTypeCheckpoint},
+		{12, EventTypeMilestone},
+		{13, EventTypeCheckpointAck},
+		{13, EventTypeMilestoneTimeout},
+		{14, EventTypeRecord},
+		{15, EventTypeMilestoneTimeout},
+	}, seen)
+	require.Len(t, milestones, 1)
+	require.Equal(t, "milestone-1", (<-milestones).Range.ID)
+}
+
+func TestEventServiceHandlerError(t *testing.T) {
+	m := NewMockHeimdallClient()
+	s := NewEventService(m, 0)
+	failed := errors.New("handler failed")
+	s.Handle(func(ctx context.Context, ev HeimdallEvent) error {
+		if ev.Height == 21 {
+			return failed
+		}
+		return nil
+	}, EventTypeCheckpointAck)
+
+	done := make(chan error)
+	go func() { done <- s.Run(context.Background()) }()
+	waitFollowing(t, m)
+	// with no last height the service starts at the first new block
+	m.AddBlock(testBlock(20), []abci.Event{testAckEvent})
+	require.Eventually(t, func() bool { return s.LastHeight() == 20 }, time.Second, time.Millisecond)
+	m.AddBlock(testBlock(21), []abci.Event{testAckEvent})
+	require.ErrorIs(t, <-done, failed)
+	// so the failed height is handled again by a restarted service
+	require.Equal(t, int64(20), s.LastHeight())
+}
+
+func TestEventServiceFirstBlockDropped(t *testing.T) {
+	m := NewMockHeimdallClient()
+	// the first new block has a tx whose event never arrives, so it is fetched when the next block comes
+	first, results := testTxBlock(20, []abci.Event{testEvent(EventTypeMilestoneTimeout)})
+	m.AddBlockResults(first, []abci.Event{testAckEvent}, results)
+
+	s := NewEventService(m, 0)
+	seen := make(chan seenEvent, 100)
+	s.Handle(func(ctx context.Context, ev HeimdallEvent) error {
+		seen <- seenEvent{ev.Height, ev.Type()}
+		return nil
+	}, EventTypeCheckpointAck, EventTypeMilestoneTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	waitFollowing(t, m)
+	m.Publish(tmTypes.EventDataNewBlock{Block: first, ResultBeginBlock: abci.ResponseBeginBlock{Events: []abci.Event{testAckEvent}}})
+	// the service starts at 20
+	require.Eventually(t, func() bool { return s.LastHeight() == 19 }, time.Second, time.Millisecond)
+	m.AddBlock(testBlock(21), []abci.Event{testAckEvent})
+	require.Eventually(t, func() bool { return s.LastHeight() == 21 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	close(seen)
+	var all []seenEvent
+	for ev := range seen {
+		all = append(all, ev)
+	}
+	require.Equal(t, []seenEvent{
+		{20, EventTypeCheckpointAck},
+		{20, EventTypeMilestoneTimeout},
+		{21, EventTypeCheckpointAck},
+	}, all)
+}
+
+func TestEventServiceUnparseableEvent(t *testing.T) {
+	m := NewMockHeimdallClient()
+	s := NewEventService(m, 0)
+	acks := make(chan uint64, 100)
+	s.Handle(func(ctx context.Context, ev HeimdallEvent) error {
+		acks <- ev.CheckpointNumber
+		return nil
+	}, EventTypeCheckpointAck)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	waitFollowing(t, m)
+	// an event that doesn't parse is skipped, the rest of the block is still handled
+	badAck := testEvent(EventTypeCheckpointAck, attrSideTxResult, "Yes", attrHeaderIndex, "not-a-number")
+	m.AddBlock(testBlock(30), []abci.Event{badAck, testAckEvent})
+	m.AddBlock(testBlock(31), []abci.Event{testAckEvent})
+	require.Eventually(t, func() bool { return s.LastHeight() == 31 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Len(t, acks, 2)
+}
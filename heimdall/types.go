@@ -0,0 +1,221 @@
+package heimdall
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	amino "github.com/tendermint/go-amino"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"github.com/umbracle/ethgo"
+	"strings"
+)
+
+// models for the Heimdall checkpoint module, as returned by the REST server and ABCI queries. amino JSON (txs)
+// encodes 64 bit integers as strings, the checkpoint module's queries encode them as numbers.
+
+// HeimdallAddress is an address that encodes as lowercase hex like Heimdall does, rather than checksummed.
+type HeimdallAddress ethgo.Address
+
+func (a HeimdallAddress) MarshalText() ([]byte, error) {
+	return []byte("0x" + hex.EncodeToString(a[:])), nil
+}
+
+func (a *HeimdallAddress) UnmarshalText(text []byte) error {
+	return (*ethgo.Address)(a).UnmarshalText(text)
+}
+
+func (a HeimdallAddress) String() string {
+	return ethgo.Address(a).String()
+}
+
+// HexBytes is hex without a 0x prefix, as side-tx data is encoded.
+type HexBytes []byte
+
+func (b HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+func (b *HexBytes) UnmarshalText(text []byte) (err error) {
+	*b, err = hex.DecodeString(strings.TrimPrefix(string(text), "0x"))
+	return
+}
+
+// Checkpoint is a checkpoint as returned by the checkpoint queries. ID is only set in REST responses - in ABCI
+// queries it is the query parameter.
+type Checkpoint struct {
+	ID         uint64          `json:"id,omitempty"`
+	Proposer   HeimdallAddress `json:"proposer"`
+	StartBlock uint64          `json:"start_block"`
+	EndBlock   uint64          `json:"end_block"`
+	RootHash   ethgo.Hash      `json:"root_hash"`
+	BorChainID string          `json:"bor_chain_id"`
+	Timestamp  uint64          `json:"timestamp"`
+}
+
+// Milestone is a milestone as returned by the milestone queries.
+type Milestone struct {
+	Proposer    HeimdallAddress `json:"proposer"`
+	StartBlock  uint64          `json:"start_block"`
+	EndBlock    uint64          `json:"end_block"`
+	Hash        ethgo.Hash      `json:"hash"`
+	BorChainID  string          `json:"bor_chain_id"`
+	MilestoneID string          `json:"milestone_id"`
+	Timestamp   uint64          `json:"timestamp"`
+}
+
+// MsgMilestone is the checkpoint/MsgMilestone tx message.
+type MsgMilestone struct {
+	Proposer    HeimdallAddress `json:"proposer"`
+	StartBlock  uint64          `json:"start_block,string"`
+	EndBlock    uint64          `json:"end_block,string"`
+	Hash        ethgo.Hash      `json:"hash"`
+	BorChainID  string          `json:"bor_chain_id"`
+	MilestoneID string          `json:"milestone_id"`
+}
+
+const MsgMilestoneType = "checkpoint/MsgMilestone"
+
+type EventAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type StringEvent struct {
+	Type       string           `json:"type"`
+	Attributes []EventAttribute `json:"attributes"`
+}
+
+// Attr is the value of the first attribute with key.
+func (e *StringEvent) Attr(key string) (string, bool) {
+	for _, a := range e.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+type ABCIMessageLog struct {
+	MsgIndex int           `json:"msg_index"`
+	Success  bool          `json:"success"`
+	Log      string        `json:"log"`
+	Events   []StringEvent `json:"events"`
+}
+
+// TypedValue is an amino JSON {"type", "value"} envelope.
+type TypedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type StdTx struct {
+	Msg       TypedValue `json:"msg"`
+	Signature string     `json:"signature"`
+	Memo      string     `json:"memo"`
+}
+
+// TxResponse is a tx from the REST /txs/{hash} endpoint, without the {"height", "result"} wrapper.
+type TxResponse struct {
+	Height    uint64           `json:"height,string"`
+	TxHash    string           `json:"txhash"`
+	RawLog    string           `json:"raw_log"`
+	Logs      []ABCIMessageLog `json:"logs"`
+	GasWanted uint64           `json:"gas_wanted,string"`
+	GasUsed   uint64           `json:"gas_used,string"`
+	Tx        struct {
+		Type  string `json:"type"`
+		Value StdTx  `json:"value"`
+	} `json:"tx"`
+	Timestamp string        `json:"timestamp"`
+	Events    []StringEvent `json:"events"`
+}
+
+// Event is the first event of type typ.
+func (r *TxResponse) Event(typ string) (*StringEvent, bool) {
+	for i := range r.Events {
+		if r.Events[i].Type == typ {
+			return &r.Events[i], true
+		}
+	}
+	return nil, false
+}
+
+// MsgMilestone decodes the tx message, which has to be a MsgMilestone.
+func (r *TxResponse) MsgMilestone() (msg *MsgMilestone, err error) {
+	if r.Tx.Value.Msg.Type != MsgMilestoneType {
+		return nil, fmt.Errorf("tx %v is a %v, not a %v", r.TxHash, r.Tx.Value.Msg.Type, MsgMilestoneType)
+	}
+	msg = &MsgMilestone{}
+	err = json.Unmarshal(r.Tx.Value.Msg.Value, msg)
+	return
+}
+
+// SideTxResponse is the REST /txs/{hash}/side-tx response: the signed side-tx data, the validator signatures over
+// it and the encoded tx.
+type SideTxResponse struct {
+	Data HexBytes    `json:"data"`
+	Sigs []SideTxSig `json:"sigs"`
+	Tx   HexBytes    `json:"tx"`
+}
+
+// restResponse is the {"height", "result"} wrapper of Heimdall REST responses.
+type restResponse[T any] struct {
+	Height uint64 `json:"height,string"`
+	Result T      `json:"result"`
+}
+
+func decodeREST[T any](data []byte) (res *T, height uint64, err error) {
+	var rr restResponse[T]
+	if err = json.Unmarshal(data, &rr); err != nil {
+		return
+	}
+	return &rr.Result, rr.Height, nil
+}
+
+// DecodeTxResponse decodes a REST /txs/{hash} response. height is the height of the REST response, not the tx.
+func DecodeTxResponse(data []byte) (tx *TxResponse, height uint64, err error) {
+	return decodeREST[TxResponse](data)
+}
+
+// DecodeSideTxResponse decodes a REST /txs/{hash}/side-tx response.
+func DecodeSideTxResponse(data []byte) (stx *SideTxResponse, height uint64, err error) {
+	return decodeREST[SideTxResponse](data)
+}
+
+// DecodeCheckpointResponse decodes a REST checkpoint response.
+func DecodeCheckpointResponse(data []byte) (cp *Checkpoint, height uint64, err error) {
+	return decodeREST[Checkpoint](data)
+}
+
+// DecodeCheckpointQuery decodes the value of a custom/checkpoint checkpoint query.
+func DecodeCheckpointQuery(value []byte) (cp *Checkpoint, err error) {
+	cp = &Checkpoint{}
+	err = json.Unmarshal(value, cp)
+	return
+}
+
+// DecodeMilestoneQuery decodes the value of a custom/checkpoint milestone query.
+func DecodeMilestoneQuery(value []byte) (m *Milestone, err error) {
+	m = &Milestone{}
+	err = json.Unmarshal(value, m)
+	return
+}
+
+// DecodeAckCountQuery decodes the value of a custom/checkpoint/ack-count query.
+func DecodeAckCountQuery(value []byte) (ackCount uint64, err error) {
+	err = json.Unmarshal(value, &ackCount)
+	return
+}
+
+var rpcCdc = amino.NewCodec()
+
+func init() {
+	ctypes.RegisterAmino(rpcCdc)
+}
+
+// DecodeResultBlock decodes the result of a Tendermint RPC /block response, which is amino JSON.
+func DecodeResultBlock(data []byte) (rb *ctypes.ResultBlock, err error) {
+	rb = &ctypes.ResultBlock{}
+	err = rpcCdc.UnmarshalJSON(data, rb)
+	return
+}
@@ -0,0 +1,93 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"testing"
+)
+
+// requireRoundTrip re-encodes v in the {"height", "result"} wrapper and compares it to the original.
+func requireRoundTrip(t *testing.T, orig []byte, height uint64, v interface{}) {
+	out, err := json.Marshal(restResponse[interface{}]{Height: height, Result: v})
+	require.NoError(t, err)
+	require.JSONEq(t, string(orig), string(out))
+}
+
+func TestDecodeTxResponse(t *testing.T) {
+	tx, height, err := DecodeTxResponse(milestoneData)
+	require.NoError(t, err)
+	requireRoundTrip(t, milestoneData, height, tx)
+
+	require.Equal(t, uint64(1588003), tx.Height)
+	require.Equal(t, uint64(89730), tx.GasUsed)
+	msg, err := tx.MsgMilestone()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3887749), msg.StartBlock)
+	require.Equal(t, uint64(3887762), msg.EndBlock)
+	require.Equal(t, ethgo.HexToHash("0x6f73bdeda24c8d6b978628e10c425f5a8bbf181a547dafdf5eb156135626728e"), msg.Hash)
+	require.Equal(t, "80002", msg.BorChainID)
+
+	// the event attributes and the raw log agree with the message
+	ev, ok := tx.Event("milestone")
+	require.True(t, ok)
+	proposer, _ := ev.Attr("proposer")
+	require.Equal(t, ethgo.Address(msg.Proposer), ethgo.HexToAddress(proposer))
+	var rawLogs []ABCIMessageLog
+	require.NoError(t, json.Unmarshal([]byte(tx.RawLog), &rawLogs))
+	require.Equal(t, tx.Logs, rawLogs)
+
+	tx.Tx.Value.Msg.Type = "checkpoint/MsgCheckpoint"
+	_, err = tx.MsgMilestone()
+	require.Error(t, err)
+}
+
+func TestDecodeSideTxResponse(t *testing.T) {
+	stx, height, err := DecodeSideTxResponse(sideTxData)
+	require.NoError(t, err)
+	requireRoundTrip(t, sideTxData, height, stx)
+	require.Equal(t, 7, len(stx.Sigs))
+
+	// the side-tx data is the milestone the tx proposed
+	tx, _, err := DecodeTxResponse(milestoneData)
+	require.NoError(t, err)
+	msg, err := tx.MsgMilestone()
+	require.NoError(t, err)
+	tt, err := abi.NewType("(address, uint256, uint256, bytes32, uint256, uint256)")
+	require.NoError(t, err)
+	dd, err := abi.Decode(tt, stx.Data)
+	require.NoError(t, err)
+	fields := dd.(map[string]interface{})
+	require.Equal(t, ethgo.Address(msg.Proposer), fields["0"])
+	require.Equal(t, msg.StartBlock, fields["1"].(interface{ Uint64() uint64 }).Uint64())
+	require.Equal(t, msg.EndBlock, fields["2"].(interface{ Uint64() uint64 }).Uint64())
+	require.Equal(t, [32]byte(msg.Hash), fields["3"])
+}
+
+func TestDecodeCheckpoint(t *testing.T) {
+	cp, height, err := DecodeCheckpointResponse(checkpoint2809Data)
+	require.NoError(t, err)
+	requireRoundTrip(t, checkpoint2809Data, height, cp)
+	require.Equal(t, uint64(2809), cp.ID)
+	require.Equal(t, ethgo.HexToHash(checkpoint2809Root), cp.RootHash)
+
+	// the ABCI query value is the checkpoint without the id
+	value := []byte(`{"proposer":"0x6dc2dd54f24979ec26212794c71afefed722280c","start_block":3639411,"end_block":3639922,` +
+		`"root_hash":"0x80df8b6d4fa3731c4b4960522efba1602e23ee1ebff9ac5f237a540de04df4cc","bor_chain_id":"80002","timestamp":1708275729}`)
+	qcp, err := DecodeCheckpointQuery(value)
+	require.NoError(t, err)
+	qcp.ID = cp.ID
+	require.Equal(t, cp, qcp)
+
+	ackCount, err := DecodeAckCountQuery([]byte("2809"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2809), ackCount)
+
+	m, err := DecodeMilestoneQuery([]byte(`{"proposer":"0x4ad84f7014b7b44f723f284a85b1662337971439","start_block":3887749,"end_block":3887762,` +
+		`"hash":"0x6f73bdeda24c8d6b978628e10c425f5a8bbf181a547dafdf5eb156135626728e","bor_chain_id":"80002",` +
+		`"milestone_id":"246ae205-2b01-416a-b889-b2fcac3ece81 - 0x0c425f5a8bbf181a547dafdf5eb156135626728e","timestamp":1708802221}`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3887762), m.EndBlock)
+	require.Equal(t, "0x4ad84f7014b7b44f723f284a85b1662337971439", func() string { b, _ := m.Proposer.MarshalText(); return string(b) }())
+}
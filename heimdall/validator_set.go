@@ -0,0 +1,83 @@
+package heimdall
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/umbracle/ethgo"
+)
+
+// Validator is a Heimdall staking validator. The json tags follow the validator-set REST response and the
+// custom/staking query values, so one can be decoded directly.
+type Validator struct {
+	ID          uint64        `json:"ID"`
+	Signer      ethgo.Address `json:"signer"`
+	VotingPower int64         `json:"power"`
+	// the epochs are checkpoint ack counts. EndEpoch is zero until the validator unstakes.
+	StartEpoch uint64        `json:"startEpoch,omitempty"`
+	EndEpoch   uint64        `json:"endEpoch,omitempty"`
+	Nonce      uint64        `json:"nonce,omitempty"`
+	PubKey     hexutil.Bytes `json:"pubKey,omitempty"`
+	Jailed     bool          `json:"jailed,omitempty"`
+}
+
+// IsCurrent is heimdall's check for a validator being in the set once ackCount checkpoints have been acked - the
+// current epoch is ackCount+1.
+func (v *Validator) IsCurrent(ackCount uint64) bool {
+	epoch := ackCount + 1
+	return v.StartEpoch <= epoch && (v.EndEpoch == 0 || v.EndEpoch > epoch) && v.VotingPower > 0 && !v.Jailed
+}
+
+// ValidatorSet is a set of validators, unique by signer address.
+type ValidatorSet struct {
+	Validators []Validator `json:"validators"`
+	bySigner   map[ethgo.Address]int
+	totalPower int64
+}
+
+func NewValidatorSet(vals []Validator) (vs *ValidatorSet, err error) {
+	vs = &ValidatorSet{Validators: vals, bySigner: make(map[ethgo.Address]int, len(vals))}
+	for i, v := range vals {
+		if _, ok := vs.bySigner[v.Signer]; ok {
+			return nil, fmt.Errorf("duplicate validator %v", v.Signer)
+		}
+		if v.VotingPower <= 0 {
+			return nil, fmt.Errorf("validator %v has voting power %v", v.Signer, v.VotingPower)
+		}
+		vs.bySigner[v.Signer] = i
+		vs.totalPower += v.VotingPower
+	}
+	return
+}
+
+// DecodeValidatorSet decodes a validator-set response, with or without the {"height", "result"} REST wrapper.
+func DecodeValidatorSet(data []byte) (*ValidatorSet, error) {
+	var wrapped struct {
+		Result *ValidatorSet `json:"result"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Result != nil {
+		return NewValidatorSet(wrapped.Result.Validators)
+	}
+	var vs ValidatorSet
+	if err := json.Unmarshal(data, &vs); err != nil {
+		return nil, err
+	}
+	return NewValidatorSet(vs.Validators)
+}
+
+func (vs *ValidatorSet) BySigner(signer ethgo.Address) (v Validator, ok bool) {
+	var i int
+	if i, ok = vs.bySigner[signer]; ok {
+		v = vs.Validators[i]
+	}
+	return
+}
+
+func (vs *ValidatorSet) TotalVotingPower() int64 {
+	return vs.totalPower
+}
+
+// HasQuorum is true if power is more than 2/3 of the total voting power.
+func (vs *ValidatorSet) HasQuorum(power int64) bool {
+	return power*3 > vs.totalPower*2
+}
@@ -0,0 +1,230 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	abci "github.com/tendermint/tendermint/abci/types"
+	httpClient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// event types of the staking module's side-tx post handlers, and the checkpoint ack that starts a new epoch. like
+// the checkpoint events, they are emitted in the begin blocker.
+const (
+	EventTypeValidatorJoin = "validator-join"
+	EventTypeSignerUpdate  = "signer-update"
+	EventTypeStakeUpdate   = "stake-update"
+	EventTypeValidatorExit = "validator-exit"
+	EventTypeCheckpointAck = "checkpoint-ack"
+
+	attrValidatorID = "validator-id"
+)
+
+const (
+	QueryCurrentValidatorSet = "custom/staking/current-validator-set"
+	QueryValidator           = "custom/staking/validator"
+	QueryAckCount            = "custom/checkpoint/ack-count"
+)
+
+var ErrHeightNotTracked = errors.New("heimdall height is not covered by the tracker")
+
+// ValidatorSetChange is the state of the staking module after the begin blocker of Height: every validator known to
+// the tracker, current or not, sorted by ID, and the ack count that decides which are current.
+type ValidatorSetChange struct {
+	Height     int64       `json:"height"`
+	AckCount   uint64      `json:"ack_count"`
+	Validators []Validator `json:"validators"`
+}
+
+// Current is the validator set made of the validators that are current at the change's ack count.
+func (c *ValidatorSetChange) Current() (*ValidatorSet, error) {
+	var vals []Validator
+	for i := range c.Validators {
+		if c.Validators[i].IsCurrent(c.AckCount) {
+			vals = append(vals, c.Validators[i])
+		}
+	}
+	return NewValidatorSet(vals)
+}
+
+// ValidatorTracker builds the history of the Heimdall validator set. It is seeded with the current validator set at
+// one height, then follows the staking and checkpoint ack events of every later height, re-querying the validators
+// they name. The queries are at the event's height, so the node has to keep state that far back.
+type ValidatorTracker struct {
+	Client HeimdallClient
+	// History is sorted by height, with an entry for the seed and for every height that changed the set.
+	History []ValidatorSetChange
+	// LastHeight is the last Heimdall height ingested.
+	LastHeight int64
+}
+
+func NewValidatorTracker(client HeimdallClient) *ValidatorTracker {
+	return &ValidatorTracker{Client: client}
+}
+
+func queryAt(client HeimdallClient, path string, data []byte, height int64) (value []byte, err error) {
+	var res *ctypes.ResultABCIQuery
+	if res, err = client.ABCIQueryWithOptions(path, data, httpClient.ABCIQueryOptions{Height: height}); err != nil {
+		return
+	}
+	if res.Response.IsErr() {
+		return nil, fmt.Errorf("query %v at %v: %v", path, height, res.Response.Log)
+	}
+	return res.Response.Value, nil
+}
+
+func queryValidator(client HeimdallClient, id uint64, height int64) (v Validator, err error) {
+	var value []byte
+	if value, err = queryAt(client, QueryValidator, []byte(fmt.Sprintf(`{"validator_id":%v}`, id)), height); err != nil {
+		return
+	}
+	err = json.Unmarshal(value, &v)
+	return
+}
+
+func queryAckCount(client HeimdallClient, height int64) (ackCount uint64, err error) {
+	var value []byte
+	if value, err = queryAt(client, QueryAckCount, nil, height); err != nil {
+		return
+	}
+	return DecodeAckCountQuery(value)
+}
+
+// Start seeds the history with the validator set at height. Ingesting continues from height+1.
+func (vt *ValidatorTracker) Start(height int64) (err error) {
+	var value []byte
+	if value, err = queryAt(vt.Client, QueryCurrentValidatorSet, nil, height); err != nil {
+		return
+	}
+	var vs *ValidatorSet
+	if vs, err = DecodeValidatorSet(value); err != nil {
+		return
+	}
+	c := ValidatorSetChange{Height: height, Validators: vs.Validators}
+	sort.Slice(c.Validators, func(i, j int) bool { return c.Validators[i].ID < c.Validators[j].ID })
+	if c.AckCount, err = queryAckCount(vt.Client, height); err != nil {
+		return
+	}
+	vt.History, vt.LastHeight = []ValidatorSetChange{c}, height
+	return
+}
+
+// IngestHeight applies the staking and ack events of the next Heimdall height.
+func (vt *ValidatorTracker) IngestHeight(ctx context.Context, height int64) (err error) {
+	if len(vt.History) == 0 {
+		return errors.New("validator tracker is not started")
+	}
+	if height != vt.LastHeight+1 {
+		return fmt.Errorf("next height to ingest is %v, not %v", vt.LastHeight+1, height)
+	}
+	var events []abci.Event
+	if events, err = GetBeginBlockEvents(ctx, vt.Client, height); err != nil {
+		return
+	}
+
+	last := &vt.History[len(vt.History)-1]
+	next := ValidatorSetChange{Height: height, AckCount: last.AckCount, Validators: append([]Validator(nil), last.Validators...)}
+	for _, ev := range events {
+		attrs := make(map[string]string, len(ev.Attributes))
+		for _, a := range ev.Attributes {
+			attrs[string(a.Key)] = string(a.Value)
+		}
+		if res, has := attrs[attrSideTxResult]; has && res != abci.SideTxResultType_Yes.String() {
+			continue
+		}
+		switch ev.Type {
+		case EventTypeCheckpointAck:
+			if next.AckCount, err = queryAckCount(vt.Client, height); err != nil {
+				return
+			}
+		case EventTypeValidatorJoin, EventTypeSignerUpdate, EventTypeStakeUpdate, EventTypeValidatorExit:
+			var id uint64
+			if id, err = strconv.ParseUint(attrs[attrValidatorID], 10, 64); err != nil {
+				return fmt.Errorf("%v event at %v: %w", ev.Type, height, err)
+			}
+			var v Validator
+			if v, err = queryValidator(vt.Client, id, height); err != nil {
+				return
+			}
+			next.setValidator(v)
+		}
+	}
+	if !reflect.DeepEqual(next.Validators, last.Validators) || next.AckCount != last.AckCount {
+		vt.History = append(vt.History, next)
+	}
+	vt.LastHeight = height
+	return
+}
+
+func (c *ValidatorSetChange) setValidator(v Validator) {
+	i := sort.Search(len(c.Validators), func(i int) bool { return c.Validators[i].ID >= v.ID })
+	if i < len(c.Validators) && c.Validators[i].ID == v.ID {
+		c.Validators[i] = v
+		return
+	}
+	c.Validators = append(c.Validators, Validator{})
+	copy(c.Validators[i+1:], c.Validators[i:])
+	c.Validators[i] = v
+}
+
+// IngestRange ingests heights from through to, inclusive.
+func (vt *ValidatorTracker) IngestRange(ctx context.Context, from, to int64) (err error) {
+	for h := from; h <= to; h++ {
+		if err = vt.IngestHeight(ctx, h); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ValidatorSetAt is the validator set after the begin blocker of height, which is the set whose votes count for the
+// side-txs included in that block.
+func (vt *ValidatorTracker) ValidatorSetAt(height int64) (*ValidatorSet, error) {
+	if len(vt.History) == 0 || height < vt.History[0].Height || height > vt.LastHeight {
+		return nil, fmt.Errorf("%w: %v", ErrHeightNotTracked, height)
+	}
+	i := sort.Search(len(vt.History), func(i int) bool { return vt.History[i].Height > height })
+	return vt.History[i-1].Current()
+}
+
+type validatorTrackerFile struct {
+	LastHeight int64                `json:"last_height"`
+	History    []ValidatorSetChange `json:"history"`
+}
+
+// Save writes the history to path, through a temp file like RangeIndexer.Save.
+func (vt *ValidatorTracker) Save(path string) (err error) {
+	var data []byte
+	if data, err = json.Marshal(&validatorTrackerFile{LastHeight: vt.LastHeight, History: vt.History}); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadValidatorTracker reads a history written by Save. Ingesting can resume from LastHeight+1.
+func LoadValidatorTracker(client HeimdallClient, path string) (vt *ValidatorTracker, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	var f validatorTrackerFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return
+	}
+	for i := 1; i < len(f.History); i++ {
+		if f.History[i].Height <= f.History[i-1].Height {
+			return nil, fmt.Errorf("validator history is not sorted at height %v", f.History[i].Height)
+		}
+	}
+	return &ValidatorTracker{Client: client, History: f.History, LastHeight: f.LastHeight}, nil
+}
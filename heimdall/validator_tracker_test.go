@@ -0,0 +1,153 @@
+package heimdall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/umbracle/ethgo"
+	"path/filepath"
+	"testing"
+)
+
+func stakingEvent(typ string, id uint64, result string) abci.Event {
+	return abci.Event{Type: typ, Attributes: []cmn.KVPair{
+		{Key: []byte("module"), Value: []byte("staking")},
+		{Key: []byte(attrSideTxResult), Value: []byte(result)},
+		{Key: []byte(attrValidatorID), Value: []byte(fmt.Sprint(id))},
+	}}
+}
+
+func addValidatorQuery(t *testing.T, m *MockHeimdallClient, height int64, v Validator) {
+	value, err := json.Marshal(v)
+	require.NoError(t, err)
+	m.AddQueryAt(height, QueryValidator, []byte(fmt.Sprintf(`{"validator_id":%v}`, v.ID)), value)
+}
+
+func testValidator(id uint64, power int64) Validator {
+	return Validator{ID: id, Signer: ethgo.BytesToAddress([]byte{byte(id)}), VotingPower: power, StartEpoch: 1}
+}
+
+// a fixture event stream from height 100, where 3 validators are current at ack count 10:
+//
+//	101: a stake update that was voted down
+//	102: validator 4 joins, starting in epoch 12
+//	103: validator 2 stakes more
+//	104: checkpoint 11 is acked, so validator 4 is current
+//	105: validator 1 unstakes, leaving in epoch 13
+//	106: checkpoint 12 is acked, so validator 1 is gone
+//	107: nothing
+func testValidatorStream(t *testing.T) *MockHeimdallClient {
+	m := NewMockHeimdallClient()
+	seed, err := json.Marshal(&ValidatorSet{Validators: []Validator{testValidator(3, 30), testValidator(1, 10), testValidator(2, 20)}})
+	require.NoError(t, err)
+	m.AddQueryAt(100, QueryCurrentValidatorSet, nil, seed)
+	m.AddQuery(QueryAckCount, nil, []byte("10"))
+
+	v4 := testValidator(4, 40)
+	v4.StartEpoch = 12
+	addValidatorQuery(t, m, 102, v4)
+	v2 := testValidator(2, 25)
+	v2.Nonce = 1
+	addValidatorQuery(t, m, 103, v2)
+	m.AddQueryAt(104, QueryAckCount, nil, []byte("11"))
+	v1 := testValidator(1, 10)
+	v1.EndEpoch = 13
+	addValidatorQuery(t, m, 105, v1)
+	m.AddQueryAt(106, QueryAckCount, nil, []byte("12"))
+
+	events := map[int64][]abci.Event{
+		101: {stakingEvent(EventTypeStakeUpdate, 3, "No")},
+		102: {stakingEvent(EventTypeValidatorJoin, 4, "Yes")},
+		103: {stakingEvent(EventTypeStakeUpdate, 2, "Yes")},
+		104: {{Type: EventTypeCheckpointAck}},
+		105: {stakingEvent(EventTypeValidatorExit, 1, "Yes")},
+		106: {{Type: EventTypeCheckpointAck}},
+	}
+	for h := int64(101); h <= 107; h++ {
+		m.AddBlock(testBlock(h), events[h])
+	}
+	return m
+}
+
+func currentPowers(t *testing.T, vt *ValidatorTracker, height int64) map[uint64]int64 {
+	vs, err := vt.ValidatorSetAt(height)
+	require.NoError(t, err)
+	powers := make(map[uint64]int64)
+	for _, v := range vs.Validators {
+		powers[v.ID] = v.VotingPower
+	}
+	return powers
+}
+
+func TestValidatorTracker(t *testing.T) {
+	m := testValidatorStream(t)
+	vt := NewValidatorTracker(m)
+	require.Error(t, vt.IngestHeight(context.Background(), 101))
+	require.NoError(t, vt.Start(100))
+	require.Error(t, vt.IngestHeight(context.Background(), 102))
+	require.NoError(t, vt.IngestRange(context.Background(), 101, 107))
+	require.Equal(t, int64(107), vt.LastHeight)
+
+	// the voted down update and the empty block don't change anything
+	var heights []int64
+	for _, c := range vt.History {
+		heights = append(heights, c.Height)
+	}
+	require.Equal(t, []int64{100, 102, 103, 104, 105, 106}, heights)
+
+	expected := map[int64]map[uint64]int64{
+		100: {1: 10, 2: 20, 3: 30},
+		101: {1: 10, 2: 20, 3: 30},
+		102: {1: 10, 2: 20, 3: 30},
+		103: {1: 10, 2: 25, 3: 30},
+		104: {1: 10, 2: 25, 3: 30, 4: 40},
+		105: {1: 10, 2: 25, 3: 30, 4: 40},
+		106: {2: 25, 3: 30, 4: 40},
+		107: {2: 25, 3: 30, 4: 40},
+	}
+	for h, powers := range expected {
+		require.Equal(t, powers, currentPowers(t, vt, h), "height %v", h)
+	}
+	vs, err := vt.ValidatorSetAt(106)
+	require.NoError(t, err)
+	require.Equal(t, int64(95), vs.TotalVotingPower())
+
+	_, err = vt.ValidatorSetAt(99)
+	require.ErrorIs(t, err, ErrHeightNotTracked)
+	_, err = vt.ValidatorSetAt(108)
+	require.ErrorIs(t, err, ErrHeightNotTracked)
+
+	path := filepath.Join(t.TempDir(), "validators.json")
+	require.NoError(t, vt.Save(path))
+	loaded, err := LoadValidatorTracker(m, path)
+	require.NoError(t, err)
+	require.Equal(t, vt.History, loaded.History)
+	require.Equal(t, vt.LastHeight, loaded.LastHeight)
+	for h, powers := range expected {
+		require.Equal(t, powers, currentPowers(t, loaded, h), "height %v", h)
+	}
+
+	// and resumes after the last ingested height
+	require.Error(t, loaded.IngestHeight(context.Background(), 107))
+	m.AddBlock(testBlock(108), nil)
+	require.NoError(t, loaded.IngestHeight(context.Background(), 108))
+
+	// an event naming a validator that can't be queried stops ingesting at that height
+	m.AddBlock(testBlock(109), []abci.Event{stakingEvent(EventTypeStakeUpdate, 9, "Yes")})
+	require.Error(t, loaded.IngestHeight(context.Background(), 109))
+	require.Equal(t, int64(108), loaded.LastHeight)
+}
+
+func TestValidatorIsCurrent(t *testing.T) {
+	v := Validator{StartEpoch: 5, EndEpoch: 8, VotingPower: 1}
+	// the current epoch is one more than the ack count
+	require.False(t, v.IsCurrent(3))
+	require.True(t, v.IsCurrent(4))
+	require.True(t, v.IsCurrent(6))
+	require.False(t, v.IsCurrent(7))
+	v.Jailed = true
+	require.False(t, v.IsCurrent(5))
+}
@@ -0,0 +1,326 @@
+package heimdall
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/wallet"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// WitnessSchemaVersion is the version of the witness layout, bumped on any change to the JSON or binary encoding.
+const WitnessSchemaVersion = 1
+
+// witnessMagic starts the binary encoding.
+var witnessMagic = [4]byte{'B', 'P', 'W', 'T'}
+
+var ErrInvalidWitness = errors.New("invalid witness")
+
+// WitnessValidator is a validator as the circuit sees it.
+type WitnessValidator struct {
+	Signer ethgo.Address `json:"signer"`
+	Power  uint64        `json:"power"`
+}
+
+// WitnessSignature is a signature over the side-tx sign bytes, with the index of its signer in the witness'
+// validators. The indices are strictly increasing, so a circuit can rule out a validator signing twice without a
+// lookup.
+type WitnessSignature struct {
+	Validator uint16        `json:"validator"`
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+// Witness is the input of a circuit proving that a Bor block is in a checkpoint signed by a quorum of a validator
+// set. It is flat and fixed width where it can be, to map directly onto circuit inputs:
+//
+//   - the header leaf fields of the block, in HeaderVersion
+//   - the Merkle path of the leaf to the root of [StartBlock, EndBlock]
+//   - the signed side-tx data, which commits to the range and the root
+//   - the validator set, sorted by signer, and the signatures
+//
+// Fields a header version doesn't hash are still carried, so the layout doesn't depend on it.
+type Witness struct {
+	SchemaVersion uint16        `json:"schema_version"`
+	HeaderVersion HeaderVersion `json:"header_version"`
+
+	BlockNumber  uint64     `json:"block_number"`
+	Timestamp    uint64     `json:"timestamp"`
+	TxRoot       ethgo.Hash `json:"tx_root"`
+	ReceiptsRoot ethgo.Hash `json:"receipts_root"`
+	StateRoot    ethgo.Hash `json:"state_root"`
+	BlockHash    ethgo.Hash `json:"block_hash"`
+
+	StartBlock uint64       `json:"start_block"`
+	EndBlock   uint64       `json:"end_block"`
+	Path       []ethgo.Hash `json:"path"`
+
+	SignedData hexutil.Bytes      `json:"signed_data"`
+	Validators []WitnessValidator `json:"validators"`
+	Signatures []WitnessSignature `json:"signatures"`
+}
+
+// NewWitness exports the proof that b is in the checkpoint signed in stx, given the header proof of b in the
+// checkpoint's range. The validators are taken from vs, which has to include every signer, once.
+func NewWitness(b *ethgo.Block, proof *HeaderProof, stx *SideTxResponse, vs *ValidatorSet) (w *Witness, err error) {
+	if proof.BlockNumber != b.Number {
+		return nil, fmt.Errorf("block %v, proof is for block %v", b.Number, proof.BlockNumber)
+	}
+	if len(vs.Validators) > math.MaxUint16 {
+		return nil, fmt.Errorf("%v validators, at most %v fit a witness", len(vs.Validators), math.MaxUint16)
+	}
+	w = &Witness{
+		SchemaVersion: WitnessSchemaVersion,
+		HeaderVersion: proof.Version.orV1(),
+		BlockNumber:   b.Number,
+		Timestamp:     b.Timestamp,
+		TxRoot:        b.TransactionsRoot,
+		ReceiptsRoot:  b.ReceiptsRoot,
+		StateRoot:     b.StateRoot,
+		BlockHash:     b.Hash,
+		StartBlock:    proof.StartBlock,
+		EndBlock:      proof.EndBlock,
+		Path:          proof.Path,
+		SignedData:    hexutil.Bytes(stx.Data),
+	}
+
+	vals := append([]Validator(nil), vs.Validators...)
+	sort.Slice(vals, func(i, j int) bool { return bytes.Compare(vals[i].Signer[:], vals[j].Signer[:]) < 0 })
+	index := make(map[ethgo.Address]uint16, len(vals))
+	for i, v := range vals {
+		w.Validators = append(w.Validators, WitnessValidator{Signer: v.Signer, Power: uint64(v.VotingPower)})
+		index[v.Signer] = uint16(i)
+	}
+
+	vote := NewSideTxYesVote(nil, stx.Data)
+	signed := make(map[uint16]bool, len(stx.Sigs))
+	for i := range stx.Sigs {
+		var signer ethgo.Address
+		if signer, err = stx.Sigs[i].Signer(vote); err != nil {
+			return nil, fmt.Errorf("sig %v: %w", i, err)
+		}
+		idx, ok := index[signer]
+		if !ok {
+			return nil, fmt.Errorf("sig %v: %w: %v", i, ErrUnknownSigner, signer)
+		}
+		if signed[idx] {
+			return nil, fmt.Errorf("sig %v: %w %v", i, ErrDuplicateSigner, signer)
+		}
+		signed[idx] = true
+		w.Signatures = append(w.Signatures, WitnessSignature{Validator: idx, Signature: stx.Sigs[i].Bytes()})
+	}
+	sort.SliceStable(w.Signatures, func(i, j int) bool { return w.Signatures[i].Validator < w.Signatures[j].Validator })
+	return
+}
+
+// WitnessResult is what a verified witness attests to - the public outputs of a circuit.
+type WitnessResult struct {
+	BlockLeaf            ethgo.Hash `json:"block_leaf"`
+	RootHash             ethgo.Hash `json:"root_hash"`
+	ValidatorsCommitment ethgo.Hash `json:"validators_commitment"`
+	SignedPower          uint64     `json:"signed_power"`
+	TotalPower           uint64     `json:"total_power"`
+}
+
+// ValidatorsCommitment is keccak256 of signer ++ power (8 bytes, big endian) for every validator, in order - what a
+// circuit's verifier compares with the validator set it trusts.
+func (w *Witness) ValidatorsCommitment() ethgo.Hash {
+	data := make([]byte, 0, len(w.Validators)*28)
+	for _, v := range w.Validators {
+		data = append(data, v.Signer[:]...)
+		data = binary.BigEndian.AppendUint64(data, v.Power)
+	}
+	return ethgo.BytesToHash(ethgo.Keccak256(data))
+}
+
+func (w *Witness) block() *ethgo.Block {
+	return &ethgo.Block{
+		Number:           w.BlockNumber,
+		Timestamp:        w.Timestamp,
+		TransactionsRoot: w.TxRoot,
+		ReceiptsRoot:     w.ReceiptsRoot,
+		StateRoot:        w.StateRoot,
+		Hash:             w.BlockHash,
+	}
+}
+
+// Verify is the reference verifier: it checks the witness the way a circuit has to, with nothing but the witness.
+// The signatures have to be from strictly more than 2/3 of the validators' power.
+func (w *Witness) Verify() (res *WitnessResult, err error) {
+	if w.SchemaVersion != WitnessSchemaVersion {
+		return nil, fmt.Errorf("%w: schema version %v", ErrInvalidWitness, w.SchemaVersion)
+	}
+	res = &WitnessResult{ValidatorsCommitment: w.ValidatorsCommitment()}
+
+	var leaf [32]byte
+	if leaf, err = w.HeaderVersion.Leaf(w.block()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	res.BlockLeaf = leaf
+	proof := &HeaderProof{Version: w.HeaderVersion, StartBlock: w.StartBlock, EndBlock: w.EndBlock,
+		BlockNumber: w.BlockNumber, HeaderHash: leaf, Path: w.Path}
+	if res.RootHash, err = proof.Root(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+
+	var signed *CheckpointData
+	if signed, err = DecodeCheckpointData(w.SignedData); err != nil {
+		return nil, fmt.Errorf("%w: signed data: %v", ErrInvalidWitness, err)
+	}
+	if !signed.Start.IsUint64() || signed.Start.Uint64() != w.StartBlock || !signed.End.IsUint64() ||
+		signed.End.Uint64() != w.EndBlock {
+		return nil, fmt.Errorf("%w: signed range [%v, %v], witness range [%v, %v]", ErrInvalidWitness, signed.Start,
+			signed.End, w.StartBlock, w.EndBlock)
+	}
+	if signed.RootHash != res.RootHash {
+		return nil, fmt.Errorf("%w: signed root %v, path root %v", ErrInvalidWitness, signed.RootHash, res.RootHash)
+	}
+
+	for _, v := range w.Validators {
+		if res.TotalPower+v.Power < res.TotalPower {
+			return nil, fmt.Errorf("%w: total power overflows", ErrInvalidWitness)
+		}
+		res.TotalPower += v.Power
+	}
+	signBytes := NewSideTxYesVote(nil, w.SignedData).SignBytes()
+	for i, sig := range w.Signatures {
+		if int(sig.Validator) >= len(w.Validators) || (i > 0 && sig.Validator <= w.Signatures[i-1].Validator) {
+			return nil, fmt.Errorf("%w: sig %v has validator index %v", ErrInvalidWitness, i, sig.Validator)
+		}
+		var signer ethgo.Address
+		if signer, err = wallet.EcrecoverMsg(signBytes, sig.Signature); err != nil {
+			return nil, fmt.Errorf("%w: sig %v: %v", ErrInvalidWitness, i, err)
+		}
+		if v := w.Validators[sig.Validator]; signer != v.Signer {
+			return nil, fmt.Errorf("%w: sig %v is from %v, not validator %v", ErrInvalidWitness, i, signer, v.Signer)
+		}
+		res.SignedPower += w.Validators[sig.Validator].Power
+	}
+	// compared in 128 bits, since the powers are only bounded by their uint64 total
+	signedHi, signedLo := bits.Mul64(res.SignedPower, 3)
+	totalHi, totalLo := bits.Mul64(res.TotalPower, 2)
+	if signedHi < totalHi || (signedHi == totalHi && signedLo <= totalLo) {
+		return nil, fmt.Errorf("%w: %v of %v", ErrNoQuorum, res.SignedPower, res.TotalPower)
+	}
+	return
+}
+
+// MarshalBinary is the canonical encoding: big endian integers, fixed width fields, and length prefixed lists.
+//
+//	magic "BPWT" | schema u16 | header version u8
+//	block number u64 | timestamp u64 | tx root | receipts root | state root | block hash (32 bytes each)
+//	start block u64 | end block u64 | path length u8 | path (32 bytes each)
+//	signed data length u32 | signed data
+//	validator count u16 | (signer 20 bytes | power u64) each
+//	signature count u16 | (validator index u16 | r s v 65 bytes) each
+func (w *Witness) MarshalBinary() ([]byte, error) {
+	if len(w.Path) > math.MaxUint8 || len(w.SignedData) > math.MaxUint32 || len(w.Validators) > math.MaxUint16 ||
+		len(w.Signatures) > math.MaxUint16 || w.HeaderVersion > math.MaxUint8 {
+		return nil, fmt.Errorf("%w: too large to encode", ErrInvalidWitness)
+	}
+	var buf bytes.Buffer
+	buf.Write(witnessMagic[:])
+	_ = binary.Write(&buf, binary.BigEndian, w.SchemaVersion)
+	buf.WriteByte(byte(w.HeaderVersion))
+	_ = binary.Write(&buf, binary.BigEndian, w.BlockNumber)
+	_ = binary.Write(&buf, binary.BigEndian, w.Timestamp)
+	for _, h := range []ethgo.Hash{w.TxRoot, w.ReceiptsRoot, w.StateRoot, w.BlockHash} {
+		buf.Write(h[:])
+	}
+	_ = binary.Write(&buf, binary.BigEndian, w.StartBlock)
+	_ = binary.Write(&buf, binary.BigEndian, w.EndBlock)
+	buf.WriteByte(byte(len(w.Path)))
+	for _, h := range w.Path {
+		buf.Write(h[:])
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(w.SignedData)))
+	buf.Write(w.SignedData)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(w.Validators)))
+	for _, v := range w.Validators {
+		buf.Write(v.Signer[:])
+		_ = binary.Write(&buf, binary.BigEndian, v.Power)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(w.Signatures)))
+	for _, sig := range w.Signatures {
+		if len(sig.Signature) != 65 {
+			return nil, fmt.Errorf("%w: signature is %v bytes", ErrInvalidWitness, len(sig.Signature))
+		}
+		_ = binary.Write(&buf, binary.BigEndian, sig.Validator)
+		buf.Write(sig.Signature)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the canonical encoding. Trailing bytes are an error, so every witness has exactly one
+// encoding.
+func (w *Witness) UnmarshalBinary(data []byte) (err error) {
+	r := bytes.NewReader(data)
+	read := func(v interface{}) {
+		if err == nil {
+			err = binary.Read(r, binary.BigEndian, v)
+		}
+	}
+	var magic [4]byte
+	read(&magic)
+	if err == nil && magic != witnessMagic {
+		return fmt.Errorf("%w: not a witness", ErrInvalidWitness)
+	}
+	*w = Witness{}
+	var headerVersion uint8
+	read(&w.SchemaVersion)
+	read(&headerVersion)
+	w.HeaderVersion = HeaderVersion(headerVersion)
+	read(&w.BlockNumber)
+	read(&w.Timestamp)
+	read(&w.TxRoot)
+	read(&w.ReceiptsRoot)
+	read(&w.StateRoot)
+	read(&w.BlockHash)
+	read(&w.StartBlock)
+	read(&w.EndBlock)
+	var pathLen uint8
+	read(&pathLen)
+	if err == nil {
+		w.Path = make([]ethgo.Hash, pathLen)
+	}
+	for i := range w.Path {
+		read(&w.Path[i])
+	}
+	var dataLen uint32
+	read(&dataLen)
+	if err == nil {
+		if int64(dataLen) > int64(r.Len()) {
+			return fmt.Errorf("%w: signed data is %v bytes, %v left", ErrInvalidWitness, dataLen, r.Len())
+		}
+		w.SignedData = make([]byte, dataLen)
+		_, err = io.ReadFull(r, w.SignedData)
+	}
+	var valCount uint16
+	read(&valCount)
+	for i := 0; err == nil && i < int(valCount); i++ {
+		var v WitnessValidator
+		read(&v.Signer)
+		read(&v.Power)
+		w.Validators = append(w.Validators, v)
+	}
+	var sigCount uint16
+	read(&sigCount)
+	for i := 0; err == nil && i < int(sigCount); i++ {
+		sig := WitnessSignature{Signature: make([]byte, 65)}
+		read(&sig.Validator)
+		read(sig.Signature)
+		w.Signatures = append(w.Signatures, sig)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWitness, err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: %v trailing bytes", ErrInvalidWitness, r.Len())
+	}
+	return
+}
@@ -0,0 +1,144 @@
+package heimdall
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+var updateWitness = flag.Bool("update-witness", false, "rewrite the witness test vectors in data/")
+
+// testWitness is the witness of block 103 of the test checkpoint, signed by 3 of its 4 validators.
+func testWitness(t *testing.T) *Witness {
+	header, blocks, stx, vs := testCheckpoint(t, common.HexToHash("0x5afe"), 3)
+	proof, _, err := BuildHeaderProof(blocks, header.Number.Uint64(), HeaderV2)
+	require.NoError(t, err)
+	w, err := NewWitness(headerBlock(header), proof, stx, vs)
+	require.NoError(t, err)
+	return w
+}
+
+// testCheckpoint2809Witness is the witness of a real block in the real root of checkpoint 2809, signed by test keys.
+func testCheckpoint2809Witness(t *testing.T) *Witness {
+	header, blocks, stx, vs := testCheckpoint2809(t)
+	proof, _, err := BuildHeaderProof(blocks, header.Number.Uint64(), HeaderV1)
+	require.NoError(t, err)
+	w, err := NewWitness(headerBlock(header), proof, stx, vs)
+	require.NoError(t, err)
+	return w
+}
+
+func TestWitness(t *testing.T) {
+	w := testWitness(t)
+	res, err := w.Verify()
+	require.NoError(t, err)
+	require.Equal(t, uint64(300), res.SignedPower)
+	require.Equal(t, uint64(400), res.TotalPower)
+	signed, err := DecodeCheckpointData(w.SignedData)
+	require.NoError(t, err)
+	require.Equal(t, signed.RootHash, res.RootHash)
+	for i := 1; i < len(w.Validators); i++ {
+		require.Equal(t, -1, bytes.Compare(w.Validators[i-1].Signer[:], w.Validators[i].Signer[:]))
+	}
+
+	// the encodings round trip
+	bin, err := w.MarshalBinary()
+	require.NoError(t, err)
+	var fromBin Witness
+	require.NoError(t, fromBin.UnmarshalBinary(bin))
+	require.Equal(t, w, &fromBin)
+	js, err := json.Marshal(w)
+	require.NoError(t, err)
+	var fromJSON Witness
+	require.NoError(t, json.Unmarshal(js, &fromJSON))
+	require.Equal(t, w, &fromJSON)
+
+	require.ErrorIs(t, fromBin.UnmarshalBinary(append(bin, 0)), ErrInvalidWitness)
+	require.ErrorIs(t, fromBin.UnmarshalBinary(bin[:len(bin)-1]), ErrInvalidWitness)
+	require.ErrorIs(t, fromBin.UnmarshalBinary(bin[4:]), ErrInvalidWitness)
+
+	// two signatures are not a quorum of 400
+	short := *w
+	short.Signatures = w.Signatures[:2]
+	_, err = short.Verify()
+	require.ErrorIs(t, err, ErrNoQuorum)
+
+	// a validator signing twice is caught when the witness is built, as it is for a checkpoint submission
+	header, blocks, stx, vs := testCheckpoint(t, common.HexToHash("0x5afe"), 3)
+	proof, _, err := BuildHeaderProof(blocks, header.Number.Uint64(), HeaderV2)
+	require.NoError(t, err)
+	stx.Sigs = append(stx.Sigs, stx.Sigs[1])
+	_, err = NewWitness(headerBlock(header), proof, stx, vs)
+	require.ErrorIs(t, err, ErrDuplicateSigner)
+}
+
+func TestWitnessInvalid(t *testing.T) {
+	for name, tamper := range map[string]func(w *Witness){
+		"schema":         func(w *Witness) { w.SchemaVersion++ },
+		"state root":     func(w *Witness) { w.StateRoot[0] ^= 1 },
+		"block number":   func(w *Witness) { w.BlockNumber++ },
+		"path":           func(w *Witness) { w.Path[1][0] ^= 1 },
+		"path length":    func(w *Witness) { w.Path = w.Path[:2] },
+		"range":          func(w *Witness) { w.EndBlock++ },
+		"signed data":    func(w *Witness) { w.SignedData = w.SignedData[:64] },
+		"header v1":      func(w *Witness) { w.HeaderVersion = HeaderV1 },
+		"power":          func(w *Witness) { w.Validators[2].Power = 1000 },
+		"signer":         func(w *Witness) { w.Validators[0].Signer[0] ^= 1 },
+		"index":          func(w *Witness) { w.Signatures[0].Validator, w.Signatures[1].Validator = 1, 0 },
+		"duplicate":      func(w *Witness) { w.Signatures[1] = w.Signatures[0] },
+		"out of range":   func(w *Witness) { w.Signatures[2].Validator = 4 },
+		"signature":      func(w *Witness) { w.Signatures[0].Signature[5] ^= 1 },
+		"power overflow": func(w *Witness) { w.Validators[1].Power = ^uint64(0) },
+	} {
+		w := testWitness(t)
+		tamper(w)
+		_, err := w.Verify()
+		require.Error(t, err, name)
+	}
+}
+
+// the vectors in data/ are what circuit implementations test against: a synthetic v2 checkpoint, and a real v1 one.
+// they only change with the schema version - regenerate them with -update-witness.
+func TestWitnessVectors(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		witness      func(t *testing.T) *Witness
+		js, bin, res []byte
+	}{
+		{"witness-v1", testWitness, witnessV1JSON, witnessV1Bin, witnessV1Result},
+		{"witness-v1-checkpoint2809", testCheckpoint2809Witness, witnessCheckpoint2809JSON, witnessCheckpoint2809Bin,
+			witnessCheckpoint2809Result},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.witness(t)
+			res, err := w.Verify()
+			require.NoError(t, err)
+			js, err := json.MarshalIndent(w, "", "  ")
+			require.NoError(t, err)
+			bin, err := w.MarshalBinary()
+			require.NoError(t, err)
+			resJS, err := json.MarshalIndent(res, "", "  ")
+			require.NoError(t, err)
+
+			if *updateWitness {
+				require.NoError(t, os.WriteFile("data/"+tt.name+".json", append(js, '\n'), 0644))
+				require.NoError(t, os.WriteFile("data/"+tt.name+".bin", bin, 0644))
+				require.NoError(t, os.WriteFile("data/"+tt.name+"-result.json", append(resJS, '\n'), 0644))
+				return
+			}
+			require.Equal(t, string(tt.js), string(js)+"\n")
+			require.Equal(t, tt.bin, bin)
+			require.Equal(t, string(tt.res), string(resJS)+"\n")
+
+			var fromBin Witness
+			require.NoError(t, fromBin.UnmarshalBinary(tt.bin))
+			binRes, err := fromBin.Verify()
+			require.NoError(t, err)
+			require.Equal(t, res, binRes)
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package evm_research
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+)
+
+type NetworkId uint32
+
+var (
+	// New Ger event
+	updateL1InfoTreeSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("UpdateL1InfoTree(bytes32,bytes32)")))
+	l1InfoTreeEvent               = abi.MustNewEvent(`event UpdateL1InfoTree(
+        bytes32 indexed mainnetExitRoot,
+        bytes32 indexed rollupExitRoot
+	)`)
+
+	// PreLxLy events
+	updateGlobalExitRootSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("UpdateGlobalExitRoot(bytes32,bytes32)")))
+	v1GEREvent                        = abi.MustNewEvent(`event UpdateGlobalExitRoot(
+        bytes32 indexed mainnetExitRoot,
+        bytes32 indexed rollupExitRoot
+	)`)
+
+	// New Bridge events
+	depositEventSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("BridgeEvent(uint8,uint32,address,uint32,address,uint256,bytes,uint32)"))) // Used in oldBridge as well
+	depositEvent              = abi.MustNewEvent(`event BridgeEvent(
+	   uint8 leafType,
+	   uint32 originNetwork,
+	   address originAddress,
+	   uint32 destinationNetwork,
+	   address destinationAddress,
+	   uint256 amount,
+	   bytes metadata,
+	   uint32 depositCount
+	)`)
+
+	//     * @param globalIndex Global index is defined as:
+	//     * | 191 bits |    1 bit     |   32 bits   |     32 bits    |
+	//     * |    0     |  mainnetFlag | rollupIndex | localRootIndex |
+	//     * note that only the rollup index will be used only in case the mainnet flag is 0
+	//     * note that global index do not assert the unused bits to 0.
+	//     * This means that when synching the events, the globalIndex must be decoded the same way that in the Smart contract
+	//     * to avoid possible synch attacks
+
+	claimEventSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("ClaimEvent(uint256,uint32,address,address,uint256)")))
+	claimEvent              = abi.MustNewEvent(`event ClaimEvent(
+        uint256 globalIndex,
+        uint32 originNetwork,
+        address originAddress,
+        address destinationAddress,
+        uint256 amount
+	)`)
+
+	// Old Bridge events
+	oldClaimEventSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("ClaimEvent(uint32,uint32,address,address,uint256)")))
+	oldClaimEvent              = abi.MustNewEvent(`event ClaimEvent(
+        uint32 index,
+        uint32 originNetwork,
+        address originAddress,
+        address destinationAddress,
+        uint256 amount
+	)`)
+
+	verifyBatchesEtrogSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("VerifyBatches(uint64,bytes32,address)")))
+	verifyBatchesEtrogEvent         = abi.MustNewEvent(`event VerifyBatches(
+        uint64 indexed numBatch,
+        bytes32 stateRoot,
+        address indexed aggregator
+    )`)
+
+	verifyBatchesTrustedSequencerHash  = ethgo.Hash(ethgo.Keccak256([]byte("VerifyBatchesTrustedAggregator(uint64,bytes32,address)")))
+	verifyBatchesTrustedSequencerEvent = abi.MustNewEvent(`event VerifyBatchesTrustedAggregator(
+        uint64 indexed numBatch,
+        bytes32 stateRoot,
+        address indexed aggregator
+    )`)
+)
+
+const (
+	BridgeEventL1InfoTree = iota
+	BridgeEventV1GER
+	BridgeEventDeposit
+	BridgeEventV2Claim
+	BridgeEventV1Claim
+	BridgeEventVerifyBatchesEtrog
+	BridgeEventVerifyTrustedSequencer
+)
+
+var (
+	bridgeEventTypeMap = map[ethgo.Hash]int{
+		l1InfoTreeEvent.ID():                    BridgeEventL1InfoTree,
+		v1GEREvent.ID():                         BridgeEventV1GER,
+		depositEvent.ID():                       BridgeEventDeposit,
+		claimEvent.ID():                         BridgeEventV2Claim,
+		oldClaimEvent.ID():                      BridgeEventV1Claim,
+		verifyBatchesEtrogEvent.ID():            BridgeEventVerifyBatchesEtrog,
+		verifyBatchesTrustedSequencerEvent.ID(): BridgeEventVerifyTrustedSequencer,
+	}
+
+	bridgeEventParseMap = map[int]func(log *ethgo.Log) (map[string]interface{}, error){
+		BridgeEventL1InfoTree:             l1InfoTreeEvent.ParseLog,
+		BridgeEventV1GER:                  v1GEREvent.ParseLog,
+		BridgeEventDeposit:                depositEvent.ParseLog,
+		BridgeEventV2Claim:                claimEvent.ParseLog,
+		BridgeEventV1Claim:                oldClaimEvent.ParseLog,
+		BridgeEventVerifyBatchesEtrog:     verifyBatchesEtrogEvent.ParseLog,
+		BridgeEventVerifyTrustedSequencer: verifyBatchesTrustedSequencerEvent.ParseLog,
+	}
+)
+
+func maybeFromLog(l *ethgo.Log) *BridgeEvent {
+	if len(l.Topics) == 0 {
+		return nil
+	}
+	if et, ok := bridgeEventTypeMap[l.Topics[0]]; !ok {
+		return nil
+	} else {
+		data, _ := bridgeEventParseMap[et](l)
+		be := BridgeEvent{
+			Removed:          l.Removed,
+			BlockNumber:      l.BlockNumber,
+			TransactionIndex: l.TransactionIndex,
+			LogIndex:         l.LogIndex,
+			TransactionHash:  l.TransactionHash,
+			EventType:        uint8(et),
+			Data:             data,
+		}
+		return &be
+	}
+}
+
+type BridgeEvent struct {
+	NetworkID        NetworkId              `json:"network_id"`
+	Removed          bool                   `json:"removed"`
+	BlockNumber      uint64                 `json:"block_number"`
+	TransactionIndex uint64                 `json:"transaction_index"`
+	LogIndex         uint64                 `json:"log_index"`
+	TransactionHash  ethgo.Hash             `json:"transaction_hash"`
+	EventType        uint8                  `json:"event_type"`
+	Data             map[string]interface{} `json:"event_data"`
+}
+
+func mustToInt64(jn json.Number) int64 {
+	if n, err := jn.Int64(); err != nil {
+		panic("should not fail")
+	} else {
+		return n
+	}
+}
+
+func mustToBigInt(jn json.Number) *big.Int {
+	ret := new(big.Int)
+	ret.SetString(jn.String(), 10)
+	return ret
+}
+
+func (be BridgeEvent) toDeposit() Deposit {
+	leafType := be.Data["leafType"].(json.Number)
+	originNetwork := be.Data["originNetwork"].(json.Number)
+	originAddress := be.Data["originAddress"].(string)
+	amount := be.Data["amount"].(json.Number)
+	destinationNetwork := be.Data["destinationNetwork"].(json.Number)
+	destinationAddress := be.Data["destinationAddress"].(string)
+	depositCount := be.Data["depositCount"].(json.Number)
+	var metaBytes []byte
+	if maybeMeta, ok := be.Data["metadata"].(string); ok && len(maybeMeta) > 0 {
+		metaBytes, _ = base64.StdEncoding.DecodeString(maybeMeta)
+	}
+	dep := Deposit{
+		LeafType:           uint8(mustToInt64(leafType)),
+		OriginNetwork:      uint(mustToInt64(originNetwork)),
+		OriginAddress:      common.HexToAddress(originAddress),
+		Amount:             mustToBigInt(amount),
+		DestinationNetwork: uint(mustToInt64(destinationNetwork)),
+		DestinationAddress: common.HexToAddress(destinationAddress),
+		DepositCount:       uint(mustToInt64(depositCount)),
+		Metadata:           metaBytes,
+	}
+	return dep
+}
+
+func decodeBridgeEventFile(filePath string) (bevs []BridgeEvent, err error) {
+	var f *os.File
+	if f, err = os.Open(filePath); err != nil {
+		return
+	}
+
+	d := json.NewDecoder(f)
+	d.UseNumber()
+
+	cnt := 0
+	for {
+		var be BridgeEvent
+		if err = d.Decode(&be); err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			} else {
+				return
+			}
+		} else {
+			bevs = append(bevs, be)
+			cnt++
+		}
+	}
+	return
+}
+
+func processEventsSorted(ndJsonPaths []string) (ret []BridgeEvent, err error) {
+
+	for i := range ndJsonPaths {
+		var bevs []BridgeEvent
+		if bevs, err = decodeBridgeEventFile(ndJsonPaths[i]); err != nil {
+			return
+		}
+		ret = append(ret, bevs...)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		switch cmp.Compare(ret[i].BlockNumber, ret[j].BlockNumber) {
+		case -1:
+			return true
+		case 0:
+			{
+				switch cmp.Compare(ret[i].TransactionIndex, ret[j].TransactionIndex) {
+				case -1:
+					return true
+				case 0:
+					{
+						switch cmp.Compare(ret[i].LogIndex, ret[j].LogIndex) {
+						case -1:
+							return true
+						}
+					}
+				}
+			}
+		}
+		return false
+	})
+
+	return
+}
@@ -2,15 +2,13 @@ package evm_research
 
 import (
 	"bytes"
-	"cmp"
+	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/umbracle/ethgo/abi"
-	"io"
 	"math/big"
 	"os"
 	"sort"
@@ -28,179 +26,6 @@ var lxlyEVMBridgeDeployBlock = 16896718
 var lxlyEVMV2UpgradeBlock = 19100076
 var firstDepositEventBlock = 16898815
 
-var startBlock = lxlyEVMBridgeDeployBlock
-
-// var startBlock = 0 // for L2 / zkEVM
-
-var (
-	// New Ger event
-	updateL1InfoTreeSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("UpdateL1InfoTree(bytes32,bytes32)")))
-	l1InfoTreeEvent               = abi.MustNewEvent(`event UpdateL1InfoTree(
-        bytes32 indexed mainnetExitRoot,
-        bytes32 indexed rollupExitRoot
-	)`)
-
-	// PreLxLy events
-	updateGlobalExitRootSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("UpdateGlobalExitRoot(bytes32,bytes32)")))
-	v1GEREvent                        = abi.MustNewEvent(`event UpdateGlobalExitRoot(
-        bytes32 indexed mainnetExitRoot,
-        bytes32 indexed rollupExitRoot
-	)`)
-
-	// New Bridge events
-	depositEventSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("BridgeEvent(uint8,uint32,address,uint32,address,uint256,bytes,uint32)"))) // Used in oldBridge as well
-	depositEvent              = abi.MustNewEvent(`event BridgeEvent(
-	   uint8 leafType,
-	   uint32 originNetwork,
-	   address originAddress,
-	   uint32 destinationNetwork,
-	   address destinationAddress,
-	   uint256 amount,
-	   bytes metadata,
-	   uint32 depositCount
-	)`)
-
-	//     * @param globalIndex Global index is defined as:
-	//     * | 191 bits |    1 bit     |   32 bits   |     32 bits    |
-	//     * |    0     |  mainnetFlag | rollupIndex | localRootIndex |
-	//     * note that only the rollup index will be used only in case the mainnet flag is 0
-	//     * note that global index do not assert the unused bits to 0.
-	//     * This means that when synching the events, the globalIndex must be decoded the same way that in the Smart contract
-	//     * to avoid possible synch attacks
-
-	claimEventSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("ClaimEvent(uint256,uint32,address,address,uint256)")))
-	claimEvent              = abi.MustNewEvent(`event ClaimEvent(
-        uint256 globalIndex,
-        uint32 originNetwork,
-        address originAddress,
-        address destinationAddress,
-        uint256 amount
-	)`)
-
-	// Old Bridge events
-	oldClaimEventSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("ClaimEvent(uint32,uint32,address,address,uint256)")))
-	oldClaimEvent              = abi.MustNewEvent(`event ClaimEvent(
-        uint32 index,
-        uint32 originNetwork,
-        address originAddress,
-        address destinationAddress,
-        uint256 amount
-	)`)
-
-	verifyBatchesEtrogSignatureHash = ethgo.Hash(ethgo.Keccak256([]byte("VerifyBatches(uint64,bytes32,address)")))
-	verifyBatchesEtrogEvent         = abi.MustNewEvent(`event VerifyBatches(
-        uint64 indexed numBatch,
-        bytes32 stateRoot,
-        address indexed aggregator
-    )`)
-
-	verifyBatchesTrustedSequencerHash  = ethgo.Hash(ethgo.Keccak256([]byte("VerifyBatchesTrustedAggregator(uint64,bytes32,address)")))
-	verifyBatchesTrustedSequencerEvent = abi.MustNewEvent(`event VerifyBatchesTrustedAggregator(
-        uint64 indexed numBatch,
-        bytes32 stateRoot,
-        address indexed aggregator
-    )`)
-)
-
-const (
-	BridgeEventL1InfoTree = iota
-	BridgeEventV1GER
-	BridgeEventDeposit
-	BridgeEventV2Claim
-	BridgeEventV1Claim
-	BridgeEventVerifyBatchesEtrog
-	BridgeEventVerifyTrustedSequencer
-)
-
-var (
-	bridgeEventTypeMap = map[ethgo.Hash]int{
-		l1InfoTreeEvent.ID():                    BridgeEventL1InfoTree,
-		v1GEREvent.ID():                         BridgeEventV1GER,
-		depositEvent.ID():                       BridgeEventDeposit,
-		claimEvent.ID():                         BridgeEventV2Claim,
-		oldClaimEvent.ID():                      BridgeEventV1Claim,
-		verifyBatchesEtrogEvent.ID():            BridgeEventVerifyBatchesEtrog,
-		verifyBatchesTrustedSequencerEvent.ID(): BridgeEventVerifyTrustedSequencer,
-	}
-
-	bridgeEventParseMap = map[int]func(log *ethgo.Log) (map[string]interface{}, error){
-		BridgeEventL1InfoTree:             l1InfoTreeEvent.ParseLog,
-		BridgeEventV1GER:                  v1GEREvent.ParseLog,
-		BridgeEventDeposit:                depositEvent.ParseLog,
-		BridgeEventV2Claim:                claimEvent.ParseLog,
-		BridgeEventV1Claim:                oldClaimEvent.ParseLog,
-		BridgeEventVerifyBatchesEtrog:     verifyBatchesEtrogEvent.ParseLog,
-		BridgeEventVerifyTrustedSequencer: verifyBatchesTrustedSequencerEvent.ParseLog,
-	}
-)
-
-func maybeFromLog(l *ethgo.Log) *BridgeEvent {
-	if et, ok := bridgeEventTypeMap[l.Topics[0]]; !ok {
-		return nil
-	} else {
-		data, _ := bridgeEventParseMap[et](l)
-		be := BridgeEvent{
-			Removed:          l.Removed,
-			BlockNumber:      l.BlockNumber,
-			TransactionIndex: l.TransactionIndex,
-			LogIndex:         l.LogIndex,
-			TransactionHash:  l.TransactionHash,
-			EventType:        uint8(et),
-			Data:             data,
-		}
-		return &be
-	}
-}
-
-type BridgeEvent struct {
-	Removed          bool                   `json:"removed"`
-	BlockNumber      uint64                 `json:"block_number"`
-	TransactionIndex uint64                 `json:"transaction_index"`
-	LogIndex         uint64                 `json:"log_index"`
-	TransactionHash  ethgo.Hash             `json:"transaction_hash"`
-	EventType        uint8                  `json:"event_type"`
-	Data             map[string]interface{} `json:"event_data"`
-}
-
-func mustToInt64(jn json.Number) int64 {
-	if n, err := jn.Int64(); err != nil {
-		panic("should not fail")
-	} else {
-		return n
-	}
-}
-
-func mustToBigInt(jn json.Number) *big.Int {
-	ret := new(big.Int)
-	ret.SetString(jn.String(), 10)
-	return ret
-}
-
-func (be BridgeEvent) toDeposit() Deposit {
-	leafType := be.Data["leafType"].(json.Number)
-	originNetwork := be.Data["originNetwork"].(json.Number)
-	originAddress := be.Data["originAddress"].(string)
-	amount := be.Data["amount"].(json.Number)
-	destinationNetwork := be.Data["destinationNetwork"].(json.Number)
-	destinationAddress := be.Data["destinationAddress"].(string)
-	depositCount := be.Data["depositCount"].(json.Number)
-	var metaBytes []byte
-	if maybeMeta, ok := be.Data["metadata"].(string); ok && len(maybeMeta) > 0 {
-		metaBytes, _ = base64.StdEncoding.DecodeString(maybeMeta)
-	}
-	dep := Deposit{
-		LeafType:           uint8(mustToInt64(leafType)),
-		OriginNetwork:      uint(mustToInt64(originNetwork)),
-		OriginAddress:      common.HexToAddress(originAddress),
-		Amount:             mustToBigInt(amount),
-		DestinationNetwork: uint(mustToInt64(destinationNetwork)),
-		DestinationAddress: common.HexToAddress(destinationAddress),
-		DepositCount:       uint(mustToInt64(depositCount)),
-		Metadata:           metaBytes,
-	}
-	return dep
-}
-
 func TestEventDefCompat(t *testing.T) {
 	// this checks the compatibility of ethgo-based event defs and their equivalent from zkevm-bridge-service
 	require.Equal(t, updateL1InfoTreeSignatureHash.Bytes(), l1InfoTreeEvent.ID().Bytes())
@@ -213,131 +38,22 @@ func TestEventDefCompat(t *testing.T) {
 }
 
 func TestBridgeExtractEvents(t *testing.T) {
-
-	ec, err := jsonrpc.NewClient(os.Getenv("ETH_URL"))
+	cfg, err := LoadLxLyConfig("./lxly_networks.yaml")
 	require.NoError(t, err)
 
-	fromBlockNum := ethgo.BlockNumber(startBlock)
-
-	f, err := os.Create("./bridge_events_20k.ndjson")
-	require.NoError(t, err)
-	defer f.Close()
-
-	cntEvent := 0
-	cntMap := make(map[uint8]int)
-
-	for {
-		toBlockNum := fromBlockNum + 999
-
-		filter := ethgo.LogFilter{
-			// Address:   []ethgo.Address{lxlyEVMBridgeEthMainnetAddr, lxlyEVMGlobalExitRootAddr},
-			// Topics:    topics,
-			BlockHash: nil,
-			From:      &fromBlockNum,
-			To:        &toBlockNum,
-		}
-
-		// this seems to be the most efficient way to query ...?
-
-		filter.Address = []ethgo.Address{lxlyEVMBridgeEthMainnetAddr}
-		llBridge, err := ec.Eth().GetLogs(&filter)
-		require.NoError(t, err)
-
-		filter.Address = []ethgo.Address{lxlyEVMGlobalExitRootAddr}
-		llGER, err := ec.Eth().GetLogs(&filter)
-		require.NoError(t, err)
-
-		filter.Address = []ethgo.Address{lxlyEVMRollupManagerAddr}
-		llRM, err := ec.Eth().GetLogs(&filter)
-		require.NoError(t, err)
-
-		ll := append(llBridge, llGER...)
-		ll = append(ll, llRM...)
-
-		fmt.Printf("queried blocks %v to %v, %v events\n", int(fromBlockNum), int(toBlockNum), len(ll))
-
-		if len(ll) > 0 {
-			for _, l := range ll {
-				if maybeBridgeEvent := maybeFromLog(l); maybeBridgeEvent != nil {
-					json, err := json.Marshal(maybeBridgeEvent)
-					require.NoError(t, err)
-					f.WriteString(string(json) + "\n")
-					cntEvent++
-					cntMap[maybeBridgeEvent.EventType] += 1
-				}
-			}
-		}
-
-		if cntEvent >= 20_000 {
-			break
-		}
-
-		fromBlockNum = toBlockNum + 1
-	}
-
-	fmt.Printf("type count summary: 0: %v, 1: %v, 2: %v, 3: %v, 4: %v\n", cntMap[0], cntMap[1], cntMap[2], cntMap[3], cntMap[4])
-}
-
-func decodeBridgeEventFile(filePath string) (bevs []BridgeEvent, err error) {
-	var f *os.File
-	if f, err = os.Open(filePath); err != nil {
-		return
+	// bound the extraction for testing - otherwise it runs to the head of each chain
+	for i := range cfg.Networks {
+		cfg.Networks[i].EndBlock = cfg.Networks[i].DeployBlock + 100_000
 	}
 
-	d := json.NewDecoder(f)
-	d.UseNumber()
-
-	cnt := 0
-	for {
-		var be BridgeEvent
-		if err = d.Decode(&be); err != nil {
-			if err == io.EOF {
-				err = nil
-				break
-			} else {
-				return
-			}
-		} else {
-			bevs = append(bevs, be)
-			cnt++
-		}
-	}
-	return
-}
-
-func processEventsSorted(ndJsonPaths []string) (ret []BridgeEvent, err error) {
-
-	for i := range ndJsonPaths {
-		var bevs []BridgeEvent
-		if bevs, err = decodeBridgeEventFile(ndJsonPaths[i]); err != nil {
-			return
-		}
-		ret = append(ret, bevs...)
+	x := LxLyExtractor{
+		Config: cfg,
+		OutDir: ".",
+		Progress: func(nid NetworkId, from, to uint64, cntEvents int) {
+			fmt.Printf("network %v: queried blocks %v to %v, %v events\n", nid, from, to, cntEvents)
+		},
 	}
-
-	sort.Slice(ret, func(i, j int) bool {
-		switch cmp.Compare(ret[i].BlockNumber, ret[j].BlockNumber) {
-		case -1:
-			return true
-		case 0:
-			{
-				switch cmp.Compare(ret[i].TransactionIndex, ret[j].TransactionIndex) {
-				case -1:
-					return true
-				case 0:
-					{
-						switch cmp.Compare(ret[i].LogIndex, ret[j].LogIndex) {
-						case -1:
-							return true
-						}
-					}
-				}
-			}
-		}
-		return false
-	})
-
-	return
+	require.NoError(t, x.Run(context.Background()))
 }
 
 func TestBridgeProcessEvents(t *testing.T) {
@@ -513,7 +229,9 @@ func TestRollupManagerEvents(t *testing.T) {
 }
 
 func TestLERCalc(t *testing.T) {
-	bevs, err := processEventsSorted([]string{"./bridge_events_20k.ndjson"})
+	// runs over the mainnet events written by TestBridgeExtractEvents
+	x := LxLyExtractor{OutDir: "."}
+	bevs, err := processEventsSorted([]string{x.OutputPath(0)})
 	require.NoError(t, err)
 
 	const treeHeight = 32
@@ -582,8 +300,6 @@ func TestLERCalc(t *testing.T) {
 //    pub origin_token_address: Address,
 //}
 
-type NetworkId uint32
-
 type TokenInfo struct {
 	OriginNetwork      NetworkId
 	OriginTokenAddress ethgo.Address
@@ -0,0 +1,89 @@
+package evm_research
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LxLyNetworkConfig describes the LxLy contracts deployed on a single chain. L1 has a rollup manager, L2s generally do
+// not, in which case RollupManagerAddr is left as the zero address.
+type LxLyNetworkConfig struct {
+	Name              string        `json:"name" yaml:"name"`
+	NetworkID         NetworkId     `json:"network_id" yaml:"network_id"`
+	RPCURL            string        `json:"rpc_url" yaml:"rpc_url"`
+	BridgeAddr        ethgo.Address `json:"bridge" yaml:"bridge"`
+	GERAddr           ethgo.Address `json:"global_exit_root" yaml:"global_exit_root"`
+	RollupManagerAddr ethgo.Address `json:"rollup_manager" yaml:"rollup_manager"`
+	DeployBlock       uint64        `json:"deploy_block" yaml:"deploy_block"`
+	// V2UpgradeBlock is the first block after the LxLy (V2) upgrade. zero if not known.
+	V2UpgradeBlock uint64 `json:"v2_upgrade_block" yaml:"v2_upgrade_block"`
+	// EndBlock bounds the extraction. zero means 'latest block at the time the extraction starts'
+	EndBlock uint64 `json:"end_block" yaml:"end_block"`
+}
+
+type LxLyConfig struct {
+	Networks []LxLyNetworkConfig `json:"networks" yaml:"networks"`
+}
+
+// contractAddrs returns the contracts to query for the network - the rollup manager only if one is configured.
+func (nc *LxLyNetworkConfig) contractAddrs() []ethgo.Address {
+	addrs := []ethgo.Address{nc.BridgeAddr, nc.GERAddr}
+	if nc.RollupManagerAddr != ethgo.ZeroAddress {
+		addrs = append(addrs, nc.RollupManagerAddr)
+	}
+	return addrs
+}
+
+func (c *LxLyConfig) validate() error {
+	seen := make(map[NetworkId]bool)
+	for i := range c.Networks {
+		nc := &c.Networks[i]
+		if seen[nc.NetworkID] {
+			return fmt.Errorf("duplicate network id %v", nc.NetworkID)
+		}
+		seen[nc.NetworkID] = true
+		if nc.RPCURL == "" {
+			return fmt.Errorf("network %v (%v): missing rpc url", nc.NetworkID, nc.Name)
+		}
+		if nc.BridgeAddr == ethgo.ZeroAddress || nc.GERAddr == ethgo.ZeroAddress {
+			return fmt.Errorf("network %v (%v): bridge and global exit root addresses are required", nc.NetworkID, nc.Name)
+		}
+		if nc.EndBlock != 0 && nc.EndBlock < nc.DeployBlock {
+			return fmt.Errorf("network %v (%v): end block %v is before deploy block %v", nc.NetworkID, nc.Name, nc.EndBlock, nc.DeployBlock)
+		}
+	}
+	return nil
+}
+
+// ParseLxLyConfig decodes a network config as YAML, or JSON if isJSON is set. Environment variables in the config
+// (e.g. ${ETH_URL}) are expanded before decoding so RPC endpoints and keys don't need to be committed.
+func ParseLxLyConfig(data []byte, isJSON bool) (cfg *LxLyConfig, err error) {
+	expanded := []byte(os.ExpandEnv(string(data)))
+	cfg = &LxLyConfig{}
+	if isJSON {
+		err = json.Unmarshal(expanded, cfg)
+	} else {
+		err = yaml.Unmarshal(expanded, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// LoadLxLyConfig reads a network config file, choosing the format by extension.
+func LoadLxLyConfig(path string) (cfg *LxLyConfig, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	return ParseLxLyConfig(data, strings.EqualFold(filepath.Ext(path), ".json"))
+}
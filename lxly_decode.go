@@ -0,0 +1,432 @@
+package evm_research
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/umbracle/ethgo"
+	"math/big"
+)
+
+// the LxLy (V2) upgrade changed the bridge in two ways that matter for decoding:
+// . ClaimEvent kept its name but its first argument went from `uint32 index` to `uint256 globalIndex`
+// . the GER manager stopped emitting UpdateGlobalExitRoot and started emitting UpdateL1InfoTree
+// LxLyDecoder normalizes both eras into LxLyEvent, so downstream processing doesn't have to care which it is looking at.
+
+type BridgeEra uint8
+
+const (
+	BridgeEraV1 BridgeEra = iota + 1
+	BridgeEraV2
+)
+
+func (e BridgeEra) String() string {
+	switch e {
+	case BridgeEraV1:
+		return "v1"
+	case BridgeEraV2:
+		return "v2"
+	}
+	return "unknown"
+}
+
+type LxLyEventKind uint8
+
+const (
+	LxLyEventDeposit LxLyEventKind = iota + 1
+	LxLyEventClaim
+	LxLyEventExitRoots
+	LxLyEventVerifyBatches
+)
+
+// ErrWrongEra is returned for an event that cannot have been emitted in the era of the block it appears in.
+var ErrWrongEra = errors.New("event not valid for block era")
+
+//     * Global index is defined as:
+//     * | 191 bits |    1 bit     |   32 bits   |     32 bits    |
+//     * |    0     |  mainnetFlag | rollupIndex | localRootIndex |
+
+const globalIndexMainnetFlagBit = 64
+
+// Claim is a claim event in V2 terms. V1 claims are mapped onto the V2 global index.
+type Claim struct {
+	GlobalIndex        *big.Int       `json:"globalIndex"`
+	MainnetFlag        bool           `json:"mainnetFlag"`
+	RollupIndex        uint32         `json:"rollupIndex"`
+	LocalRootIndex     uint32         `json:"localRootIndex"`
+	OriginNetwork      uint           `json:"originNetwork"`
+	OriginAddress      common.Address `json:"originAddress"`
+	DestinationAddress common.Address `json:"destinationAddress"`
+	Amount             *big.Int       `json:"amount"`
+}
+
+func makeGlobalIndex(mainnetFlag bool, rollupIndex, localRootIndex uint32) *big.Int {
+	gi := new(big.Int).Lsh(big.NewInt(int64(rollupIndex)), 32)
+	gi.Or(gi, big.NewInt(int64(localRootIndex)))
+	if mainnetFlag {
+		gi.SetBit(gi, globalIndexMainnetFlagBit, 1)
+	}
+	return gi
+}
+
+// ExitRoots is a GER update - either a V1 UpdateGlobalExitRoot or a V2 UpdateL1InfoTree.
+type ExitRoots struct {
+	MainnetExitRoot ethgo.Hash `json:"mainnetExitRoot"`
+	RollupExitRoot  ethgo.Hash `json:"rollupExitRoot"`
+}
+
+// GlobalExitRoot is keccak(mainnetExitRoot, rollupExitRoot), the same in both eras.
+func (er *ExitRoots) GlobalExitRoot() ethgo.Hash {
+	return ethgo.Hash(Hash(er.MainnetExitRoot, er.RollupExitRoot))
+}
+
+type VerifyBatches struct {
+	NumBatch          uint64        `json:"numBatch"`
+	StateRoot         ethgo.Hash    `json:"stateRoot"`
+	Aggregator        ethgo.Address `json:"aggregator"`
+	TrustedAggregator bool          `json:"trustedAggregator"`
+}
+
+// LxLyEvent is a bridge event normalized across the V1 / V2 upgrade. Exactly one of the payload fields is set,
+// according to Kind.
+type LxLyEvent struct {
+	NetworkID        NetworkId     `json:"network_id"`
+	BlockNumber      uint64        `json:"block_number"`
+	TransactionIndex uint64        `json:"transaction_index"`
+	LogIndex         uint64        `json:"log_index"`
+	TransactionHash  ethgo.Hash    `json:"transaction_hash"`
+	Era              BridgeEra     `json:"era"`
+	Kind             LxLyEventKind `json:"kind"`
+	// SourceType is the BridgeEvent* type the event was decoded from
+	SourceType uint8 `json:"source_type"`
+
+	Deposit       *Deposit       `json:"deposit,omitempty"`
+	Claim         *Claim         `json:"claim,omitempty"`
+	ExitRoots     *ExitRoots     `json:"exit_roots,omitempty"`
+	VerifyBatches *VerifyBatches `json:"verify_batches,omitempty"`
+
+	// Anomalies are things that are valid enough to decode but should not happen on a healthy bridge
+	Anomalies []string `json:"anomalies,omitempty"`
+}
+
+func (ev *LxLyEvent) flag(format string, args ...interface{}) {
+	ev.Anomalies = append(ev.Anomalies, fmt.Sprintf(format, args...))
+}
+
+// LxLyDecoder decodes the events of a single network. It keeps a little state (the expected next deposit count) so
+// that gaps can be flagged - events need to be fed to it in chain order.
+type LxLyDecoder struct {
+	NetworkID NetworkId
+	// UpgradeBlock is the first block of the V2 era. zero means the boundary is not known for this network, in which
+	// case the era is taken from the event signature and not checked.
+	UpgradeBlock uint64
+
+	nextDepositCount uint
+	seenDeposit      bool
+}
+
+func NewLxLyDecoder(nc *LxLyNetworkConfig) *LxLyDecoder {
+	return &LxLyDecoder{NetworkID: nc.NetworkID, UpgradeBlock: nc.V2UpgradeBlock}
+}
+
+// blockEra is the era of a block, or 0 if the boundary is unknown.
+func (d *LxLyDecoder) blockEra(blockNum uint64) BridgeEra {
+	switch {
+	case d.UpgradeBlock == 0:
+		return 0
+	case blockNum < d.UpgradeBlock:
+		return BridgeEraV1
+	default:
+		return BridgeEraV2
+	}
+}
+
+// eventEra is the era an event type can appear in, or 0 if it is valid in both.
+func eventEra(eventType uint8) BridgeEra {
+	switch eventType {
+	case BridgeEventV1GER, BridgeEventV1Claim:
+		return BridgeEraV1
+	case BridgeEventL1InfoTree, BridgeEventV2Claim:
+		return BridgeEraV2
+	}
+	return 0
+}
+
+// Decode normalizes a single event. It returns an error wrapping ErrWrongEra if the event type cannot appear in the
+// block's era, or a decoding error if the event data is malformed.
+func (d *LxLyDecoder) Decode(be *BridgeEvent) (ev *LxLyEvent, err error) {
+	ev = &LxLyEvent{
+		NetworkID:        d.NetworkID,
+		BlockNumber:      be.BlockNumber,
+		TransactionIndex: be.TransactionIndex,
+		LogIndex:         be.LogIndex,
+		TransactionHash:  be.TransactionHash,
+		SourceType:       be.EventType,
+	}
+	if be.NetworkID != d.NetworkID {
+		ev.flag("event tagged with network %v, decoded as network %v", be.NetworkID, d.NetworkID)
+	}
+	if be.Removed {
+		ev.flag("log was removed by a reorg")
+	}
+
+	ev.Era = d.blockEra(be.BlockNumber)
+	if evEra := eventEra(be.EventType); evEra != 0 {
+		if ev.Era != 0 && ev.Era != evEra {
+			return nil, fmt.Errorf("%w: %v event type %v in %v block %v (upgrade block %v)",
+				ErrWrongEra, evEra, be.EventType, ev.Era, be.BlockNumber, d.UpgradeBlock)
+		}
+		ev.Era = evEra
+	}
+
+	switch be.EventType {
+	case BridgeEventDeposit:
+		ev.Kind = LxLyEventDeposit
+		err = d.decodeDeposit(be, ev)
+	case BridgeEventV1Claim, BridgeEventV2Claim:
+		ev.Kind = LxLyEventClaim
+		err = d.decodeClaim(be, ev)
+	case BridgeEventV1GER, BridgeEventL1InfoTree:
+		ev.Kind = LxLyEventExitRoots
+		ev.ExitRoots = &ExitRoots{}
+		if ev.ExitRoots.MainnetExitRoot, err = dataHash(be.Data, "mainnetExitRoot"); err != nil {
+			break
+		}
+		ev.ExitRoots.RollupExitRoot, err = dataHash(be.Data, "rollupExitRoot")
+	case BridgeEventVerifyBatchesEtrog, BridgeEventVerifyTrustedSequencer:
+		ev.Kind = LxLyEventVerifyBatches
+		err = decodeVerifyBatches(be, ev)
+	default:
+		err = fmt.Errorf("unknown event type %v", be.EventType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("block %v, log %v: %w", be.BlockNumber, be.LogIndex, err)
+	}
+	return
+}
+
+func (d *LxLyDecoder) decodeDeposit(be *BridgeEvent, ev *LxLyEvent) (err error) {
+	dep := &Deposit{}
+	var n *big.Int
+	if n, err = dataBigInt(be.Data, "leafType"); err != nil {
+		return
+	}
+	dep.LeafType = uint8(n.Uint64())
+	if n, err = dataBigInt(be.Data, "originNetwork"); err != nil {
+		return
+	}
+	dep.OriginNetwork = uint(n.Uint64())
+	if n, err = dataBigInt(be.Data, "destinationNetwork"); err != nil {
+		return
+	}
+	dep.DestinationNetwork = uint(n.Uint64())
+	if n, err = dataBigInt(be.Data, "depositCount"); err != nil {
+		return
+	}
+	dep.DepositCount = uint(n.Uint64())
+	if dep.Amount, err = dataBigInt(be.Data, "amount"); err != nil {
+		return
+	}
+	var addr ethgo.Address
+	if addr, err = dataAddress(be.Data, "originAddress"); err != nil {
+		return
+	}
+	dep.OriginAddress = common.Address(addr)
+	if addr, err = dataAddress(be.Data, "destinationAddress"); err != nil {
+		return
+	}
+	dep.DestinationAddress = common.Address(addr)
+	if dep.Metadata, err = dataBytes(be.Data, "metadata"); err != nil {
+		return
+	}
+	ev.Deposit = dep
+
+	if dep.DestinationNetwork == uint(d.NetworkID) {
+		ev.flag("deposit destination is the network it was made on")
+	}
+	if d.seenDeposit && dep.DepositCount != d.nextDepositCount {
+		ev.flag("deposit count %v, expected %v", dep.DepositCount, d.nextDepositCount)
+	}
+	d.seenDeposit = true
+	d.nextDepositCount = dep.DepositCount + 1
+	return
+}
+
+func (d *LxLyDecoder) decodeClaim(be *BridgeEvent, ev *LxLyEvent) (err error) {
+	c := &Claim{}
+	if be.EventType == BridgeEventV1Claim {
+		var idx *big.Int
+		if idx, err = dataBigInt(be.Data, "index"); err != nil {
+			return
+		}
+		if !idx.IsUint64() || idx.Uint64() > 0xffffffff {
+			return fmt.Errorf("v1 claim index %v out of range", idx)
+		}
+		// V1 had exactly one rollup. a claim on L1 is always of a rollup deposit, a claim on L2 of a mainnet deposit.
+		c.LocalRootIndex = uint32(idx.Uint64())
+		c.MainnetFlag = d.NetworkID != 0
+		c.GlobalIndex = makeGlobalIndex(c.MainnetFlag, 0, c.LocalRootIndex)
+	} else {
+		if c.GlobalIndex, err = dataBigInt(be.Data, "globalIndex"); err != nil {
+			return
+		}
+		gi := c.GlobalIndex
+		c.LocalRootIndex = uint32(new(big.Int).And(gi, big.NewInt(0xffffffff)).Uint64())
+		c.RollupIndex = uint32(new(big.Int).And(new(big.Int).Rsh(gi, 32), big.NewInt(0xffffffff)).Uint64())
+		c.MainnetFlag = gi.Bit(globalIndexMainnetFlagBit) == 1
+		// the contract does not assert the unused bits are zero, so they must be decoded the same way - and flagged
+		if gi.BitLen() > globalIndexMainnetFlagBit+1 {
+			ev.flag("global index %v has non-zero unused bits", gi)
+		}
+		if c.MainnetFlag && c.RollupIndex != 0 {
+			ev.flag("mainnet claim with non-zero rollup index %v (ignored)", c.RollupIndex)
+		}
+		if c.MainnetFlag && d.NetworkID == 0 {
+			ev.flag("mainnet deposit claimed on mainnet")
+		}
+	}
+
+	var n *big.Int
+	if n, err = dataBigInt(be.Data, "originNetwork"); err != nil {
+		return
+	}
+	c.OriginNetwork = uint(n.Uint64())
+	var addr ethgo.Address
+	if addr, err = dataAddress(be.Data, "originAddress"); err != nil {
+		return
+	}
+	c.OriginAddress = common.Address(addr)
+	if addr, err = dataAddress(be.Data, "destinationAddress"); err != nil {
+		return
+	}
+	c.DestinationAddress = common.Address(addr)
+	if c.Amount, err = dataBigInt(be.Data, "amount"); err != nil {
+		return
+	}
+	ev.Claim = c
+	return
+}
+
+func decodeVerifyBatches(be *BridgeEvent, ev *LxLyEvent) (err error) {
+	vb := &VerifyBatches{TrustedAggregator: be.EventType == BridgeEventVerifyTrustedSequencer}
+	var n *big.Int
+	if n, err = dataBigInt(be.Data, "numBatch"); err != nil {
+		return
+	}
+	vb.NumBatch = n.Uint64()
+	if vb.StateRoot, err = dataHash(be.Data, "stateRoot"); err != nil {
+		return
+	}
+	if vb.Aggregator, err = dataAddress(be.Data, "aggregator"); err != nil {
+		return
+	}
+	ev.VerifyBatches = vb
+	return
+}
+
+// event data comes either straight from the ABI decoder or back from ndjson (decoded with UseNumber, or without),
+// so the accessors below accept each of the representations a value can take.
+
+func dataValue(data map[string]interface{}, key string) (interface{}, error) {
+	v, ok := data[key]
+	if !ok {
+		return nil, fmt.Errorf("missing event field '%v'", key)
+	}
+	return v, nil
+}
+
+func dataBigInt(data map[string]interface{}, key string) (*big.Int, error) {
+	v, err := dataValue(data, key)
+	if err != nil {
+		return nil, err
+	}
+	switch n := v.(type) {
+	case *big.Int:
+		return new(big.Int).Set(n), nil
+	case json.Number:
+		if bn, ok := new(big.Int).SetString(n.String(), 10); ok {
+			return bn, nil
+		}
+	case float64:
+		if bn, acc := big.NewFloat(n).Int(nil); acc == big.Exact {
+			return bn, nil
+		}
+	case uint8:
+		return new(big.Int).SetUint64(uint64(n)), nil
+	case uint32:
+		return new(big.Int).SetUint64(uint64(n)), nil
+	case uint64:
+		return new(big.Int).SetUint64(n), nil
+	}
+	return nil, fmt.Errorf("event field '%v': cannot decode %v (%T) as an integer", key, v, v)
+}
+
+func dataAddress(data map[string]interface{}, key string) (addr ethgo.Address, err error) {
+	var v interface{}
+	if v, err = dataValue(data, key); err != nil {
+		return
+	}
+	switch a := v.(type) {
+	case ethgo.Address:
+		return a, nil
+	case string:
+		err = addr.UnmarshalText([]byte(a))
+		return
+	}
+	return addr, fmt.Errorf("event field '%v': cannot decode %v (%T) as an address", key, v, v)
+}
+
+func dataHash(data map[string]interface{}, key string) (h ethgo.Hash, err error) {
+	var v interface{}
+	if v, err = dataValue(data, key); err != nil {
+		return
+	}
+	switch hv := v.(type) {
+	case [32]byte:
+		return hv, nil
+	case ethgo.Hash:
+		return hv, nil
+	case string:
+		err = h.UnmarshalText([]byte(hv))
+		return
+	case []interface{}:
+		// [32]uint8 round-trips through json as an array of numbers
+		if len(hv) != 32 {
+			break
+		}
+		for i := range hv {
+			var n *big.Int
+			if n, err = dataBigInt(map[string]interface{}{key: hv[i]}, key); err != nil {
+				return
+			}
+			if !n.IsUint64() || n.Uint64() > 0xff {
+				return h, fmt.Errorf("event field '%v': byte %v out of range", key, n)
+			}
+			h[i] = byte(n.Uint64())
+		}
+		return
+	}
+	return h, fmt.Errorf("event field '%v': cannot decode %v (%T) as a hash", key, v, v)
+}
+
+func dataBytes(data map[string]interface{}, key string) ([]byte, error) {
+	v, err := dataValue(data, key)
+	if err != nil {
+		return nil, err
+	}
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		// []byte round-trips through json as base64
+		if len(b) == 0 {
+			return nil, nil
+		}
+		return base64.StdEncoding.DecodeString(b)
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("event field '%v': cannot decode %v (%T) as bytes", key, v, v)
+}
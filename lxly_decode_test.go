@@ -0,0 +1,136 @@
+package evm_research
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"math/big"
+	"testing"
+)
+
+var testL1Network = LxLyNetworkConfig{
+	Name:           "ethereum",
+	NetworkID:      0,
+	BridgeAddr:     lxlyEVMBridgeEthMainnetAddr,
+	GERAddr:        lxlyEVMGlobalExitRootAddr,
+	DeployBlock:    uint64(lxlyEVMBridgeDeployBlock),
+	V2UpgradeBlock: uint64(lxlyEVMV2UpgradeBlock),
+}
+
+func TestLxLyDecodeV1Events(t *testing.T) {
+	bevs, err := processEventsSorted([]string{"./bridge_events_2k.ndjson"})
+	require.NoError(t, err)
+
+	d := NewLxLyDecoder(&testL1Network)
+	cntKinds := make(map[LxLyEventKind]int)
+	for i := range bevs {
+		ev, err := d.Decode(&bevs[i])
+		require.NoError(t, err)
+		require.Equal(t, BridgeEraV1, ev.Era)
+		require.Empty(t, ev.Anomalies, "block %v, log %v", ev.BlockNumber, ev.LogIndex)
+		cntKinds[ev.Kind]++
+
+		switch ev.Kind {
+		case LxLyEventClaim:
+			// a V1 claim on L1 is always a claim of a rollup deposit
+			require.False(t, ev.Claim.MainnetFlag)
+			require.Equal(t, uint32(0), ev.Claim.RollupIndex)
+			require.Equal(t, uint64(ev.Claim.LocalRootIndex), ev.Claim.GlobalIndex.Uint64())
+		case LxLyEventDeposit:
+			require.Equal(t, bevs[i].toDeposit(), *ev.Deposit)
+		}
+	}
+	require.Equal(t, 1039, cntKinds[LxLyEventDeposit])
+	require.Equal(t, 74, cntKinds[LxLyEventClaim])
+	require.Equal(t, 1051, cntKinds[LxLyEventExitRoots])
+}
+
+func TestLxLyDecodeEraBoundary(t *testing.T) {
+	upgrade := uint64(lxlyEVMV2UpgradeBlock)
+	claimData := func(first string, v interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			first:                v,
+			"originNetwork":      json.Number("0"),
+			"originAddress":      "0x0000000000000000000000000000000000000000",
+			"destinationAddress": "0x7ab874Eeef0169ADA0d225E9801A3FfFfa26aAC3",
+			"amount":             json.Number("500000000000000000"),
+		}
+	}
+	exitRootData := map[string]interface{}{
+		"mainnetExitRoot": [32]byte{1},
+		"rollupExitRoot":  [32]byte{2},
+	}
+
+	tests := []struct {
+		name      string
+		be        BridgeEvent
+		wantErr   bool
+		era       BridgeEra
+		anomalies int
+	}{
+		{"v1 claim before upgrade", BridgeEvent{BlockNumber: upgrade - 1, EventType: BridgeEventV1Claim, Data: claimData("index", json.Number("7"))}, false, BridgeEraV1, 0},
+		{"v1 claim after upgrade", BridgeEvent{BlockNumber: upgrade, EventType: BridgeEventV1Claim, Data: claimData("index", json.Number("7"))}, true, 0, 0},
+		{"v2 claim before upgrade", BridgeEvent{BlockNumber: upgrade - 1, EventType: BridgeEventV2Claim, Data: claimData("globalIndex", big.NewInt(7))}, true, 0, 0},
+		{"v2 claim after upgrade", BridgeEvent{BlockNumber: upgrade, EventType: BridgeEventV2Claim, Data: claimData("globalIndex", big.NewInt(7))}, false, BridgeEraV2, 0},
+		{"v1 GER after upgrade", BridgeEvent{BlockNumber: upgrade + 10, EventType: BridgeEventV1GER, Data: exitRootData}, true, 0, 0},
+		{"L1 info tree before upgrade", BridgeEvent{BlockNumber: upgrade - 10, EventType: BridgeEventL1InfoTree, Data: exitRootData}, true, 0, 0},
+		{"L1 info tree after upgrade", BridgeEvent{BlockNumber: upgrade + 10, EventType: BridgeEventL1InfoTree, Data: exitRootData}, false, BridgeEraV2, 0},
+		{"v2 claim, unused bits set", BridgeEvent{BlockNumber: upgrade, EventType: BridgeEventV2Claim,
+			Data: claimData("globalIndex", new(big.Int).Lsh(big.NewInt(1), 100))}, false, BridgeEraV2, 1},
+		{"v2 mainnet claim on mainnet, with rollup index", BridgeEvent{BlockNumber: upgrade, EventType: BridgeEventV2Claim,
+			Data: claimData("globalIndex", makeGlobalIndex(true, 3, 7))}, false, BridgeEraV2, 2},
+		{"removed log", BridgeEvent{Removed: true, BlockNumber: upgrade, EventType: BridgeEventL1InfoTree, Data: exitRootData}, false, BridgeEraV2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := NewLxLyDecoder(&testL1Network).Decode(&tt.be)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrWrongEra)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.era, ev.Era)
+			require.Equal(t, tt.anomalies, len(ev.Anomalies), "%v", ev.Anomalies)
+		})
+	}
+
+	// with no known boundary, the era comes from the event itself
+	d := &LxLyDecoder{NetworkID: 1}
+	ev, err := d.Decode(&BridgeEvent{NetworkID: 1, BlockNumber: 5, EventType: BridgeEventV2Claim, Data: claimData("globalIndex", makeGlobalIndex(true, 0, 9))})
+	require.NoError(t, err)
+	require.Equal(t, BridgeEraV2, ev.Era)
+	require.True(t, ev.Claim.MainnetFlag)
+	require.Equal(t, uint32(9), ev.Claim.LocalRootIndex)
+	ev, err = d.Decode(&BridgeEvent{NetworkID: 1, BlockNumber: 6, EventType: BridgeEventV1Claim, Data: claimData("index", json.Number("9"))})
+	require.NoError(t, err)
+	require.Equal(t, BridgeEraV1, ev.Era)
+	require.Equal(t, makeGlobalIndex(true, 0, 9), ev.Claim.GlobalIndex, "a V1 claim on L2 maps to a mainnet global index")
+}
+
+func TestLxLyDecodeFromLogs(t *testing.T) {
+	// the same decoding has to work on events straight from the ABI decoder, not just from ndjson
+	d := NewLxLyDecoder(&testL1Network)
+	bridge := lxlyEVMBridgeEthMainnetAddr
+
+	var evs []*LxLyEvent
+	for i, dc := range []uint32{5, 6, 8} {
+		be := maybeFromLog(makeDepositLog(t, bridge, uint64(lxlyEVMV2UpgradeBlock+i), 0, dc, 1))
+		require.NotNil(t, be)
+		ev, err := d.Decode(be)
+		require.NoError(t, err)
+		evs = append(evs, ev)
+	}
+	require.Equal(t, uint(5), evs[0].Deposit.DepositCount)
+	require.Empty(t, evs[1].Anomalies)
+	require.Equal(t, []string{"deposit count 8, expected 7"}, evs[2].Anomalies)
+
+	be := maybeFromLog(makeGERLog(lxlyEVMGlobalExitRootAddr, uint64(lxlyEVMV2UpgradeBlock-1), 0, ethgo.HexToHash("0xaa")))
+	ev, err := d.Decode(be)
+	require.NoError(t, err)
+	require.Equal(t, ethgo.HexToHash("0xaa"), ev.ExitRoots.MainnetExitRoot)
+	require.Equal(t, ethgo.Hash(Hash(ethgo.HexToHash("0xaa"), ethgo.Hash{})), ev.ExitRoots.GlobalExitRoot())
+
+	_, err = d.Decode(&BridgeEvent{EventType: BridgeEventDeposit, Data: map[string]interface{}{}})
+	require.ErrorContains(t, err, "missing event field")
+}
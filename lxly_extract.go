@@ -0,0 +1,156 @@
+package evm_research
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/jsonrpc"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const defaultExtractBlockStep = 1000
+
+// LogQuerier is the subset of the eth JSON-RPC api needed to extract bridge events. *jsonrpc.Eth satisfies it.
+type LogQuerier interface {
+	GetLogs(filter *ethgo.LogFilter) ([]*ethgo.Log, error)
+	BlockNumber() (uint64, error)
+}
+
+var _ LogQuerier = &jsonrpc.Eth{}
+
+// LxLyExtractor pulls bridge, GER and rollup manager events for every network in a config, concurrently, and writes
+// them to a separate ndjson file per network. Each event is tagged with the network id it was read from.
+type LxLyExtractor struct {
+	Config *LxLyConfig
+	OutDir string
+	// BlockStep is the size of each eth_getLogs block range. defaults to 1000.
+	BlockStep uint64
+	// Dial creates the querier for a network. defaults to a JSON-RPC client on the configured URL.
+	Dial func(nc *LxLyNetworkConfig) (LogQuerier, error)
+	// Progress, if set, is called after each block range is processed.
+	Progress func(nid NetworkId, from, to uint64, cntEvents int)
+}
+
+func dialJsonRPC(nc *LxLyNetworkConfig) (LogQuerier, error) {
+	ec, err := jsonrpc.NewClient(nc.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	return ec.Eth(), nil
+}
+
+// OutputPath is the file the events for a network are written to.
+func (x *LxLyExtractor) OutputPath(nid NetworkId) string {
+	return filepath.Join(x.OutDir, fmt.Sprintf("bridge_events_%v.ndjson", nid))
+}
+
+// Run extracts all configured networks concurrently. It waits for every network to finish, and returns all the
+// errors encountered, joined.
+func (x *LxLyExtractor) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(x.Config.Networks))
+	for i := range x.Config.Networks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			nc := &x.Config.Networks[i]
+			if err := x.runNetwork(ctx, nc); err != nil {
+				errs[i] = fmt.Errorf("network %v (%v): %w", nc.NetworkID, nc.Name, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (x *LxLyExtractor) runNetwork(ctx context.Context, nc *LxLyNetworkConfig) (err error) {
+	dial := x.Dial
+	if dial == nil {
+		dial = dialJsonRPC
+	}
+	var q LogQuerier
+	if q, err = dial(nc); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.Create(x.OutputPath(nc.NetworkID)); err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return x.extractNetwork(ctx, q, nc, f)
+}
+
+func (x *LxLyExtractor) extractNetwork(ctx context.Context, q LogQuerier, nc *LxLyNetworkConfig, w io.Writer) (err error) {
+	step := x.BlockStep
+	if step == 0 {
+		step = defaultExtractBlockStep
+	}
+
+	endBlock := nc.EndBlock
+	if endBlock == 0 {
+		if endBlock, err = q.BlockNumber(); err != nil {
+			return
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	for from := nc.DeployBlock; from <= endBlock; from += step {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		to := min(from+step-1, endBlock)
+
+		fromBlockNum, toBlockNum := ethgo.BlockNumber(from), ethgo.BlockNumber(to)
+		filter := ethgo.LogFilter{
+			From: &fromBlockNum,
+			To:   &toBlockNum,
+		}
+
+		// query each contract separately - this seems to be the most efficient way to query ...?
+		var ll []*ethgo.Log
+		for _, addr := range nc.contractAddrs() {
+			filter.Address = []ethgo.Address{addr}
+			var llAddr []*ethgo.Log
+			if llAddr, err = q.GetLogs(&filter); err != nil {
+				return
+			}
+			ll = append(ll, llAddr...)
+		}
+		sortLogs(ll)
+
+		cntEvents := 0
+		for _, l := range ll {
+			if be := maybeFromLog(l); be != nil {
+				be.NetworkID = nc.NetworkID
+				if err = enc.Encode(be); err != nil {
+					return
+				}
+				cntEvents++
+			}
+		}
+		if x.Progress != nil {
+			x.Progress(nc.NetworkID, from, to, cntEvents)
+		}
+	}
+	return
+}
+
+// sortLogs puts logs from separate contract queries back into chain order.
+func sortLogs(ll []*ethgo.Log) {
+	sort.SliceStable(ll, func(i, j int) bool {
+		if ll[i].BlockNumber != ll[j].BlockNumber {
+			return ll[i].BlockNumber < ll[j].BlockNumber
+		}
+		return ll[i].LogIndex < ll[j].LogIndex
+	})
+}
@@ -0,0 +1,182 @@
+package evm_research
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/abi"
+	"math/big"
+	"sync"
+	"testing"
+)
+
+// fakeLogQuerier serves a fixed set of logs, filtered the same way eth_getLogs would be.
+type fakeLogQuerier struct {
+	head uint64
+	logs []*ethgo.Log
+
+	mtx     sync.Mutex
+	queries int
+}
+
+func (f *fakeLogQuerier) BlockNumber() (uint64, error) {
+	return f.head, nil
+}
+
+func (f *fakeLogQuerier) GetLogs(filter *ethgo.LogFilter) (ret []*ethgo.Log, err error) {
+	f.mtx.Lock()
+	f.queries++
+	f.mtx.Unlock()
+	for _, l := range f.logs {
+		if l.BlockNumber < uint64(*filter.From) || l.BlockNumber > uint64(*filter.To) {
+			continue
+		}
+		for _, a := range filter.Address {
+			if a == l.Address {
+				ret = append(ret, l)
+			}
+		}
+	}
+	return
+}
+
+func makeDepositLog(t *testing.T, bridge ethgo.Address, blockNum, logIndex uint64, depositCount uint32, destNetwork uint32) *ethgo.Log {
+	data, err := abi.Encode(map[string]interface{}{
+		"leafType":           uint8(0),
+		"originNetwork":      uint32(0),
+		"originAddress":      ethgo.ZeroAddress,
+		"destinationNetwork": destNetwork,
+		"destinationAddress": ethgo.HexToAddress("0x0185fb2F27f2Acda3e2a6B8530b342333e9f22A6"),
+		"amount":             big.NewInt(1000),
+		"metadata":           []byte{},
+		"depositCount":       depositCount,
+	}, depositEvent.Inputs)
+	require.NoError(t, err)
+	return &ethgo.Log{
+		Address:     bridge,
+		BlockNumber: blockNum,
+		LogIndex:    logIndex,
+		Topics:      []ethgo.Hash{depositEvent.ID()},
+		Data:        data,
+	}
+}
+
+func makeGERLog(ger ethgo.Address, blockNum, logIndex uint64, mainnetExitRoot ethgo.Hash) *ethgo.Log {
+	return &ethgo.Log{
+		Address:     ger,
+		BlockNumber: blockNum,
+		LogIndex:    logIndex,
+		Topics:      []ethgo.Hash{v1GEREvent.ID(), mainnetExitRoot, {}},
+	}
+}
+
+func TestLxLyConfigParse(t *testing.T) {
+	t.Setenv("ETH_URL", "http://l1.example:8545")
+	t.Setenv("ZKEVM_URL", "http://l2.example:8545")
+
+	cfg, err := LoadLxLyConfig("./lxly_networks.yaml")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(cfg.Networks))
+	require.Equal(t, "http://l1.example:8545", cfg.Networks[0].RPCURL)
+	require.Equal(t, lxlyEVMBridgeEthMainnetAddr, cfg.Networks[0].BridgeAddr)
+	require.Equal(t, lxlyEVMRollupManagerAddr, cfg.Networks[0].RollupManagerAddr)
+	require.Equal(t, uint64(lxlyEVMBridgeDeployBlock), cfg.Networks[0].DeployBlock)
+	require.Equal(t, NetworkId(1), cfg.Networks[1].NetworkID)
+	require.Equal(t, 2, len(cfg.Networks[1].contractAddrs()), "no rollup manager on L2")
+
+	jsonCfg := `{"networks":[{"name":"a","network_id":3,"rpc_url":"${ETH_URL}","bridge":"0x2a3DD3EB832aF982ec71669E178424b10Dca2EDe","global_exit_root":"0x580bda1e7A0CFAe92Fa7F6c20A3794F169CE3CFb"}]}`
+	cfg, err = ParseLxLyConfig([]byte(jsonCfg), true)
+	require.NoError(t, err)
+	require.Equal(t, NetworkId(3), cfg.Networks[0].NetworkID)
+	require.Equal(t, "http://l1.example:8545", cfg.Networks[0].RPCURL)
+
+	dupCfg := `
+networks:
+  - {network_id: 1, rpc_url: x, bridge: "0x2a3DD3EB832aF982ec71669E178424b10Dca2EDe", global_exit_root: "0x580bda1e7A0CFAe92Fa7F6c20A3794F169CE3CFb"}
+  - {network_id: 1, rpc_url: y, bridge: "0x2a3DD3EB832aF982ec71669E178424b10Dca2EDe", global_exit_root: "0x580bda1e7A0CFAe92Fa7F6c20A3794F169CE3CFb"}
+`
+	_, err = ParseLxLyConfig([]byte(dupCfg), false)
+	require.ErrorContains(t, err, "duplicate network id")
+}
+
+func TestLxLyExtractMultiNetwork(t *testing.T) {
+	l1Bridge, l1GER := ethgo.HexToAddress("0x01"), ethgo.HexToAddress("0x02")
+	l2Bridge, l2GER := ethgo.HexToAddress("0x11"), ethgo.HexToAddress("0x12")
+
+	l1 := &fakeLogQuerier{head: 5_000, logs: []*ethgo.Log{
+		makeGERLog(l1GER, 1_500, 1, ethgo.HexToHash("0xaa")),
+		makeDepositLog(t, l1Bridge, 1_500, 0, 0, 1),
+		makeDepositLog(t, l1Bridge, 2_600, 3, 1, 1),
+		makeDepositLog(t, ethgo.HexToAddress("0x99"), 2_600, 4, 7, 1), // not a configured contract
+		makeDepositLog(t, l1Bridge, 4_999, 0, 2, 1),
+	}}
+	l2 := &fakeLogQuerier{head: 900, logs: []*ethgo.Log{
+		makeDepositLog(t, l2Bridge, 10, 0, 0, 0),
+		makeGERLog(l2GER, 11, 0, ethgo.HexToHash("0xbb")),
+	}}
+
+	cfg := &LxLyConfig{Networks: []LxLyNetworkConfig{
+		{Name: "l1", NetworkID: 0, RPCURL: "l1", BridgeAddr: l1Bridge, GERAddr: l1GER, DeployBlock: 1_000},
+		{Name: "l2", NetworkID: 1, RPCURL: "l2", BridgeAddr: l2Bridge, GERAddr: l2GER},
+	}}
+	queriers := map[string]*fakeLogQuerier{"l1": l1, "l2": l2}
+
+	x := LxLyExtractor{
+		Config: cfg,
+		OutDir: t.TempDir(),
+		Dial: func(nc *LxLyNetworkConfig) (LogQuerier, error) {
+			return queriers[nc.RPCURL], nil
+		},
+	}
+	require.NoError(t, x.Run(context.Background()))
+
+	// blocks 1000 to 5000 is 5 ranges of 1000 blocks, 2 contracts each
+	require.Equal(t, 10, l1.queries)
+	require.Equal(t, 2, l2.queries)
+
+	l1Events, err := decodeBridgeEventFile(x.OutputPath(0))
+	require.NoError(t, err)
+	require.Equal(t, 4, len(l1Events))
+	require.Equal(t, uint8(BridgeEventDeposit), l1Events[0].EventType, "deposit log index sorts before the GER update")
+	require.Equal(t, uint8(BridgeEventV1GER), l1Events[1].EventType)
+	for _, be := range l1Events {
+		require.Equal(t, NetworkId(0), be.NetworkID)
+		if be.EventType == BridgeEventDeposit {
+			require.Equal(t, uint(1), be.toDeposit().DestinationNetwork)
+		}
+	}
+	require.Equal(t, uint(2), l1Events[3].toDeposit().DepositCount)
+
+	l2Events, err := decodeBridgeEventFile(x.OutputPath(1))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(l2Events))
+	for _, be := range l2Events {
+		require.Equal(t, NetworkId(1), be.NetworkID)
+	}
+}
+
+func TestLxLyExtractErrors(t *testing.T) {
+	cfg := &LxLyConfig{Networks: []LxLyNetworkConfig{
+		{Name: "ok", NetworkID: 0, RPCURL: "ok", BridgeAddr: ethgo.HexToAddress("0x01"), GERAddr: ethgo.HexToAddress("0x02")},
+		{Name: "broken", NetworkID: 1, RPCURL: "broken", BridgeAddr: ethgo.HexToAddress("0x01"), GERAddr: ethgo.HexToAddress("0x02")},
+	}}
+	x := LxLyExtractor{
+		Config: cfg,
+		OutDir: t.TempDir(),
+		Dial: func(nc *LxLyNetworkConfig) (LogQuerier, error) {
+			if nc.RPCURL == "broken" {
+				return nil, fmt.Errorf("cannot dial")
+			}
+			return &fakeLogQuerier{head: 10}, nil
+		},
+	}
+	err := x.Run(context.Background())
+	require.ErrorContains(t, err, "network 1 (broken): cannot dial")
+	require.NotContains(t, err.Error(), "network 0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	x.Dial = func(nc *LxLyNetworkConfig) (LogQuerier, error) { return &fakeLogQuerier{head: 10}, nil }
+	require.ErrorIs(t, x.Run(ctx), context.Canceled)
+}
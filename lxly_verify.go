@@ -0,0 +1,253 @@
+package evm_research
+
+import (
+	"fmt"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/contract"
+	"github.com/umbracle/ethgo/jsonrpc"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const exitTreeHeight = 32
+
+// BridgeStateReader reads the local exit tree state of a bridge as of a given block.
+type BridgeStateReader interface {
+	ExitRootAt(blockNum uint64) (root ethgo.Hash, depositCount uint64, err error)
+}
+
+type bridgeCaller struct {
+	c *contract.Contract
+}
+
+// NewBridgeStateReader reads exit tree state with eth_call against the PolygonZkEVMBridgeV2 ABI. note that
+// historical calls need an archive node.
+func NewBridgeStateReader(ec *jsonrpc.Client, bridgeAddr ethgo.Address) (BridgeStateReader, error) {
+	bridgeAbi, err := LoadABI("zkevm/PolygonZkEVMBridgeV2")
+	if err != nil {
+		return nil, err
+	}
+	return &bridgeCaller{c: contract.NewContract(bridgeAddr, bridgeAbi, contract.WithJsonRPC(ec.Eth()))}, nil
+}
+
+func (bc *bridgeCaller) ExitRootAt(blockNum uint64) (root ethgo.Hash, depositCount uint64, err error) {
+	var res map[string]interface{}
+	if res, err = bc.c.Call("getRoot", ethgo.BlockNumber(blockNum)); err != nil {
+		return
+	}
+	rootBytes, ok := res["0"].([32]byte)
+	if !ok {
+		return root, 0, fmt.Errorf("unexpected getRoot result %v", res)
+	}
+	if res, err = bc.c.Call("depositCount", ethgo.BlockNumber(blockNum)); err != nil {
+		return
+	}
+	cnt, ok := res["0"].(*big.Int)
+	if !ok || !cnt.IsUint64() {
+		return root, 0, fmt.Errorf("unexpected depositCount result %v", res)
+	}
+	return rootBytes, cnt.Uint64(), nil
+}
+
+// ExitRootSample compares the local and on-chain exit tree as of the end of a block.
+type ExitRootSample struct {
+	BlockNumber       uint64     `json:"block_number"`
+	LocalDepositCount uint64     `json:"local_deposit_count"`
+	LocalRoot         ethgo.Hash `json:"local_root"`
+	ChainDepositCount uint64     `json:"chain_deposit_count"`
+	ChainRoot         ethgo.Hash `json:"chain_root"`
+}
+
+func (s *ExitRootSample) Match() bool {
+	return s.LocalDepositCount == s.ChainDepositCount && s.LocalRoot == s.ChainRoot
+}
+
+type ExitRootReport struct {
+	Samples []ExitRootSample `json:"samples"`
+	// FirstMismatch is the first sampled block that diverges. nil if every sample matched.
+	FirstMismatch *ExitRootSample `json:"first_mismatch,omitempty"`
+	// FirstBadBlock narrows FirstMismatch down to the first block with a deposit where the trees diverge.
+	FirstBadBlock *ExitRootSample `json:"first_bad_block,omitempty"`
+	// FirstDepositOfBadBlock is the first deposit in FirstBadBlock - the earliest deposit the local tree may have
+	// wrong. eth_call only resolves roots per block, so the wrong deposit may be any of the block's deposits.
+	FirstDepositOfBadBlock *Deposit `json:"first_deposit_of_bad_block,omitempty"`
+}
+
+func (r *ExitRootReport) Ok() bool {
+	return r.FirstMismatch == nil
+}
+
+func (r *ExitRootReport) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	for i := range r.Samples {
+		s := &r.Samples[i]
+		status := "ok"
+		if !s.Match() {
+			status = "MISMATCH"
+		}
+		sb.WriteString(fmt.Sprintf("block %v: %v, local count %v root %v, chain count %v root %v\n",
+			s.BlockNumber, status, s.LocalDepositCount, s.LocalRoot, s.ChainDepositCount, s.ChainRoot))
+	}
+	if r.Ok() {
+		sb.WriteString(fmt.Sprintf("all %v samples match\n", len(r.Samples)))
+	} else {
+		sb.WriteString(fmt.Sprintf("first divergence at sampled block %v\n", r.FirstMismatch.BlockNumber))
+		if r.FirstBadBlock != nil {
+			sb.WriteString(fmt.Sprintf("trees diverge from block %v (local count %v, chain count %v)\n",
+				r.FirstBadBlock.BlockNumber, r.FirstBadBlock.LocalDepositCount, r.FirstBadBlock.ChainDepositCount))
+		}
+		if r.FirstDepositOfBadBlock != nil {
+			sb.WriteString(fmt.Sprintf("first deposit of first bad block: %v\n", r.FirstDepositOfBadBlock.JSON()))
+		}
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// localExitTree is the exit tree rebuilt from deposit events, with the root recorded at the end of each block that
+// has deposits so any block can be compared without replaying.
+type localExitTree struct {
+	deposits []Deposit
+	blocks   []uint64 // distinct blocks with deposits, ascending
+	counts   []uint64 // deposit count at the end of blocks[i]
+	roots    []ethgo.Hash
+	// firstDeposit[i] is the index in deposits of the first deposit in blocks[i]
+	firstDeposit []int
+}
+
+func buildLocalExitTree(bevs []BridgeEvent) (*localExitTree, error) {
+	lt := &localExitTree{}
+	et := NewExitTree()
+	var depositCount uint
+	for i := range bevs {
+		if bevs[i].EventType != BridgeEventDeposit {
+			continue
+		}
+		dep := bevs[i].toDeposit()
+		if dep.DepositCount != depositCount {
+			return nil, fmt.Errorf("block %v: deposit count %v, expected %v", bevs[i].BlockNumber, dep.DepositCount, depositCount)
+		}
+		depositCount++
+		if err := et.Append(hashDeposit(&dep)); err != nil {
+			return nil, err
+		}
+		lt.deposits = append(lt.deposits, dep)
+
+		bn := bevs[i].BlockNumber
+		if len(lt.blocks) == 0 || lt.blocks[len(lt.blocks)-1] != bn {
+			lt.blocks = append(lt.blocks, bn)
+			lt.counts = append(lt.counts, 0)
+			lt.roots = append(lt.roots, ethgo.Hash{})
+			lt.firstDeposit = append(lt.firstDeposit, len(lt.deposits)-1)
+		}
+		last := len(lt.blocks) - 1
+		lt.counts[last] = uint64(depositCount)
+		lt.roots[last] = et.Root()
+	}
+	return lt, nil
+}
+
+// at returns the local tree state as of the end of blockNum.
+func (lt *localExitTree) at(blockNum uint64) (cnt uint64, root ethgo.Hash) {
+	i := sort.Search(len(lt.blocks), func(i int) bool { return lt.blocks[i] > blockNum })
+	if i == 0 {
+		return 0, NewExitTree().Root()
+	}
+	return lt.counts[i-1], lt.roots[i-1]
+}
+
+func (lt *localExitTree) sample(reader BridgeStateReader, blockNum uint64) (s ExitRootSample, err error) {
+	s.BlockNumber = blockNum
+	s.LocalDepositCount, s.LocalRoot = lt.at(blockNum)
+	s.ChainRoot, s.ChainDepositCount, err = reader.ExitRootAt(blockNum)
+	return
+}
+
+// SampleDepositBlocks picks the block of every nth deposit, plus the block of the last one.
+func SampleDepositBlocks(bevs []BridgeEvent, every int) (blocks []uint64) {
+	var depositBlocks []uint64
+	for i := range bevs {
+		if bevs[i].EventType == BridgeEventDeposit {
+			depositBlocks = append(depositBlocks, bevs[i].BlockNumber)
+		}
+	}
+	for i := 0; i < len(depositBlocks); i += every {
+		blocks = append(blocks, depositBlocks[i])
+	}
+	if len(depositBlocks) > 0 && blocks[len(blocks)-1] != depositBlocks[len(depositBlocks)-1] {
+		blocks = append(blocks, depositBlocks[len(depositBlocks)-1])
+	}
+	return
+}
+
+// VerifyExitRoots rebuilds the exit tree from the (sorted) bridge events and compares its root and deposit count to
+// the bridge contract at each of the sample blocks. On the first divergence it bisects the deposit blocks between
+// the last matching sample and the mismatch to find the first deposit where the trees disagree. This assumes that
+// once the trees diverge they stay diverged, which holds since the root commits to every leaf.
+func VerifyExitRoots(bevs []BridgeEvent, reader BridgeStateReader, sampleBlocks []uint64) (report *ExitRootReport, err error) {
+	var lt *localExitTree
+	if lt, err = buildLocalExitTree(bevs); err != nil {
+		return
+	}
+
+	blocks := append([]uint64(nil), sampleBlocks...)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	report = &ExitRootReport{}
+	lastGood, hasLastGood := uint64(0), false
+	for _, bn := range blocks {
+		var s ExitRootSample
+		if s, err = lt.sample(reader, bn); err != nil {
+			return nil, fmt.Errorf("sampling block %v: %w", bn, err)
+		}
+		report.Samples = append(report.Samples, s)
+		if !s.Match() {
+			report.FirstMismatch = &report.Samples[len(report.Samples)-1]
+			break
+		}
+		lastGood, hasLastGood = bn, true
+	}
+	if report.FirstMismatch == nil {
+		return
+	}
+
+	// candidate blocks are those with deposits in (lastGood, mismatch], plus the mismatch block itself in case
+	// the local tree is missing deposits the chain has
+	lo := 0
+	if hasLastGood {
+		lo = sort.Search(len(lt.blocks), func(i int) bool { return lt.blocks[i] > lastGood })
+	}
+	hi := sort.Search(len(lt.blocks), func(i int) bool { return lt.blocks[i] > report.FirstMismatch.BlockNumber })
+	candidates := lt.blocks[lo:hi]
+
+	var bisectErr error
+	badIdx := sort.Search(len(candidates), func(i int) bool {
+		if bisectErr != nil {
+			return true
+		}
+		s, err := lt.sample(reader, candidates[i])
+		if err != nil {
+			bisectErr = err
+			return true
+		}
+		return !s.Match()
+	})
+	if bisectErr != nil {
+		return nil, fmt.Errorf("bisecting divergence: %w", bisectErr)
+	}
+
+	if badIdx == len(candidates) {
+		// every local deposit block matches - the chain has deposits the local events don't
+		report.FirstBadBlock = report.FirstMismatch
+		return
+	}
+	var s ExitRootSample
+	if s, err = lt.sample(reader, candidates[badIdx]); err != nil {
+		return nil, err
+	}
+	report.FirstBadBlock = &s
+	report.FirstDepositOfBadBlock = &lt.deposits[lt.firstDeposit[lo+badIdx]]
+	return
+}
@@ -0,0 +1,154 @@
+package evm_research
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"github.com/umbracle/ethgo/jsonrpc"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type recordedExitRoot struct {
+	blockNum     uint64
+	root         ethgo.Hash
+	depositCount uint64
+}
+
+// recordedBridgeState derives what getRoot / depositCount returned on chain from the recorded events: in V1 every
+// deposit updates the GER, so the mainnet exit root of each GER update is the bridge root at that point.
+func recordedBridgeState(t *testing.T, bevs []BridgeEvent) (recs []recordedExitRoot) {
+	var depositCount uint64
+	for i := range bevs {
+		switch bevs[i].EventType {
+		case BridgeEventDeposit:
+			depositCount++
+		case BridgeEventV1GER:
+			h, err := dataHash(bevs[i].Data, "mainnetExitRoot")
+			require.NoError(t, err)
+			recs = append(recs, recordedExitRoot{bevs[i].BlockNumber, h, depositCount})
+		}
+	}
+	return
+}
+
+// newBridgeRPCStandIn serves eth_call for getRoot() and depositCount() at a block from recorded values.
+func newBridgeRPCStandIn(t *testing.T, recs []recordedExitRoot) *httptest.Server {
+	bridgeAbi, err := LoadABI("zkevm/PolygonZkEVMBridgeV2")
+	require.NoError(t, err)
+	getRootSel := hex.EncodeToString(bridgeAbi.GetMethod("getRoot").ID())
+	depositCountSel := hex.EncodeToString(bridgeAbi.GetMethod("depositCount").ID())
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "eth_call", req.Method)
+
+		var msg map[string]string
+		require.NoError(t, json.Unmarshal(req.Params[0], &msg))
+		var blockTag string
+		require.NoError(t, json.Unmarshal(req.Params[1], &blockTag))
+		blockNum, err := strconv.ParseUint(strings.TrimPrefix(blockTag, "0x"), 16, 64)
+		require.NoError(t, err)
+
+		// state as of the end of the block is the last record at or before it
+		i := sort.Search(len(recs), func(i int) bool { return recs[i].blockNum > blockNum })
+		var rec recordedExitRoot
+		if i > 0 {
+			rec = recs[i-1]
+		}
+
+		var out [32]byte
+		switch strings.TrimPrefix(msg["data"], "0x")[:8] {
+		case getRootSel:
+			out = rec.root
+		case depositCountSel:
+			new(big.Int).SetUint64(rec.depositCount).FillBytes(out[:])
+		default:
+			t.Fatalf("unexpected call data %v", msg["data"])
+		}
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": "0x" + hex.EncodeToString(out[:])}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+}
+
+func TestVerifyExitRoots(t *testing.T) {
+	bevs, err := processEventsSorted([]string{"./bridge_events_2k.ndjson"})
+	require.NoError(t, err)
+	recs := recordedBridgeState(t, bevs)
+
+	srv := newBridgeRPCStandIn(t, recs)
+	defer srv.Close()
+
+	ec, err := jsonrpc.NewClient(srv.URL)
+	require.NoError(t, err)
+	reader, err := NewBridgeStateReader(ec, lxlyEVMBridgeEthMainnetAddr)
+	require.NoError(t, err)
+
+	sampleBlocks := SampleDepositBlocks(bevs, 100)
+	require.Equal(t, 12, len(sampleBlocks))
+
+	report, err := VerifyExitRoots(bevs, reader, sampleBlocks)
+	require.NoError(t, err)
+	require.True(t, report.Ok())
+	require.Equal(t, len(sampleBlocks), len(report.Samples))
+	require.Equal(t, uint64(1039), report.Samples[len(report.Samples)-1].ChainDepositCount)
+
+	// tamper with one deposit: the report should find the mismatch and narrow it to that deposit's block
+	const badDeposit = 437
+	tampered := make([]BridgeEvent, len(bevs))
+	copy(tampered, bevs)
+	var badBlock uint64
+	for i := range tampered {
+		if tampered[i].EventType == BridgeEventDeposit && tampered[i].toDeposit().DepositCount == badDeposit {
+			data := make(map[string]interface{})
+			for k, v := range tampered[i].Data {
+				data[k] = v
+			}
+			data["amount"] = json.Number("1")
+			tampered[i].Data = data
+			badBlock = tampered[i].BlockNumber
+		}
+	}
+	require.NotZero(t, badBlock)
+
+	report, err = VerifyExitRoots(tampered, reader, sampleBlocks)
+	require.NoError(t, err)
+	require.False(t, report.Ok())
+	require.Greater(t, report.FirstMismatch.BlockNumber, badBlock)
+	require.Equal(t, badBlock, report.FirstBadBlock.BlockNumber)
+	// eth_call can only resolve to a block, so the report points at the first deposit of the block - 436 shares a block with 437
+	require.Equal(t, uint(badDeposit-1), report.FirstDepositOfBadBlock.DepositCount)
+
+	var out bytes.Buffer
+	_, err = report.WriteTo(&out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "first deposit of first bad block")
+	require.Contains(t, out.String(), `"depositCount":436`)
+
+	// local events missing the tail deposits: the chain count is ahead, but no local deposit is wrong
+	var truncated []BridgeEvent
+	for i := range bevs {
+		if bevs[i].EventType == BridgeEventDeposit && bevs[i].toDeposit().DepositCount >= 1000 {
+			continue
+		}
+		truncated = append(truncated, bevs[i])
+	}
+	report, err = VerifyExitRoots(truncated, reader, sampleBlocks)
+	require.NoError(t, err)
+	require.False(t, report.Ok())
+	require.Nil(t, report.FirstDepositOfBadBlock)
+	require.Equal(t, uint64(1000), report.FirstBadBlock.LocalDepositCount)
+	require.Equal(t, uint64(1001), report.FirstBadBlock.ChainDepositCount)
+}
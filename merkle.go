@@ -3,10 +3,14 @@ package evm_research
 import (
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/umbracle/ethgo"
 	"golang.org/x/crypto/sha3"
+	"hash"
 	"math/big"
+	"runtime"
+	"sync"
 )
 
 const (
@@ -14,15 +18,52 @@ const (
 	KeyLen = 32
 )
 
+// keccakState is the sponge behind sha3.NewLegacyKeccak256. Read squeezes the digest out without the allocation
+// of Sum, and the state can be Reset and reused.
+type keccakState interface {
+	hash.Hash
+	Read([]byte) (int, error)
+}
+
+// keccakHasher hashes tree nodes on a reused state. input and output go through buffers in the hasher, since
+// anything passed to the state's Write / Read escapes. it is not safe for concurrent use - each goroutine should
+// have its own.
+type keccakHasher struct {
+	st  keccakState
+	in  [2 * KeyLen]byte
+	out [KeyLen]byte
+}
+
+func newKeccakHasher() *keccakHasher {
+	return &keccakHasher{st: sha3.NewLegacyKeccak256().(keccakState)}
+}
+
+func (kh *keccakHasher) hash(data ...[KeyLen]byte) [KeyLen]byte {
+	kh.st.Reset()
+	for i := range data {
+		copy(kh.in[:KeyLen], data[i][:])
+		kh.st.Write(kh.in[:KeyLen]) //nolint:errcheck,gosec
+	}
+	kh.st.Read(kh.out[:]) //nolint:errcheck,gosec
+	return kh.out
+}
+
+func (kh *keccakHasher) hash2(left, right *[KeyLen]byte) [KeyLen]byte {
+	copy(kh.in[:KeyLen], left[:])
+	copy(kh.in[KeyLen:], right[:])
+	kh.st.Reset()
+	kh.st.Write(kh.in[:]) //nolint:errcheck,gosec
+	kh.st.Read(kh.out[:]) //nolint:errcheck,gosec
+	return kh.out
+}
+
+var hasherPool = sync.Pool{New: func() any { return newKeccakHasher() }}
+
 // Hash calculates  the keccak hash of elements.
 func Hash(data ...[KeyLen]byte) [KeyLen]byte {
-	var res [KeyLen]byte
-	hash := sha3.NewLegacyKeccak256()
-	for _, d := range data {
-		hash.Write(d[:]) //nolint:errcheck,gosec
-	}
-	copy(res[:], hash.Sum(nil))
-	return res
+	kh := hasherPool.Get().(*keccakHasher)
+	defer hasherPool.Put(kh)
+	return kh.hash(data...)
 }
 
 // HashZero is an empty hash
@@ -40,21 +81,39 @@ func generateZeroHashes(height uint8) [][KeyLen]byte {
 	return zeroHashes
 }
 
+const zeroHashTableHeight = 64
+
+// zeroHashTable[h] is the root of an empty subtree of height h.
+var zeroHashTable = generateZeroHashes(zeroHashTableHeight)
+
+func zeroHashesFor(height uint8) [][KeyLen]byte {
+	if height <= zeroHashTableHeight {
+		return zeroHashTable
+	}
+	return generateZeroHashes(height)
+}
+
 func calculateRoot(frontier [][KeyLen]byte, index uint, height uint8) common.Hash {
-	var node, currentZero [KeyLen]byte
+	kh := hasherPool.Get().(*keccakHasher)
+	defer hasherPool.Put(kh)
+	zeros := zeroHashesFor(height)
+
+	var node [KeyLen]byte
 	var h uint8
 	for h = 0; h < height; h++ {
 		if ((index >> h) & 1) == 1 {
-			node = Hash(frontier[h], node)
+			node = kh.hash2(&frontier[h], &node)
 		} else {
-			node = Hash(node, currentZero)
+			node = kh.hash2(&node, &zeros[h])
 		}
-		currentZero = Hash(currentZero, currentZero)
 	}
 	return common.BytesToHash(node[:])
 }
 
 func addLeaf(leafHash common.Hash, frontier [][KeyLen]byte, index uint, height uint8) {
+	kh := hasherPool.Get().(*keccakHasher)
+	defer hasherPool.Put(kh)
+
 	var node [KeyLen]byte
 	copy(node[:], leafHash[:])
 	var h uint8
@@ -63,11 +122,76 @@ func addLeaf(leafHash common.Hash, frontier [][KeyLen]byte, index uint, height u
 			copy(frontier[h][:], node[:])
 			return
 		}
-		node = Hash(frontier[h], node)
+		node = kh.hash2(&frontier[h], &node)
 	}
 	panic("should not get here")
 }
 
+// levels narrower than this are hashed on a single goroutine - below it the coordination costs more than it saves.
+const minParallelLevelWidth = 1 << 12
+
+// rebuildTree computes the root of a full tree over leaves in one pass, level by level, hashing each wide level
+// across workers goroutines (GOMAXPROCS if workers <= 0). It also returns the frontier, so the tree can be
+// continued with addLeaf / calculateRoot from index len(leaves). This is meant for bulk import: the result is the
+// same as calling addLeaf for each leaf, without computing a root per leaf.
+func rebuildTree(leaves [][KeyLen]byte, height uint8, workers int) (root common.Hash, frontier [][KeyLen]byte, err error) {
+	if height < 64 && uint64(len(leaves)) > uint64(1)<<height {
+		return root, nil, fmt.Errorf("%v leaves do not fit in a tree of height %v", len(leaves), height)
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	zeros := zeroHashesFor(height)
+	frontier = make([][KeyLen]byte, height)
+	if len(leaves) == 0 {
+		return common.BytesToHash(zeros[height][:]), frontier, nil
+	}
+
+	// levels alternate between two buffers, each with room for the zero padding of an odd level
+	src := make([][KeyLen]byte, len(leaves), len(leaves)+1)
+	copy(src, leaves)
+	dst := make([][KeyLen]byte, 0, (len(leaves)+1)/2+1)
+	count := uint64(len(leaves))
+	var h uint8
+	for h = 0; h < height; h++ {
+		if full := count >> h; full&1 == 1 {
+			frontier[h] = src[full-1]
+		}
+		if len(src)%2 == 1 {
+			src = append(src, zeros[h])
+		}
+		dst = dst[:len(src)/2]
+		hashLevel(src, dst, workers)
+		src, dst = dst, src[:0]
+	}
+	return common.BytesToHash(src[0][:]), frontier, nil
+}
+
+func hashLevel(children, parents [][KeyLen]byte, workers int) {
+	hashRange := func(from, to int) {
+		kh := hasherPool.Get().(*keccakHasher)
+		defer hasherPool.Put(kh)
+		for i := from; i < to; i++ {
+			parents[i] = kh.hash2(&children[2*i], &children[2*i+1])
+		}
+	}
+	if workers == 1 || len(parents) < minParallelLevelWidth {
+		hashRange(0, len(parents))
+		return
+	}
+
+	chunk := (len(parents) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for from := 0; from < len(parents); from += chunk {
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			hashRange(from, to)
+		}(from, min(from+chunk, len(parents)))
+	}
+	wg.Wait()
+}
+
 type Deposit struct {
 	LeafType           uint8          `json:"leafType"`
 	OriginNetwork      uint           `json:"originNetwork"`
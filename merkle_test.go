@@ -0,0 +1,204 @@
+package evm_research
+
+import (
+	"encoding/binary"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"github.com/umbracle/ethgo"
+	"golang.org/x/crypto/sha3"
+	"testing"
+)
+
+// the original, allocating implementations - kept as the reference the optimized versions must match bit for bit
+
+func hashRef(data ...[KeyLen]byte) [KeyLen]byte {
+	var res [KeyLen]byte
+	hash := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hash.Write(d[:]) //nolint:errcheck,gosec
+	}
+	copy(res[:], hash.Sum(nil))
+	return res
+}
+
+func calculateRootRef(frontier [][KeyLen]byte, index uint, height uint8) common.Hash {
+	var node, currentZero [KeyLen]byte
+	var h uint8
+	for h = 0; h < height; h++ {
+		if ((index >> h) & 1) == 1 {
+			node = hashRef(frontier[h], node)
+		} else {
+			node = hashRef(node, currentZero)
+		}
+		currentZero = hashRef(currentZero, currentZero)
+	}
+	return common.BytesToHash(node[:])
+}
+
+func addLeafRef(leafHash common.Hash, frontier [][KeyLen]byte, index uint, height uint8) {
+	var node [KeyLen]byte
+	copy(node[:], leafHash[:])
+	var h uint8
+	for h = 0; h < height; h++ {
+		if ((index >> h) & 1) == 1 {
+			copy(frontier[h][:], node[:])
+			return
+		}
+		node = hashRef(frontier[h], node)
+	}
+	panic("should not get here")
+}
+
+func testLeaves(n int) [][KeyLen]byte {
+	leaves := make([][KeyLen]byte, n)
+	for i := range leaves {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(i))
+		copy(leaves[i][:], ethgo.Keccak256(b[:]))
+	}
+	return leaves
+}
+
+func TestHashEquivalence(t *testing.T) {
+	leaves := testLeaves(5)
+	require.Equal(t, hashRef(), Hash())
+	for i := range leaves {
+		require.Equal(t, hashRef(leaves[:i+1]...), Hash(leaves[:i+1]...))
+	}
+	for h, z := range generateZeroHashes(zeroHashTableHeight) {
+		require.Equal(t, z, zeroHashTable[h])
+	}
+}
+
+func TestIncrementalRootEquivalence(t *testing.T) {
+	leaves := testLeaves(300)
+	for _, height := range []uint8{9, exitTreeHeight, 70} {
+		frontier := make([][KeyLen]byte, height)
+		frontierRef := make([][KeyLen]byte, height)
+		require.Equal(t, calculateRootRef(frontierRef, 0, height), calculateRoot(frontier, 0, height))
+		for i := range leaves {
+			addLeaf(leaves[i], frontier, uint(i+1), height)
+			addLeafRef(leaves[i], frontierRef, uint(i+1), height)
+			require.Equal(t, frontierRef, frontier)
+			require.Equal(t, calculateRootRef(frontierRef, uint(i+1), height), calculateRoot(frontier, uint(i+1), height),
+				"height %v, leaf %v", height, i)
+		}
+	}
+
+	// the exit tree root over the recorded deposits should be unchanged as well
+	bevs, err := processEventsSorted([]string{"./bridge_events_2k.ndjson"})
+	require.NoError(t, err)
+	lt, err := buildLocalExitTree(bevs)
+	require.NoError(t, err)
+	frontierRef := make([][KeyLen]byte, exitTreeHeight)
+	for i := range lt.deposits {
+		addLeafRef(hashDeposit(&lt.deposits[i]), frontierRef, uint(i+1), exitTreeHeight)
+	}
+	require.Equal(t, calculateRootRef(frontierRef, uint(len(lt.deposits)), exitTreeHeight), common.Hash(lt.roots[len(lt.roots)-1]))
+}
+
+func TestRebuildTree(t *testing.T) {
+	const parallelWidth = 3*minParallelLevelWidth + 5
+	for _, n := range []int{0, 1, 2, 3, 7, 8, 300, 1 << 9, parallelWidth * 2} {
+		leaves := testLeaves(n)
+		frontier := make([][KeyLen]byte, exitTreeHeight)
+		for i := range leaves {
+			addLeaf(leaves[i], frontier, uint(i+1), exitTreeHeight)
+		}
+		want := calculateRoot(frontier, uint(n), exitTreeHeight)
+
+		for _, workers := range []int{1, 4} {
+			root, rebuilt, err := rebuildTree(leaves, exitTreeHeight, workers)
+			require.NoError(t, err)
+			require.Equal(t, want, root, "%v leaves, %v workers", n, workers)
+			require.Equal(t, want, calculateRoot(rebuilt, uint(n), exitTreeHeight))
+
+			// the frontier has to carry on exactly like the incremental one
+			next := testLeaves(n + 3)[n:]
+			for i := range next {
+				addLeaf(next[i], rebuilt, uint(n+i+1), exitTreeHeight)
+			}
+			cont := append([][KeyLen]byte(nil), frontier...)
+			for i := range next {
+				addLeaf(next[i], cont, uint(n+i+1), exitTreeHeight)
+			}
+			require.Equal(t, calculateRoot(cont, uint(n+3), exitTreeHeight), calculateRoot(rebuilt, uint(n+3), exitTreeHeight))
+		}
+	}
+
+	// a full tree, and one leaf too many
+	// (addLeaf can't fill the last slot, so check it by hand)
+	l := testLeaves(8)
+	root, _, err := rebuildTree(l, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash(hashRef(
+		hashRef(hashRef(l[0], l[1]), hashRef(l[2], l[3])),
+		hashRef(hashRef(l[4], l[5]), hashRef(l[6], l[7])))), root)
+	_, _, err = rebuildTree(testLeaves(9), 3, 0)
+	require.Error(t, err)
+}
+
+const benchTreeLeaves = 1 << 20
+
+func BenchmarkExitTreeBuild(b *testing.B) {
+	leaves := testLeaves(benchTreeLeaves)
+
+	b.Run("reference", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			frontier := make([][KeyLen]byte, exitTreeHeight)
+			for j := range leaves {
+				addLeafRef(leaves[j], frontier, uint(j+1), exitTreeHeight)
+			}
+			calculateRootRef(frontier, uint(len(leaves)), exitTreeHeight)
+		}
+	})
+	b.Run("incremental", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			frontier := make([][KeyLen]byte, exitTreeHeight)
+			for j := range leaves {
+				addLeaf(leaves[j], frontier, uint(j+1), exitTreeHeight)
+			}
+			calculateRoot(frontier, uint(len(leaves)), exitTreeHeight)
+		}
+	})
+	b.Run("rebuild-1", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _, _ = rebuildTree(leaves, exitTreeHeight, 1)
+		}
+	})
+	b.Run("rebuild-parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _, _ = rebuildTree(leaves, exitTreeHeight, 0)
+		}
+	})
+}
+
+// a root after every leaf, as when replaying deposits and checking each against the chain
+func BenchmarkExitTreeRootPerLeaf(b *testing.B) {
+	leaves := testLeaves(1 << 14)
+
+	b.Run("reference", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			frontier := make([][KeyLen]byte, exitTreeHeight)
+			for j := range leaves {
+				addLeafRef(leaves[j], frontier, uint(j+1), exitTreeHeight)
+				calculateRootRef(frontier, uint(j+1), exitTreeHeight)
+			}
+		}
+	})
+	b.Run("optimized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			frontier := make([][KeyLen]byte, exitTreeHeight)
+			for j := range leaves {
+				addLeaf(leaves[j], frontier, uint(j+1), exitTreeHeight)
+				calculateRoot(frontier, uint(j+1), exitTreeHeight)
+			}
+		}
+	})
+}